@@ -3,6 +3,7 @@ package config
 import (
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -14,22 +15,124 @@ type Config struct {
 	Db         DatabaseConfig `yaml:"db"`
 	OAuth      OAuthConfig    `yaml:"oauth"`
 	HTTPServer HTTPServer     `yaml:"http_server"`
-	JWTSecret  string         `yaml:"jwt_secret" env:"JWT_SECRET" env-required:"true"`
+	JWTSecret  string         `yaml:"jwt_secret" env:"JWT_SECRET"`
+	JWT        JWT            `yaml:"jwt"`
+	TwoFactor  TwoFactor      `yaml:"two_factor"`
+	Session    Session        `yaml:"session"`
+	Stream     Stream         `yaml:"stream"`
+	Social     Social         `yaml:"social"`
+	Comments   Comments       `yaml:"comments"`
+}
+
+// Comments limits comment threads. MaxDepth is how many levels of replies
+// are returned below a page of comments; PageSize is how many comments a page
+// holds unless the client asks for fewer.
+type Comments struct {
+	MaxDepth int `yaml:"max_depth" env:"COMMENTS_MAX_DEPTH" env-default:"8"`
+	PageSize int `yaml:"page_size" env:"COMMENTS_PAGE_SIZE" env-default:"20"`
+}
+
+// Social sets voting rules. SelfVotePolicy is "allow" or "deny"; with "deny"
+// users cannot vote on their own jokes and comments. RankingRefreshInterval
+// is how often the rising scores of recent jokes are recomputed as votes age
+// out of the velocity window.
+type Social struct {
+	SelfVotePolicy         string        `yaml:"self_vote_policy" env:"SELF_VOTE_POLICY" env-default:"allow"`
+	RankingRefreshInterval time.Duration `yaml:"ranking_refresh_interval" env:"RANKING_REFRESH_INTERVAL" env-default:"5m"`
+}
+
+// Stream tunes the real-time event endpoints. HistorySize is how many recent
+// events are kept for clients resuming with Last-Event-ID. AllowedOrigins
+// lists the frontends that may open WebSockets; empty means same host only.
+type Stream struct {
+	MaxConnections    int           `yaml:"max_connections" env:"STREAM_MAX_CONNECTIONS" env-default:"1000"`
+	HistorySize       int           `yaml:"history_size" env:"STREAM_HISTORY_SIZE" env-default:"256"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" env:"STREAM_HEARTBEAT_INTERVAL" env-default:"25s"`
+	AllowedOrigins    []string      `yaml:"allowed_origins" env:"STREAM_ALLOWED_ORIGINS" env-separator:","`
+}
+
+// JWT configures asymmetric token signing. SigningKeyFile holds the active
+// RSA or Ed25519 private key in PEM; VerificationKeyFiles lists keys that are
+// still accepted, e.g. the previous signing key during a rotation. Without a
+// signing key, tokens are HS256 signed with JWTSecret.
+type JWT struct {
+	SigningKeyFile       string   `yaml:"signing_key_file" env:"JWT_SIGNING_KEY_FILE"`
+	VerificationKeyFiles []string `yaml:"verification_key_files" env:"JWT_VERIFICATION_KEY_FILES" env-separator:","`
+}
+
+// Session selects how clients carry their token: "bearer" (Authorization
+// header only), "cookie" (HttpOnly cookie plus CSRF token) or "both".
+// AllowedOrigins lists the frontends allowed to make credentialed
+// cross-origin requests when cookies are enabled; it defaults to the OAuth
+// callback URL.
+type Session struct {
+	Mode           string   `yaml:"mode" env:"SESSION_MODE" env-default:"bearer"`
+	CookieName     string   `yaml:"cookie_name" env:"SESSION_COOKIE_NAME" env-default:"bj_session"`
+	CSRFCookieName string   `yaml:"csrf_cookie_name" env:"SESSION_CSRF_COOKIE_NAME" env-default:"bj_csrf"`
+	CSRFHeaderName string   `yaml:"csrf_header_name" env:"SESSION_CSRF_HEADER_NAME" env-default:"X-CSRF-Token"`
+	CookieDomain   string   `yaml:"cookie_domain" env:"SESSION_COOKIE_DOMAIN"`
+	CookieSecure   bool     `yaml:"cookie_secure" env:"SESSION_COOKIE_SECURE" env-default:"true"`
+	SameSite       string   `yaml:"same_site" env:"SESSION_COOKIE_SAMESITE" env-default:"lax"`
+	AllowedOrigins []string `yaml:"allowed_origins" env:"SESSION_ALLOWED_ORIGINS" env-separator:","`
+}
+
+type TwoFactor struct {
+	Issuer          string        `yaml:"issuer" env:"TOTP_ISSUER" env-default:"Bad Jokes"`
+	PreAuthTokenTTL time.Duration `yaml:"pre_auth_token_ttl" env:"TOTP_PRE_AUTH_TTL" env-default:"5m"`
+	RequireForAdmin bool          `yaml:"require_for_admin" env:"TOTP_REQUIRE_FOR_ADMIN" env-default:"false"`
+	MaxAttempts     int           `yaml:"max_attempts" env:"TOTP_MAX_ATTEMPTS" env-default:"5"`
+	Lockout         time.Duration `yaml:"lockout" env:"TOTP_LOCKOUT" env-default:"15m"`
 }
 
 type OAuthConfig struct {
-	GoogleClientID     string `env:"GOOGLE_CLIENT_ID" required:"false"`
-	GoogleClientSecret string `env:"GOOGLE_CLIENT_SECRET" required:"false"`
-	GithubClientID     string `env:"GITHUB_CLIENT_ID" required:"false"`
-	GithubClientSecret string `env:"GITHUB_CLIENT_SECRET" required:"false"`
-	BaseURL            string `env:"BASE_OAUTH_URL" default:"http://localhost:9999"`
-	CallbackURL        string `env:"CALLBACK_OAUTH_URL" default:"http://localhost:5173"`
+	GoogleClientID     string                   `env:"GOOGLE_CLIENT_ID" required:"false"`
+	GoogleClientSecret string                   `env:"GOOGLE_CLIENT_SECRET" required:"false"`
+	GithubClientID     string                   `env:"GITHUB_CLIENT_ID" required:"false"`
+	GithubClientSecret string                   `env:"GITHUB_CLIENT_SECRET" required:"false"`
+	BaseURL            string                   `env:"BASE_OAUTH_URL" default:"http://localhost:9999"`
+	CallbackURL        string                   `env:"CALLBACK_OAUTH_URL" default:"http://localhost:5173"`
+	Providers          map[string]OAuthProvider `yaml:"providers"`
+}
+
+// OAuthProvider describes a login provider. Setting Issuer enables OIDC
+// discovery and ID token verification; plain OAuth2 providers need AuthURL,
+// TokenURL and UserInfoURL instead. Credentials left empty are read from
+// OAUTH_<NAME>_CLIENT_ID and OAUTH_<NAME>_CLIENT_SECRET. TrustEmail treats
+// every email the provider returns as verified, for providers that only hand
+// out addresses they own but do not send an email_verified claim.
+type OAuthProvider struct {
+	ClientID     string            `yaml:"client_id"`
+	ClientSecret string            `yaml:"client_secret"`
+	Issuer       string            `yaml:"issuer"`
+	AuthURL      string            `yaml:"auth_url"`
+	TokenURL     string            `yaml:"token_url"`
+	UserInfoURL  string            `yaml:"userinfo_url"`
+	EmailsURL    string            `yaml:"emails_url"`
+	Scopes       []string          `yaml:"scopes"`
+	Claims       OAuthClaimMapping `yaml:"claims"`
+	TrustEmail   bool              `yaml:"trust_email"`
+}
+
+type OAuthClaimMapping struct {
+	Subject  string `yaml:"subject"`
+	Email    string `yaml:"email"`
+	Username string `yaml:"username"`
 }
 
+// HTTPServer configures the listener. Timeout bounds both reading a request
+// and writing its response; event streams lift the write deadline themselves.
+// OAuth login and callback requests call out to the provider for discovery,
+// the token exchange and userinfo, so they get OAuthTimeout instead.
+// On SIGINT or SIGTERM the server stops accepting connections and gives
+// in-flight requests up to ShutdownTimeout to finish.
 type HTTPServer struct {
-	Address     string        `yaml:"address" env:"HTTP_SERVER_ADDRESS" env-default:"localhost:9999"`
-	Timeout     time.Duration `yaml:"timeout" env:"HTTP_SERVER_TIMEOUT" env-default:"4s"`
-	IdleTimeout time.Duration `yaml:"idle_timeout" env:"HTTP_SERVER_IDLE_TIMEOUT" env-default:"60s"`
+	Address           string        `yaml:"address" env:"HTTP_SERVER_ADDRESS" env-default:"localhost:9999"`
+	Timeout           time.Duration `yaml:"timeout" env:"HTTP_SERVER_TIMEOUT" env-default:"4s"`
+	OAuthTimeout      time.Duration `yaml:"oauth_timeout" env:"HTTP_SERVER_OAUTH_TIMEOUT" env-default:"20s"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_SERVER_IDLE_TIMEOUT" env-default:"60s"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_SERVER_READ_HEADER_TIMEOUT" env-default:"2s"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"HTTP_SERVER_MAX_HEADER_BYTES" env-default:"1048576"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"HTTP_SERVER_SHUTDOWN_TIMEOUT" env-default:"15s"`
 }
 
 type DatabaseConfig struct {
@@ -60,8 +163,8 @@ func MustLoad() *Config {
 		slog.Warn("error reading environment variables", "err", err)
 	}
 
-	if cfg.JWTSecret == "" {
-		slog.Error("JWT_SECRET is required but not set")
+	if cfg.JWTSecret == "" && cfg.JWT.SigningKeyFile == "" {
+		slog.Error("JWT_SIGNING_KEY_FILE or JWT_SECRET is required but not set")
 		os.Exit(1)
 	}
 	if cfg.Db.ConnectionString == "" || cfg.Db.Driver == "" {
@@ -73,5 +176,74 @@ func MustLoad() *Config {
 		os.Exit(1)
 	}
 
+	switch cfg.Session.Mode {
+	case "bearer", "cookie", "both":
+	default:
+		slog.Error("SESSION_MODE must be one of bearer, cookie or both", "mode", cfg.Session.Mode)
+		os.Exit(1)
+	}
+
+	if cfg.Session.Mode != "bearer" && len(cfg.Session.AllowedOrigins) == 0 {
+		if cfg.OAuth.CallbackURL == "" {
+			slog.Error("SESSION_ALLOWED_ORIGINS is required when session cookies are enabled")
+			os.Exit(1)
+		}
+		cfg.Session.AllowedOrigins = []string{strings.TrimSuffix(cfg.OAuth.CallbackURL, "/")}
+	}
+
+	switch cfg.Social.SelfVotePolicy {
+	case "allow", "deny":
+	default:
+		slog.Error("SELF_VOTE_POLICY must be allow or deny", "policy", cfg.Social.SelfVotePolicy)
+		os.Exit(1)
+	}
+
+	cfg.OAuth.resolveProviders()
+
 	return &cfg
 }
+
+func (c *OAuthConfig) resolveProviders() {
+	if c.Providers == nil {
+		c.Providers = map[string]OAuthProvider{}
+	}
+
+	if _, ok := c.Providers["google"]; !ok && c.GoogleClientID != "" {
+		c.Providers["google"] = OAuthProvider{
+			ClientID:     c.GoogleClientID,
+			ClientSecret: c.GoogleClientSecret,
+			Issuer:       "https://accounts.google.com",
+			Scopes:       []string{"openid", "profile", "email"},
+		}
+	}
+
+	if _, ok := c.Providers["github"]; !ok && c.GithubClientID != "" {
+		c.Providers["github"] = OAuthProvider{
+			ClientID:     c.GithubClientID,
+			ClientSecret: c.GithubClientSecret,
+			AuthURL:      "https://github.com/login/oauth/authorize",
+			TokenURL:     "https://github.com/login/oauth/access_token",
+			UserInfoURL:  "https://api.github.com/user",
+			EmailsURL:    "https://api.github.com/user/emails",
+			Scopes:       []string{"user:email"},
+			Claims:       OAuthClaimMapping{Subject: "id"},
+		}
+	}
+
+	for name, provider := range c.Providers {
+		envPrefix := "OAUTH_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if provider.ClientID == "" {
+			provider.ClientID = os.Getenv(envPrefix + "_CLIENT_ID")
+		}
+		if provider.ClientSecret == "" {
+			provider.ClientSecret = os.Getenv(envPrefix + "_CLIENT_SECRET")
+		}
+		if provider.Claims.Subject == "" {
+			provider.Claims.Subject = "sub"
+		}
+		if provider.Claims.Email == "" {
+			provider.Claims.Email = "email"
+		}
+		c.Providers[name] = provider
+	}
+}
@@ -0,0 +1,215 @@
+package events
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	TopicFeed = "feed"
+
+	TypeJokeCreated     = "joke_created"
+	TypeCommentCreated  = "comment_created"
+	TypeCommentDeleted  = "comment_deleted"
+	TypeVoteChanged     = "vote_changed"
+	TypeReactionChanged = "reaction_changed"
+	TypePresence        = "presence"
+	TypeTyping          = "typing"
+
+	// TypeReset tells a resuming client that events were lost and it should
+	// reload instead of applying deltas.
+	TypeReset = "reset"
+
+	subscriberBuffer = 64
+)
+
+var ErrTooManySubscribers = errors.New("too many subscribers")
+
+func JokeTopic(jokeID int64) string {
+	return "joke:" + strconv.FormatInt(jokeID, 10)
+}
+
+type Event struct {
+	ID        uint64      `json:"id,omitempty"`
+	Type      string      `json:"type"`
+	Topics    []string    `json:"-"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Subscription receives the events published to its topics. The channel is
+// closed when the subscriber is dropped for falling behind or the hub shuts
+// down; clients reconnect and resume from the last event id they saw.
+type Subscription struct {
+	topics map[string]bool
+	events chan Event
+	closed bool
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Hub is an in-process pub/sub bus. Every event gets a hub-wide increasing id
+// and is kept in a bounded history so reconnecting clients can catch up.
+type Hub struct {
+	mu             sync.Mutex
+	nextID         uint64
+	history        []Event
+	historySize    int
+	maxSubscribers int
+	subscribers    map[*Subscription]struct{}
+	closed         bool
+}
+
+func NewHub(historySize, maxSubscribers int) *Hub {
+	return &Hub{
+		historySize:    historySize,
+		maxSubscribers: maxSubscribers,
+		subscribers:    map[*Subscription]struct{}{},
+	}
+}
+
+func (h *Hub) Publish(eventType string, data interface{}, topics ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	h.nextID++
+	event := Event{
+		ID:        h.nextID,
+		Type:      eventType,
+		Topics:    topics,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+
+	if h.historySize > 0 {
+		if len(h.history) >= h.historySize {
+			h.history = h.history[1:]
+		}
+		h.history = append(h.history, event)
+	}
+
+	h.deliver(event)
+}
+
+// Signal delivers a transient event such as typing or presence to current
+// subscribers only. It carries no id and is never replayed on resume.
+func (h *Hub) Signal(eventType string, data interface{}, topics ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	h.deliver(Event{
+		Type:      eventType,
+		Topics:    topics,
+		Data:      data,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (h *Hub) deliver(event Event) {
+	for sub := range h.subscribers {
+		if !sub.matches(event) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			h.drop(sub)
+		}
+	}
+}
+
+// Subscribe registers a subscriber and returns the events after lastEventID it
+// missed. If that range is no longer in the history, or lastEventID is newer
+// than anything this hub has published, the backlog is a single reset event.
+func (h *Hub) Subscribe(topics []string, lastEventID uint64) (*Subscription, []Event, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed || (h.maxSubscribers > 0 && len(h.subscribers) >= h.maxSubscribers) {
+		return nil, nil, ErrTooManySubscribers
+	}
+
+	sub := &Subscription{
+		topics: make(map[string]bool, len(topics)),
+		events: make(chan Event, subscriberBuffer),
+	}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+
+	h.subscribers[sub] = struct{}{}
+
+	// An ID beyond nextID was issued by an earlier process, e.g. before a
+	// restart, so it says nothing about what this hub delivered.
+	var backlog []Event
+	switch {
+	case lastEventID == 0 || lastEventID == h.nextID:
+	case lastEventID > h.nextID, len(h.history) == 0, h.history[0].ID > lastEventID+1:
+		backlog = append(backlog, Event{ID: h.nextID, Type: TypeReset, CreatedAt: time.Now()})
+	default:
+		for _, event := range h.history {
+			if event.ID > lastEventID && sub.matches(event) {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+
+	return sub, backlog, nil
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.drop(sub)
+}
+
+func (h *Hub) SubscriberCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers)
+}
+
+// Close disconnects every subscriber and rejects new ones.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subscribers {
+		h.drop(sub)
+	}
+}
+
+func (h *Hub) drop(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+
+	sub.closed = true
+	close(sub.events)
+	delete(h.subscribers, sub)
+}
+
+func (s *Subscription) matches(event Event) bool {
+	for _, topic := range event.Topics {
+		if s.topics[topic] {
+			return true
+		}
+	}
+	return false
+}
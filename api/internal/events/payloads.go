@@ -0,0 +1,67 @@
+package events
+
+type JokeCreated struct {
+	ID       int64  `json:"id"`
+	AuthorID int64  `json:"author_id"`
+	Body     string `json:"body"`
+}
+
+type CommentDeleted struct {
+	ID     int64 `json:"id"`
+	JokeID int64 `json:"joke_id"`
+}
+
+// VoteChanged carries the change in totals caused by one user's vote so
+// clients can patch their counters without refetching.
+type VoteChanged struct {
+	EntityType string `json:"entity_type"`
+	EntityID   int64  `json:"entity_id"`
+	JokeID     int64  `json:"joke_id"`
+	Pluses     int    `json:"pluses"`
+	Minuses    int    `json:"minuses"`
+}
+
+type ReactionChanged struct {
+	EntityType   string `json:"entity_type"`
+	EntityID     int64  `json:"entity_id"`
+	JokeID       int64  `json:"joke_id"`
+	ReactionType string `json:"reaction_type"`
+	Delta        int    `json:"delta"`
+}
+
+type PresenceUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type Presence struct {
+	JokeID int64          `json:"joke_id"`
+	Users  []PresenceUser `json:"users"`
+}
+
+type Typing struct {
+	JokeID   int64  `json:"joke_id"`
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+}
+
+// VoteDelta returns the change in plus and minus totals when a user's vote
+// goes from previous to current; either may be empty for no vote.
+func VoteDelta(previous, current string) (pluses, minuses int) {
+	switch previous {
+	case "plus":
+		pluses--
+	case "minus":
+		minuses--
+	}
+
+	switch current {
+	case "plus":
+		pluses++
+	case "minus":
+		minuses++
+	}
+
+	return pluses, minuses
+}
@@ -0,0 +1,113 @@
+// Package apierror writes the JSON error body shared by every endpoint:
+//
+//	{"error": {"code": "not_found", "message": "Joke not found", "request_id": "..."}}
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RequestIDHeader carries the request ID set by the request ID middleware; it
+// is echoed into every error body so clients can quote it in bug reports.
+const RequestIDHeader = "X-Request-ID"
+
+// Machine-readable error codes. Clients should branch on these rather than on
+// the human-readable message.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "unavailable"
+)
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is the body of an error response.
+type Error struct {
+	Status    int          `json:"-"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New returns an error with the code that corresponds to status.
+func New(status int, message string) *Error {
+	return &Error{Status: status, Code: codeFor(status), Message: message}
+}
+
+// Validation returns a 400 listing the rejected fields. The message is taken
+// from the first field so clients that only show one line still get a useful
+// one.
+func Validation(fields ...FieldError) *Error {
+	message := "Validation failed"
+	if len(fields) > 0 {
+		message = fields[0].Message
+	}
+
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeValidation,
+		Message: message,
+		Fields:  fields,
+	}
+}
+
+// Write replies with status and message in the shared envelope.
+func Write(w http.ResponseWriter, status int, message string) {
+	WriteError(w, New(status, message))
+}
+
+// WriteError replies with err in the shared envelope.
+func WriteError(w http.ResponseWriter, err *Error) {
+	body := *err
+	if body.RequestID == "" {
+		body.RequestID = w.Header().Get(RequestIDHeader)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(body.Status)
+	json.NewEncoder(w).Encode(map[string]*Error{"error": &body})
+}
+
+func codeFor(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
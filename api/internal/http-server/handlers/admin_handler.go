@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"badJokes/internal/http-server/apierror"
 	"badJokes/internal/http-server/middleware"
 	"badJokes/internal/lib/sl"
 	"badJokes/internal/models"
@@ -54,7 +55,7 @@ func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	adminID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok {
 		h.log.Warn("Admin ID not found in context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -63,20 +64,20 @@ func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 		slog.Int("page_size", pageSize),
 		slog.Int64("admin_id", adminID))
 
-	users, err := h.userRepo.GetUsers(page, pageSize)
+	users, err := h.userRepo.GetUsers(r.Context(), page, pageSize)
 	if err != nil {
 		h.log.Error("Failed to fetch users",
 			sl.Err(err),
 			slog.Int("page", page),
 			slog.Int("page_size", pageSize))
-		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch users")
 		return
 	}
 
-	count, err := h.userRepo.GetUserCount()
+	count, err := h.userRepo.GetUserCount(r.Context())
 	if err != nil {
 		h.log.Error("Failed to get user count", sl.Err(err))
-		http.Error(w, "Failed to get user count", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to get user count")
 		return
 	}
 
@@ -108,26 +109,17 @@ func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 func (h *AdminHandler) DeleteJoke(w http.ResponseWriter, r *http.Request) {
 	h.log.Debug("Admin delete joke request received")
 
-	jokeIDStr, ok := r.Context().Value("jokeId").(string)
-	if !ok {
-		h.log.Warn("Invalid joke ID in context")
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
-		return
-	}
-
-	jokeID, err := strconv.ParseInt(jokeIDStr, 10, 64)
+	jokeID, err := pathID(r, "jokeID")
 	if err != nil {
-		h.log.Error("Failed to parse joke ID",
-			sl.Err(err),
-			slog.String("joke_id_str", jokeIDStr))
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
+		h.log.Warn("Invalid joke ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid joke ID")
 		return
 	}
 
 	adminID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok {
 		h.log.Warn("Admin ID not found in context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -135,11 +127,11 @@ func (h *AdminHandler) DeleteJoke(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("admin_id", adminID))
 
-	if err := h.jokeRepo.DeleteJoke(jokeID); err != nil {
+	if err := h.jokeRepo.DeleteJoke(r.Context(), jokeID); err != nil {
 		h.log.Error("Failed to delete joke",
 			sl.Err(err),
 			slog.Int64("joke_id", jokeID))
-		http.Error(w, "Failed to delete joke", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to delete joke")
 		return
 	}
 
@@ -153,26 +145,17 @@ func (h *AdminHandler) DeleteJoke(w http.ResponseWriter, r *http.Request) {
 func (h *AdminHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	h.log.Debug("Admin delete comment request received")
 
-	commentIDStr, ok := r.Context().Value("commentId").(string)
-	if !ok {
-		h.log.Warn("Invalid comment ID in context")
-		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
-		return
-	}
-
-	commentID, err := strconv.ParseInt(commentIDStr, 10, 64)
+	commentID, err := pathID(r, "commentID")
 	if err != nil {
-		h.log.Error("Failed to parse comment ID",
-			sl.Err(err),
-			slog.String("comment_id_str", commentIDStr))
-		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		h.log.Warn("Invalid comment ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid comment ID")
 		return
 	}
 
 	adminID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok {
 		h.log.Warn("Admin ID not found in context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -180,11 +163,11 @@ func (h *AdminHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("comment_id", commentID),
 		slog.Int64("admin_id", adminID))
 
-	if err := h.commentRepo.DeleteComment(commentID); err != nil {
+	if err := h.commentRepo.DeleteComment(r.Context(), commentID); err != nil {
 		h.log.Error("Failed to delete comment",
 			sl.Err(err),
 			slog.Int64("comment_id", commentID))
-		http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to delete comment")
 		return
 	}
 
@@ -205,21 +188,21 @@ func (h *AdminHandler) SetUserAdminStatus(w http.ResponseWriter, r *http.Request
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		h.log.Error("Failed to decode request", sl.Err(err))
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
 	adminID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok {
 		h.log.Warn("Admin ID not found in context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	if input.UserID == adminID {
 		h.log.Warn("Admin attempted to change own status",
 			slog.Int64("admin_id", adminID))
-		http.Error(w, "Cannot change your own admin status", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Cannot change your own admin status")
 		return
 	}
 
@@ -228,11 +211,11 @@ func (h *AdminHandler) SetUserAdminStatus(w http.ResponseWriter, r *http.Request
 		slog.Bool("new_status", input.IsAdmin),
 		slog.Int64("admin_id", adminID))
 
-	if err := h.userRepo.SetAdminStatus(input.UserID, input.IsAdmin); err != nil {
+	if err := h.userRepo.SetAdminStatus(r.Context(), input.UserID, input.IsAdmin); err != nil {
 		h.log.Error("Failed to update user admin status",
 			sl.Err(err),
 			slog.Int64("user_id", input.UserID))
-		http.Error(w, "Failed to update user status", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to update user status")
 		return
 	}
 
@@ -269,10 +252,10 @@ func (h *AdminHandler) GetModLogs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	logs, err := h.userRepo.GetModerationLogs(page, pageSize)
+	logs, err := h.userRepo.GetModerationLogs(r.Context(), page, pageSize)
 	if err != nil {
 		h.log.Error("Failed to fetch moderation logs", sl.Err(err))
-		http.Error(w, "Failed to fetch logs", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch logs")
 		return
 	}
 
@@ -288,10 +271,10 @@ func (h *AdminHandler) GetModLogs(w http.ResponseWriter, r *http.Request) {
 func (h *AdminHandler) GetUserStats(w http.ResponseWriter, r *http.Request) {
 	h.log.Debug("Admin get user stats request received")
 
-	stats, err := h.userRepo.GetUserStats()
+	stats, err := h.userRepo.GetUserStats(r.Context())
 	if err != nil {
 		h.log.Error("Failed to fetch user stats", sl.Err(err))
-		http.Error(w, "Failed to get statistics", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to get statistics")
 		return
 	}
 
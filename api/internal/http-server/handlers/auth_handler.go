@@ -2,7 +2,12 @@ package handlers
 
 import (
 	"badJokes/internal/config"
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/http-server/middleware"
+	"badJokes/internal/http-server/session"
+	"badJokes/internal/lib/jwtkeys"
 	"badJokes/internal/lib/sl"
+	"badJokes/internal/models"
 	"badJokes/internal/storage"
 	"encoding/json"
 	"errors"
@@ -11,22 +16,23 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
-	"time"
 	"unicode/utf8"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type AuthHandler struct {
 	repo      storage.UserRepository
-	jwtSecret []byte
+	keys      *jwtkeys.Keyring
+	twoFactor config.TwoFactor
+	sessions  *session.Manager
 	log       *slog.Logger
 }
 
-func NewAuthHandler(repo storage.UserRepository, cfg *config.Config, log *slog.Logger) *AuthHandler {
+func NewAuthHandler(repo storage.UserRepository, cfg *config.Config, keys *jwtkeys.Keyring, sessions *session.Manager, log *slog.Logger) *AuthHandler {
 	return &AuthHandler{
 		repo:      repo,
-		jwtSecret: []byte(cfg.JWTSecret),
+		keys:      keys,
+		twoFactor: cfg.TwoFactor,
+		sessions:  sessions,
 		log:       log.With(slog.String("component", "auth_handler")),
 	}
 }
@@ -42,7 +48,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		h.log.Error("Failed to decode registration request", sl.Err(err))
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
@@ -50,33 +56,39 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		slog.String("username", input.Username),
 		slog.String("email", input.Email))
 
+	var fields []apierror.FieldError
 	if err := validateUsername(input.Username); err != nil {
 		h.log.Info("Invalid username",
 			sl.Err(err),
 			slog.String("username", input.Username))
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		return
+		fields = append(fields, apierror.FieldError{Field: "username", Message: err.Error()})
 	}
 
 	if err := validatePassword(input.Password); err != nil {
 		h.log.Info("Invalid password", sl.Err(err))
+		fields = append(fields, apierror.FieldError{Field: "password", Message: err.Error()})
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	if len(fields) > 0 {
+		apierror.WriteError(w, apierror.Validation(fields...))
 		return
 	}
 
-	id, err := h.repo.Register(input.Username, input.Email, input.Password)
+	id, err := h.repo.Register(r.Context(), input.Username, input.Email, input.Password)
 	if err != nil {
-		h.log.Error("Failed to register user",
-			sl.Err(err),
-			slog.String("username", input.Username),
-			slog.String("email", input.Email))
-		http.Error(w, "Failed to register user", http.StatusInternalServerError)
+		apiErr := repositoryError(err, "User not found", "Failed to register user")
+		if apiErr.Status >= http.StatusInternalServerError {
+			h.log.Error("Failed to register user",
+				sl.Err(err),
+				slog.String("username", input.Username),
+				slog.String("email", input.Email))
+		} else {
+			h.log.Info("Registration rejected",
+				sl.Err(err),
+				slog.String("username", input.Username),
+				slog.String("email", input.Email))
+		}
+		apierror.WriteError(w, apiErr)
 		return
 	}
 
@@ -84,26 +96,22 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("user_id", id),
 		slog.String("username", input.Username))
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  id,
-		"username": input.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
+	user := &models.User{ID: id, Username: input.Username, Email: input.Email}
 
-	tokenString, err := token.SignedString(h.jwtSecret)
+	tokenString, err := generateAccessToken(h.keys, user, false)
 	if err != nil {
 		h.log.Error("Failed to generate token",
 			sl.Err(err),
 			slog.Int64("user_id", id))
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
 	h.log.Debug("JWT token generated successfully", slog.Int64("user_id", id))
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"token": tokenString})
+	if err := writeSession(w, h.sessions, tokenString, user, nil, http.StatusCreated); err != nil {
+		h.log.Error("Failed to write session", sl.Err(err), slog.Int64("user_id", id))
+	}
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -116,18 +124,18 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		h.log.Error("Failed to decode login request", sl.Err(err))
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
 	h.log.Debug("Attempting to authenticate user", slog.String("email", input.Email))
 
-	user, err := h.repo.Authenticate(input.Email, input.Password)
+	user, err := h.repo.Authenticate(r.Context(), input.Email, input.Password)
 	if err != nil {
 		h.log.Info("Authentication failed",
 			sl.Err(err),
 			slog.String("email", input.Email))
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 
@@ -135,26 +143,86 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("user_id", user.ID),
 		slog.String("username", user.Username))
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"is_admin": user.IsAdmin,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
+	if user.TOTPEnabled {
+		preAuthToken, err := generatePreAuthToken(h.keys, user.ID, h.twoFactor.PreAuthTokenTTL)
+		if err != nil {
+			h.log.Error("Failed to generate pre-auth token",
+				sl.Err(err),
+				slog.Int64("user_id", user.ID))
+			apierror.Write(w, http.StatusInternalServerError, "Failed to generate token")
+			return
+		}
+
+		h.log.Debug("Two-factor verification required", slog.Int64("user_id", user.ID))
 
-	tokenString, err := token.SignedString(h.jwtSecret)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"two_factor_required": true,
+			"pre_auth_token":      preAuthToken,
+		})
+		return
+	}
+
+	tokenString, err := generateAccessToken(h.keys, user, false)
 	if err != nil {
 		h.log.Error("Failed to generate token",
 			sl.Err(err),
 			slog.Int64("user_id", user.ID))
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
 	h.log.Debug("JWT token generated successfully", slog.Int64("user_id", user.ID))
 
+	response := map[string]interface{}{}
+	if user.IsAdmin && h.twoFactor.RequireForAdmin {
+		response["two_factor_setup_required"] = true
+	}
+
+	if err := writeSession(w, h.sessions, tokenString, user, response, http.StatusOK); err != nil {
+		h.log.Error("Failed to write session", sl.Err(err), slog.Int64("user_id", user.ID))
+	}
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Logout request received")
+
+	if h.sessions.CookiesEnabled() {
+		h.sessions.Clear(w)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Session returns the signed-in user. Cookie clients call it on start-up to
+// restore their state, since they cannot read the session cookie; it also
+// hands back the current CSRF token for them to echo.
+func (h *AuthHandler) Session(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		h.log.Error("Failed to fetch user", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to load session")
+		return
+	}
+
+	response := map[string]interface{}{"user": user}
+	if csrfToken, ok := h.sessions.CSRFToken(r); ok {
+		response["csrf_token"] = csrfToken
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": tokenString})
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
 }
 
 func validateUsername(username string) error {
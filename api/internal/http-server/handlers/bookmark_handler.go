@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/http-server/middleware"
+	"badJokes/internal/lib/sl"
+	"badJokes/internal/models"
+	"badJokes/internal/storage"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxCollectionLength = 50
+
+type BookmarkHandler struct {
+	jokeRepo storage.JokesRepository
+	log      *slog.Logger
+}
+
+func NewBookmarkHandler(jokeRepo storage.JokesRepository, log *slog.Logger) *BookmarkHandler {
+	return &BookmarkHandler{
+		jokeRepo: jokeRepo,
+		log:      log.With(slog.String("component", "bookmark_handler")),
+	}
+}
+
+// Bookmark saves a joke for the current user. The optional "collection" in
+// the body files it; bookmarking it again moves it to that collection.
+func (h *BookmarkHandler) Bookmark(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Bookmark request received")
+
+	jokeID, userID, ok := h.bookmarkTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Collection string `json:"collection"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		h.log.Warn("Failed to decode bookmark request body", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	collection := strings.TrimSpace(input.Collection)
+	if utf8.RuneCountInString(collection) > maxCollectionLength {
+		apierror.Write(w, http.StatusBadRequest, "Collection name is too long")
+		return
+	}
+
+	if _, err := h.jokeRepo.GetJokeByID(r.Context(), jokeID, userID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusNotFound, "Joke not found")
+			return
+		}
+		h.log.Error("Failed to fetch joke to bookmark",
+			sl.Err(err),
+			slog.Int64("joke_id", jokeID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to bookmark joke")
+		return
+	}
+
+	if err := h.jokeRepo.AddBookmark(r.Context(), userID, jokeID, collection); err != nil {
+		// The target can be deleted between the existence check and the insert.
+		if errors.Is(err, storage.ErrForeignKey) {
+			apierror.Write(w, http.StatusNotFound, "Joke not found")
+			return
+		}
+		h.log.Error("Failed to bookmark joke",
+			sl.Err(err),
+			slog.Int64("user_id", userID),
+			slog.Int64("joke_id", jokeID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to bookmark joke")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *BookmarkHandler) Unbookmark(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Unbookmark request received")
+
+	jokeID, userID, ok := h.bookmarkTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.jokeRepo.RemoveBookmark(r.Context(), userID, jokeID); err != nil {
+		h.log.Error("Failed to remove bookmark",
+			sl.Err(err),
+			slog.Int64("user_id", userID),
+			slog.Int64("joke_id", jokeID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to remove bookmark")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List returns the current user's bookmarked jokes with the usual sorting.
+// A "collection" query parameter, empty for unfiled bookmarks, narrows the
+// list to one collection.
+func (h *BookmarkHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("List bookmarks request received")
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized bookmarks request")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page, pageSize, sortField, order := parseJokeListParams(r, h.log)
+
+	var collection *string
+	if values, ok := r.URL.Query()["collection"]; ok {
+		name := strings.TrimSpace(values[0])
+		collection = &name
+	}
+
+	jokes, err := h.jokeRepo.ListBookmarks(r.Context(), userID, collection, page, pageSize, sortField, order)
+	if err != nil {
+		h.log.Error("Failed to fetch bookmarks",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch bookmarks")
+		return
+	}
+
+	if jokes == nil {
+		jokes = []models.Joke{}
+	}
+
+	h.log.Debug("Bookmarks fetched",
+		slog.Int64("user_id", userID),
+		slog.Int("count", len(jokes)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jokes":     jokes,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (h *BookmarkHandler) Collections(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("List bookmark collections request received")
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized bookmark collections request")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	collections, err := h.jokeRepo.ListBookmarkCollections(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to fetch bookmark collections",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch bookmark collections")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"collections": collections,
+	})
+}
+
+func (h *BookmarkHandler) bookmarkTarget(w http.ResponseWriter, r *http.Request) (jokeID, userID int64, ok bool) {
+	userID, ok = r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized bookmark request")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, 0, false
+	}
+
+	jokeID, err := pathID(r, "jokeID")
+	if err != nil {
+		h.log.Warn("Invalid joke ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid joke ID")
+		return 0, 0, false
+	}
+
+	return jokeID, userID, true
+}
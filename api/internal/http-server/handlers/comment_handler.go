@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"badJokes/internal/config"
+	"badJokes/internal/events"
+	"badJokes/internal/http-server/apierror"
 	"badJokes/internal/http-server/middleware"
+	"badJokes/internal/lib/commenttree"
 	"badJokes/internal/lib/sl"
+	"badJokes/internal/models"
 	"badJokes/internal/storage"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,14 +19,24 @@ import (
 )
 
 type CommentHandler struct {
-	commentRepo storage.CommentsRepository
-	log         *slog.Logger
+	commentRepo      storage.CommentsRepository
+	notificationRepo storage.NotificationRepository
+	hub              *events.Hub
+	maxCommentDepth  int
+	commentPageSize  int
+	log              *slog.Logger
 }
 
-func NewCommentHandler(repo storage.CommentsRepository, log *slog.Logger) *CommentHandler {
+func NewCommentHandler(repo storage.CommentsRepository, notificationRepo storage.NotificationRepository, hub *events.Hub, cfg *config.Config, log *slog.Logger) *CommentHandler {
+	maxDepth, pageSize := commentLimits(cfg)
+
 	return &CommentHandler{
-		commentRepo: repo,
-		log:         log.With(slog.String("component", "comment_handler")),
+		commentRepo:      repo,
+		notificationRepo: notificationRepo,
+		hub:              hub,
+		maxCommentDepth:  maxDepth,
+		commentPageSize:  pageSize,
+		log:              log.With(slog.String("component", "comment_handler")),
 	}
 }
 
@@ -34,19 +48,10 @@ func (h *CommentHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 		ParentID *int64 `json:"parent_id"`
 	}
 
-	jokeIDStr, ok := r.Context().Value("jokeId").(string)
-	if !ok {
-		h.log.Warn("Invalid joke ID in context")
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
-		return
-	}
-
-	jokeID, err := strconv.ParseInt(jokeIDStr, 10, 64)
+	jokeID, err := pathID(r, "jokeID")
 	if err != nil {
-		h.log.Error("Failed to parse joke ID",
-			sl.Err(err),
-			slog.String("joke_id_str", jokeIDStr))
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
+		h.log.Warn("Invalid joke ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid joke ID")
 		return
 	}
 
@@ -54,7 +59,7 @@ func (h *CommentHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		h.log.Warn("Unauthorized access attempt to add comment",
 			slog.Int64("joke_id", jokeID))
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -62,7 +67,7 @@ func (h *CommentHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 		h.log.Error("Failed to decode comment request body",
 			sl.Err(err),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
@@ -72,7 +77,7 @@ func (h *CommentHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 			slog.Int64("joke_id", jokeID),
 			slog.Int64("user_id", userID),
 			slog.String("body_length", strconv.Itoa(len(input.Body))))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.WriteError(w, apierror.Validation(apierror.FieldError{Field: "body", Message: err.Error()}))
 		return
 	}
 
@@ -82,13 +87,21 @@ func (h *CommentHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 		slog.String("body_length", strconv.Itoa(len(input.Body))),
 		slog.Any("parent_id", input.ParentID))
 
-	id, err := h.commentRepo.AddComment(jokeID, userID, input.Body, input.ParentID)
+	id, err := h.commentRepo.AddComment(r.Context(), jokeID, userID, input.Body, input.ParentID)
 	if err != nil {
-		h.log.Error("Failed to add comment",
-			sl.Err(err),
-			slog.Int64("joke_id", jokeID),
-			slog.Int64("user_id", userID))
-		http.Error(w, "Failed to add comment", http.StatusInternalServerError)
+		apiErr := repositoryError(err, "Joke not found", "Failed to add comment")
+		if apiErr.Status >= http.StatusInternalServerError {
+			h.log.Error("Failed to add comment",
+				sl.Err(err),
+				slog.Int64("joke_id", jokeID),
+				slog.Int64("user_id", userID))
+		} else {
+			h.log.Info("Comment target not found",
+				sl.Err(err),
+				slog.Int64("joke_id", jokeID),
+				slog.Any("parent_id", input.ParentID))
+		}
+		apierror.WriteError(w, apiErr)
 		return
 	}
 
@@ -97,6 +110,20 @@ func (h *CommentHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("user_id", userID))
 
+	if comment, err := h.commentRepo.GetCommentByID(r.Context(), id); err != nil {
+		h.log.Warn("Failed to load comment for event",
+			sl.Err(err),
+			slog.Int64("comment_id", id))
+	} else {
+		h.hub.Publish(events.TypeCommentCreated, comment, events.JokeTopic(jokeID), events.TopicFeed)
+	}
+
+	if input.ParentID != nil {
+		notify(r.Context(), h.notificationRepo, h.log, models.NotificationReply, "comment", *input.ParentID, userID)
+	} else {
+		notify(r.Context(), h.notificationRepo, h.log, models.NotificationComment, "joke", jokeID, userID)
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]int64{"id": id})
 }
@@ -154,19 +181,19 @@ func (h *CommentHandler) ListComments(w http.ResponseWriter, r *http.Request) {
 	if err != nil || jokeID < 1 {
 		h.log.Warn("Invalid joke ID in query",
 			slog.String("joke_id_str", jokeIDStr))
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid joke ID")
 		return
 	}
 
 	h.log.Debug("Fetching comments for joke",
 		slog.Int64("joke_id", jokeID))
 
-	comments, err := h.commentRepo.GetComments(jokeID)
+	comments, err := h.commentRepo.GetComments(r.Context(), jokeID)
 	if err != nil {
 		h.log.Error("Failed to fetch comments",
 			sl.Err(err),
 			slog.Int64("joke_id", jokeID))
-		http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch comments")
 		return
 	}
 
@@ -178,15 +205,22 @@ func (h *CommentHandler) ListComments(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(comments)
 }
 
-func (h *CommentHandler) GetCommentsByJokeID(w http.ResponseWriter, r *http.Request) {
-	h.log.Debug("Get comments by joke ID request received")
+// ListThread handles GET /api/jokes/{id}/comments, one page of top-level
+// comments with their replies.
+func (h *CommentHandler) ListThread(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("List comment thread request received")
 
-	jokeIDStr := r.URL.Query().Get("joke_id")
-	jokeID, err := strconv.ParseInt(jokeIDStr, 10, 64)
-	if err != nil || jokeID < 1 {
-		h.log.Warn("Invalid joke ID in query",
-			slog.String("joke_id_str", jokeIDStr))
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
+	jokeID, err := pathID(r, "jokeID")
+	if err != nil {
+		h.log.Warn("Invalid joke ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid joke ID")
+		return
+	}
+
+	page, err := parseCommentPage(r, h.maxCommentDepth, h.commentPageSize)
+	if err != nil {
+		h.log.Warn("Invalid comment page parameters", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -195,41 +229,119 @@ func (h *CommentHandler) GetCommentsByJokeID(w http.ResponseWriter, r *http.Requ
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("user_id", userID))
 
-	comments, err := h.commentRepo.GetCommentsByJokeID(jokeID, userID)
+	comments, err := h.commentRepo.GetTopLevelComments(r.Context(), jokeID, userID, page)
 	if err != nil {
 		h.log.Error("Failed to fetch comments by joke ID",
 			sl.Err(err),
 			slog.Int64("joke_id", jokeID),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch comments")
 		return
 	}
 
-	h.log.Info("Comments fetched successfully with user context",
+	h.log.Info("Comment page fetched successfully",
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("user_id", userID),
-		slog.Int("comment_count", len(comments)))
+		slog.Int("comment_count", len(comments.Comments)))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comments)
 }
 
-func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
-	h.log.Debug("Delete comment request received")
+// GetComment handles GET /api/comments/{id}, the permalink view of a comment
+// with its ancestors and a page of its replies.
+func (h *CommentHandler) GetComment(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Get comment request received")
 
-	commentIDStr, ok := r.Context().Value("commentId").(string)
-	if !ok {
-		h.log.Warn("Invalid comment ID in context")
-		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+	commentID, err := pathID(r, "commentID")
+	if err != nil {
+		h.log.Warn("Invalid comment ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid comment ID")
 		return
 	}
 
-	commentID, err := strconv.ParseInt(commentIDStr, 10, 64)
+	page, err := parseCommentPage(r, h.maxCommentDepth, h.commentPageSize)
 	if err != nil {
-		h.log.Error("Failed to parse comment ID",
-			sl.Err(err),
-			slog.String("comment_id_str", commentIDStr))
-		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		h.log.Warn("Invalid comment page parameters", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+
+	thread, err := h.commentRepo.GetCommentThread(r.Context(), commentID, userID, page)
+	if err != nil {
+		apiErr := repositoryError(err, "Comment not found", "Failed to fetch comment")
+		if apiErr.Status >= http.StatusInternalServerError {
+			h.log.Error("Failed to fetch comment thread",
+				sl.Err(err),
+				slog.Int64("comment_id", commentID))
+		} else {
+			h.log.Info("Comment not found", slog.Int64("comment_id", commentID))
+		}
+		apierror.WriteError(w, apiErr)
+		return
+	}
+
+	h.log.Info("Comment thread fetched successfully",
+		slog.Int64("comment_id", commentID),
+		slog.Int("ancestor_count", len(thread.Ancestors)),
+		slog.Int("reply_count", len(thread.Comment.Children)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
+// GetReplies handles GET /api/comments/{id}/replies, one page of a comment's
+// direct replies with their own replies.
+func (h *CommentHandler) GetReplies(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Get replies request received")
+
+	commentID, err := pathID(r, "commentID")
+	if err != nil {
+		h.log.Warn("Invalid comment ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid comment ID")
+		return
+	}
+
+	page, err := parseCommentPage(r, h.maxCommentDepth, h.commentPageSize)
+	if err != nil {
+		h.log.Warn("Invalid comment page parameters", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+
+	replies, err := h.commentRepo.GetReplies(r.Context(), commentID, userID, page)
+	if err != nil {
+		apiErr := repositoryError(err, "Comment not found", "Failed to fetch replies")
+		if apiErr.Status >= http.StatusInternalServerError {
+			h.log.Error("Failed to fetch replies",
+				sl.Err(err),
+				slog.Int64("comment_id", commentID))
+		} else {
+			h.log.Info("Comment not found", slog.Int64("comment_id", commentID))
+		}
+		apierror.WriteError(w, apiErr)
+		return
+	}
+
+	h.log.Info("Replies fetched successfully",
+		slog.Int64("comment_id", commentID),
+		slog.Int("reply_count", len(replies.Comments)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replies)
+}
+
+func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Delete comment request received")
+
+	commentID, err := pathID(r, "commentID")
+	if err != nil {
+		h.log.Warn("Invalid comment ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid comment ID")
 		return
 	}
 
@@ -237,7 +349,7 @@ func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		h.log.Warn("Unauthorized access attempt to delete comment",
 			slog.Int64("comment_id", commentID))
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -245,17 +357,17 @@ func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("comment_id", commentID),
 		slog.Int64("user_id", userID))
 
-	comment, err := h.commentRepo.GetCommentByID(commentID)
+	comment, err := h.commentRepo.GetCommentByID(r.Context(), commentID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, storage.ErrNotFound) {
 			h.log.Info("Comment not found",
 				slog.Int64("comment_id", commentID))
-			http.Error(w, "Comment not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, "Comment not found")
 		} else {
 			h.log.Error("Failed to fetch comment",
 				sl.Err(err),
 				slog.Int64("comment_id", commentID))
-			http.Error(w, "Failed to fetch comment", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, "Failed to fetch comment")
 		}
 		return
 	}
@@ -265,7 +377,7 @@ func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 			slog.Int64("comment_id", commentID),
 			slog.Int64("requesting_user_id", userID),
 			slog.Int64("comment_author_id", comment.AuthorID))
-		http.Error(w, "Forbidden: You can only delete your own comments", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, "Forbidden: You can only delete your own comments")
 		return
 	}
 
@@ -273,11 +385,14 @@ func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("comment_id", commentID),
 		slog.Int64("user_id", userID))
 
-	if err := h.commentRepo.DeleteComment(commentID); err != nil {
-		h.log.Error("Failed to delete comment",
-			sl.Err(err),
-			slog.Int64("comment_id", commentID))
-		http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+	if err := h.commentRepo.DeleteComment(r.Context(), commentID); err != nil {
+		apiErr := repositoryError(err, "Comment not found", "Failed to delete comment")
+		if apiErr.Status >= http.StatusInternalServerError {
+			h.log.Error("Failed to delete comment",
+				sl.Err(err),
+				slog.Int64("comment_id", commentID))
+		}
+		apierror.WriteError(w, apiErr)
 		return
 	}
 
@@ -285,5 +400,78 @@ func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("comment_id", commentID),
 		slog.Int64("user_id", userID))
 
+	h.hub.Publish(events.TypeCommentDeleted, events.CommentDeleted{
+		ID:     commentID,
+		JokeID: comment.JokeID,
+	}, events.JokeTopic(comment.JokeID), events.TopicFeed)
+
 	w.WriteHeader(http.StatusNoContent)
 }
+
+const (
+	defaultCommentMaxDepth = 8
+	defaultCommentPageSize = 20
+	maxCommentPageSize     = 100
+)
+
+// commentLimits returns the configured thread depth and page size, falling
+// back to the defaults when they are out of range.
+func commentLimits(cfg *config.Config) (maxDepth, pageSize int) {
+	maxDepth = cfg.Comments.MaxDepth
+	if maxDepth < 0 {
+		maxDepth = defaultCommentMaxDepth
+	}
+
+	pageSize = cfg.Comments.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultCommentPageSize
+	}
+
+	return maxDepth, pageSize
+}
+
+// parseCommentPage reads the optional comment_sort, max_depth, limit and
+// cursor query parameters. max_depth and limit can only lower the configured
+// values.
+func parseCommentPage(r *http.Request, maxDepth, pageSize int) (commenttree.Page, error) {
+	query := r.URL.Query()
+	page := commenttree.Page{
+		Sort:     query.Get("comment_sort"),
+		MaxDepth: maxDepth,
+		Limit:    pageSize,
+	}
+
+	if page.Sort == "" {
+		page.Sort = commenttree.SortOld
+	}
+	if !commenttree.ValidSort(page.Sort) {
+		return page, fmt.Errorf("comment_sort must be best, new or old")
+	}
+
+	if raw := query.Get("max_depth"); raw != "" {
+		depth, err := strconv.Atoi(raw)
+		if err != nil || depth < 0 {
+			return page, fmt.Errorf("max_depth must be a non-negative integer")
+		}
+		page.MaxDepth = min(depth, maxDepth)
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return page, fmt.Errorf("limit must be a positive integer")
+		}
+		page.Limit = min(limit, pageSize)
+	}
+	page.Limit = min(page.Limit, maxCommentPageSize)
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := commenttree.DecodeCursor(page.Sort, raw)
+		if err != nil {
+			return page, err
+		}
+		page.After = cursor
+	}
+
+	return page, nil
+}
@@ -1,26 +1,42 @@
 package handlers
 
 import (
+	"badJokes/internal/config"
+	"badJokes/internal/events"
+	"badJokes/internal/http-server/apierror"
 	"badJokes/internal/http-server/middleware"
 	"badJokes/internal/lib/sl"
+	"badJokes/internal/models"
 	"badJokes/internal/storage"
+	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 )
 
 type EntityHandler struct {
-	entityRepo storage.EntityRepository
-	log        *slog.Logger
+	entityRepo       storage.EntityRepository
+	reactionRepo     storage.ReactionRepository
+	notificationRepo storage.NotificationRepository
+	hub              *events.Hub
+	denySelfVotes    bool
+	log              *slog.Logger
 }
 
-func NewEntityHandler(repo storage.EntityRepository, log *slog.Logger) *EntityHandler {
+func NewEntityHandler(repo storage.EntityRepository, reactionRepo storage.ReactionRepository, notificationRepo storage.NotificationRepository, hub *events.Hub, cfg *config.Config, log *slog.Logger) *EntityHandler {
 	return &EntityHandler{
-		entityRepo: repo,
-		log:        log.With(slog.String("component", "entity_handler")),
+		entityRepo:       repo,
+		reactionRepo:     reactionRepo,
+		notificationRepo: notificationRepo,
+		hub:              hub,
+		denySelfVotes:    cfg.Social.SelfVotePolicy == "deny",
+		log:              log.With(slog.String("component", "entity_handler")),
 	}
 }
 
+// Vote sets or, with an empty vote_type, clears the caller's vote from a JSON
+// body and responds with the entity's updated social state.
 func (h *EntityHandler) Vote(w http.ResponseWriter, r *http.Request) {
 	h.log.Debug("Vote request received")
 
@@ -33,7 +49,7 @@ func (h *EntityHandler) Vote(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok {
 		h.log.Warn("Unauthorized voting attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -41,81 +57,193 @@ func (h *EntityHandler) Vote(w http.ResponseWriter, r *http.Request) {
 		h.log.Error("Failed to decode vote request body",
 			sl.Err(err),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
+	h.applyVote(r.Context(), w, userID, input.EntityType, input.EntityID, input.VoteType)
+}
+
+// SetVote handles PUT /api/votes/{entity_type}/{entity_id}. Repeating the
+// same vote leaves it unchanged.
+func (h *EntityHandler) SetVote(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized voting attempt")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	entityType, entityID, ok := h.socialTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		VoteType string `json:"vote_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.log.Error("Failed to decode vote request body",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	if input.VoteType == "" {
+		apierror.Write(w, http.StatusBadRequest, "Invalid vote type")
+		return
+	}
+
+	h.applyVote(r.Context(), w, userID, entityType, entityID, input.VoteType)
+}
+
+// ClearVote handles DELETE /api/votes/{entity_type}/{entity_id}. Clearing a
+// vote that does not exist is not an error.
+func (h *EntityHandler) ClearVote(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized voting attempt")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	entityType, entityID, ok := h.socialTarget(w, r)
+	if !ok {
+		return
+	}
+
+	h.applyVote(r.Context(), w, userID, entityType, entityID, "")
+}
+
+func (h *EntityHandler) applyVote(ctx context.Context, w http.ResponseWriter, userID int64, entityType string, entityID int64, voteType string) {
 	h.log.Debug("Processing vote request",
-		slog.String("entity_type", input.EntityType),
-		slog.Int64("entity_id", input.EntityID),
-		slog.String("vote_type", input.VoteType),
+		slog.String("entity_type", entityType),
+		slog.Int64("entity_id", entityID),
+		slog.String("vote_type", voteType),
 		slog.Int64("user_id", userID))
 
-	if input.EntityType != "joke" && input.EntityType != "comment" {
+	if entityType != "joke" && entityType != "comment" {
 		h.log.Warn("Invalid entity type in vote request",
-			slog.String("entity_type", input.EntityType),
+			slog.String("entity_type", entityType),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Invalid entity type", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid entity type")
 		return
 	}
 
-	if input.VoteType != "" && input.VoteType != "plus" && input.VoteType != "minus" {
+	if voteType != "" && voteType != "plus" && voteType != "minus" {
 		h.log.Warn("Invalid vote type in request",
-			slog.String("vote_type", input.VoteType),
+			slog.String("vote_type", voteType),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Invalid vote type", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid vote type")
 		return
 	}
 
-	if input.VoteType == "" {
+	previousVote, err := h.entityRepo.GetVote(ctx, entityType, entityID, userID)
+	if err != nil {
+		h.log.Error("Failed to check existing vote",
+			sl.Err(err),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to process vote")
+		return
+	}
+
+	if voteType == "" {
 		h.log.Debug("Removing vote",
-			slog.String("entity_type", input.EntityType),
-			slog.Int64("entity_id", input.EntityID),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID),
 			slog.Int64("user_id", userID))
 
-		if err := h.entityRepo.RemoveVote(input.EntityType, input.EntityID, userID); err != nil {
+		if err := h.entityRepo.RemoveVote(ctx, entityType, entityID, userID); err != nil {
 			h.log.Error("Failed to remove vote",
 				sl.Err(err),
-				slog.String("entity_type", input.EntityType),
-				slog.Int64("entity_id", input.EntityID),
+				slog.String("entity_type", entityType),
+				slog.Int64("entity_id", entityID),
 				slog.Int64("user_id", userID))
-			http.Error(w, "Failed to remove vote", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, "Failed to remove vote")
 			return
 		}
 
 		h.log.Info("Vote removed successfully",
-			slog.String("entity_type", input.EntityType),
-			slog.Int64("entity_id", input.EntityID),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID),
+			slog.Int64("user_id", userID))
+
+		h.publishVote(ctx, entityType, entityID, previousVote, "")
+		h.writeSocial(ctx, w, entityType, entityID, userID)
+		return
+	}
+
+	authorID, err := h.entityRepo.GetAuthorID(ctx, entityType, entityID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.log.Info("Vote on missing entity",
+				slog.String("entity_type", entityType),
+				slog.Int64("entity_id", entityID),
+				slog.Int64("user_id", userID))
+			apierror.Write(w, http.StatusNotFound, entityNotFoundMessage(entityType))
+			return
+		}
+		h.log.Error("Failed to look up entity author",
+			sl.Err(err),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to process vote")
+		return
+	}
+
+	if h.denySelfVotes && authorID == userID {
+		h.log.Info("Rejected self-vote",
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID),
 			slog.Int64("user_id", userID))
-		w.WriteHeader(http.StatusNoContent)
+		apierror.Write(w, http.StatusForbidden, "You cannot vote on your own content")
+		return
+	}
+
+	if previousVote == voteType {
+		h.writeSocial(ctx, w, entityType, entityID, userID)
 		return
 	}
 
 	h.log.Debug("Adding vote",
-		slog.String("entity_type", input.EntityType),
-		slog.Int64("entity_id", input.EntityID),
-		slog.String("vote_type", input.VoteType),
+		slog.String("entity_type", entityType),
+		slog.Int64("entity_id", entityID),
+		slog.String("vote_type", voteType),
 		slog.Int64("user_id", userID))
 
-	if err := h.entityRepo.AddVote(input.EntityType, input.EntityID, userID, input.VoteType); err != nil {
+	if err := h.entityRepo.AddVote(ctx, entityType, entityID, userID, voteType); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusNotFound, entityNotFoundMessage(entityType))
+			return
+		}
 		h.log.Error("Failed to add vote",
 			sl.Err(err),
-			slog.String("entity_type", input.EntityType),
-			slog.Int64("entity_id", input.EntityID),
-			slog.String("vote_type", input.VoteType),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID),
+			slog.String("vote_type", voteType),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Failed to process vote", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to process vote")
 		return
 	}
 
 	h.log.Info("Vote added successfully",
-		slog.String("entity_type", input.EntityType),
-		slog.Int64("entity_id", input.EntityID),
-		slog.String("vote_type", input.VoteType),
+		slog.String("entity_type", entityType),
+		slog.Int64("entity_id", entityID),
+		slog.String("vote_type", voteType),
 		slog.Int64("user_id", userID))
-	w.WriteHeader(http.StatusNoContent)
+
+	h.publishVote(ctx, entityType, entityID, previousVote, voteType)
+	notify(ctx, h.notificationRepo, h.log, models.NotificationVote, entityType, entityID, userID)
+
+	h.writeSocial(ctx, w, entityType, entityID, userID)
 }
 
+// HandleReaction toggles the caller's reaction from a JSON body and responds
+// with the entity's updated social state. AddReaction and RemoveReaction are
+// the idempotent alternatives.
 func (h *EntityHandler) HandleReaction(w http.ResponseWriter, r *http.Request) {
 	h.log.Debug("Reaction request received")
 
@@ -128,7 +256,7 @@ func (h *EntityHandler) HandleReaction(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok {
 		h.log.Warn("Unauthorized reaction attempt")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -136,97 +264,271 @@ func (h *EntityHandler) HandleReaction(w http.ResponseWriter, r *http.Request) {
 		h.log.Error("Failed to decode reaction request body",
 			sl.Err(err),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	h.applyReaction(r.Context(), w, userID, input.EntityType, input.EntityID, input.ReactionType, reactionToggle)
+}
+
+// AddReaction handles PUT /api/reactions/{entity_type}/{entity_id}/{reaction_type}.
+func (h *EntityHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	h.setReaction(w, r, reactionAdd)
+}
+
+// RemoveReaction handles DELETE /api/reactions/{entity_type}/{entity_id}/{reaction_type}.
+func (h *EntityHandler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	h.setReaction(w, r, reactionRemove)
+}
+
+func (h *EntityHandler) setReaction(w http.ResponseWriter, r *http.Request, mode reactionMode) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized reaction attempt")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
+	entityType, entityID, ok := h.socialTarget(w, r)
+	if !ok {
+		return
+	}
+
+	reactionType := pathParam(r, "reactionType")
+	h.applyReaction(r.Context(), w, userID, entityType, entityID, reactionType, mode)
+}
+
+// reactionMode says whether applyReaction adds or removes the caller's
+// reaction, or flips whichever state it is in.
+type reactionMode int
+
+const (
+	reactionToggle reactionMode = iota
+	reactionAdd
+	reactionRemove
+)
+
+func (m reactionMode) String() string {
+	switch m {
+	case reactionAdd:
+		return "add"
+	case reactionRemove:
+		return "remove"
+	default:
+		return "toggle"
+	}
+}
+
+// applyReaction makes the caller's reaction present or absent. Asking for the
+// state it is already in changes nothing.
+func (h *EntityHandler) applyReaction(ctx context.Context, w http.ResponseWriter, userID int64, entityType string, entityID int64, reactionType string, mode reactionMode) {
 	h.log.Debug("Processing reaction request",
-		slog.String("entity_type", input.EntityType),
-		slog.Int64("entity_id", input.EntityID),
-		slog.String("reaction_type", input.ReactionType),
+		slog.String("entity_type", entityType),
+		slog.Int64("entity_id", entityID),
+		slog.String("reaction_type", reactionType),
+		slog.String("mode", mode.String()),
 		slog.Int64("user_id", userID))
 
-	validReactions := map[string]bool{
-		"laugh":       true,
-		"heart":       true,
-		"neutral":     true,
-		"surprised":   true,
-		"fire":        true,
-		"poop":        true,
-		"thumbs_up":   true,
-		"thumbs_down": true,
-		"angry":       true,
-		"monkey":      true,
+	if entityType != "joke" && entityType != "comment" {
+		h.log.Warn("Invalid entity type in reaction request",
+			slog.String("entity_type", entityType),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusBadRequest, "Invalid entity type")
+		return
 	}
 
-	if !validReactions[input.ReactionType] {
+	catalogEntry, err := h.reactionRepo.Get(ctx, reactionType)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		h.log.Error("Failed to look up reaction in catalog",
+			sl.Err(err),
+			slog.String("reaction_type", reactionType))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to process reaction")
+		return
+	}
+
+	if catalogEntry == nil {
 		h.log.Warn("Invalid reaction type in request",
-			slog.String("reaction_type", input.ReactionType),
+			slog.String("reaction_type", reactionType),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Invalid reaction type", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid reaction type")
 		return
 	}
 
-	existingReaction, err := h.entityRepo.GetReaction(input.EntityType, input.EntityID, userID, input.ReactionType)
+	existingReaction, err := h.entityRepo.GetReaction(ctx, entityType, entityID, userID, reactionType)
 	if err != nil {
 		h.log.Error("Failed to check existing reaction",
 			sl.Err(err),
-			slog.String("entity_type", input.EntityType),
-			slog.Int64("entity_id", input.EntityID),
-			slog.String("reaction_type", input.ReactionType),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID),
+			slog.String("reaction_type", reactionType),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Failed to check reaction", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to check reaction")
+		return
+	}
+
+	add := mode == reactionAdd
+	if mode == reactionToggle {
+		add = !existingReaction
+	}
+
+	if existingReaction == add {
+		h.writeSocial(ctx, w, entityType, entityID, userID)
 		return
 	}
 
-	if existingReaction {
+	if !add {
 		h.log.Debug("Removing existing reaction",
-			slog.String("entity_type", input.EntityType),
-			slog.Int64("entity_id", input.EntityID),
-			slog.String("reaction_type", input.ReactionType),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID),
+			slog.String("reaction_type", reactionType),
 			slog.Int64("user_id", userID))
 
-		if err := h.entityRepo.RemoveReaction(input.EntityType, input.EntityID, userID, input.ReactionType); err != nil {
+		if err := h.entityRepo.RemoveReaction(ctx, entityType, entityID, userID, reactionType); err != nil {
 			h.log.Error("Failed to remove reaction",
 				sl.Err(err),
-				slog.String("entity_type", input.EntityType),
-				slog.Int64("entity_id", input.EntityID),
-				slog.String("reaction_type", input.ReactionType),
+				slog.String("entity_type", entityType),
+				slog.Int64("entity_id", entityID),
+				slog.String("reaction_type", reactionType),
 				slog.Int64("user_id", userID))
-			http.Error(w, "Failed to remove reaction", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, "Failed to remove reaction")
 			return
 		}
 
 		h.log.Info("Reaction removed successfully",
-			slog.String("entity_type", input.EntityType),
-			slog.Int64("entity_id", input.EntityID),
-			slog.String("reaction_type", input.ReactionType),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID),
+			slog.String("reaction_type", reactionType),
 			slog.Int64("user_id", userID))
-		w.WriteHeader(http.StatusNoContent)
+
+		h.publishReaction(ctx, entityType, entityID, reactionType, -1)
+		h.writeSocial(ctx, w, entityType, entityID, userID)
+		return
+	}
+
+	if !catalogEntry.Enabled {
+		h.log.Info("Rejected retired reaction",
+			slog.String("reaction_type", reactionType),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusBadRequest, "Reaction is no longer available")
 		return
 	}
 
 	h.log.Debug("Adding new reaction",
-		slog.String("entity_type", input.EntityType),
-		slog.Int64("entity_id", input.EntityID),
-		slog.String("reaction_type", input.ReactionType),
+		slog.String("entity_type", entityType),
+		slog.Int64("entity_id", entityID),
+		slog.String("reaction_type", reactionType),
 		slog.Int64("user_id", userID))
 
-	if err := h.entityRepo.AddReaction(input.EntityType, input.EntityID, userID, input.ReactionType); err != nil {
+	if err := h.entityRepo.AddReaction(ctx, entityType, entityID, userID, reactionType); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.log.Info("Reaction on missing entity",
+				slog.String("entity_type", entityType),
+				slog.Int64("entity_id", entityID),
+				slog.Int64("user_id", userID))
+			apierror.Write(w, http.StatusNotFound, entityNotFoundMessage(entityType))
+			return
+		}
 		h.log.Error("Failed to add reaction",
 			sl.Err(err),
-			slog.String("entity_type", input.EntityType),
-			slog.Int64("entity_id", input.EntityID),
-			slog.String("reaction_type", input.ReactionType),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID),
+			slog.String("reaction_type", reactionType),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Failed to add reaction", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to add reaction")
 		return
 	}
 
 	h.log.Info("Reaction added successfully",
-		slog.String("entity_type", input.EntityType),
-		slog.Int64("entity_id", input.EntityID),
-		slog.String("reaction_type", input.ReactionType),
+		slog.String("entity_type", entityType),
+		slog.Int64("entity_id", entityID),
+		slog.String("reaction_type", reactionType),
 		slog.Int64("user_id", userID))
-	w.WriteHeader(http.StatusNoContent)
+
+	h.publishReaction(ctx, entityType, entityID, reactionType, 1)
+	notify(ctx, h.notificationRepo, h.log, models.NotificationReaction, entityType, entityID, userID)
+
+	h.writeSocial(ctx, w, entityType, entityID, userID)
+}
+
+// socialTarget reads the entity type and id from the route.
+func (h *EntityHandler) socialTarget(w http.ResponseWriter, r *http.Request) (string, int64, bool) {
+	entityType := pathParam(r, "entityType")
+
+	entityID, err := pathID(r, "entityID")
+	if err != nil {
+		h.log.Warn("Invalid entity ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid entity ID")
+		return "", 0, false
+	}
+
+	return entityType, entityID, true
+}
+
+func (h *EntityHandler) writeSocial(ctx context.Context, w http.ResponseWriter, entityType string, entityID, userID int64) {
+	social, err := h.entityRepo.GetSocial(ctx, entityType, entityID, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusNotFound, entityNotFoundMessage(entityType))
+			return
+		}
+		h.log.Error("Failed to load social state",
+			sl.Err(err),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to load social state")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(social)
+}
+
+func entityNotFoundMessage(entityType string) string {
+	if entityType == "comment" {
+		return "Comment not found"
+	}
+	return "Joke not found"
+}
+
+func (h *EntityHandler) publishVote(ctx context.Context, entityType string, entityID int64, previous, current string) {
+	pluses, minuses := events.VoteDelta(previous, current)
+	if pluses == 0 && minuses == 0 {
+		return
+	}
+
+	jokeID, err := h.entityRepo.GetJokeID(ctx, entityType, entityID)
+	if err != nil {
+		h.log.Warn("Failed to resolve joke for vote event",
+			sl.Err(err),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID))
+		return
+	}
+
+	h.hub.Publish(events.TypeVoteChanged, events.VoteChanged{
+		EntityType: entityType,
+		EntityID:   entityID,
+		JokeID:     jokeID,
+		Pluses:     pluses,
+		Minuses:    minuses,
+	}, events.JokeTopic(jokeID), events.TopicFeed)
+}
+
+func (h *EntityHandler) publishReaction(ctx context.Context, entityType string, entityID int64, reactionType string, delta int) {
+	jokeID, err := h.entityRepo.GetJokeID(ctx, entityType, entityID)
+	if err != nil {
+		h.log.Warn("Failed to resolve joke for reaction event",
+			sl.Err(err),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID))
+		return
+	}
+
+	h.hub.Publish(events.TypeReactionChanged, events.ReactionChanged{
+		EntityType:   entityType,
+		EntityID:     entityID,
+		JokeID:       jokeID,
+		ReactionType: reactionType,
+		Delta:        delta,
+	}, events.JokeTopic(jokeID), events.TopicFeed)
 }
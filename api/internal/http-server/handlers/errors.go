@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/lib/commenttree"
+	"badJokes/internal/storage"
+	"errors"
+	"net/http"
+)
+
+// repositoryError maps the sentinel errors returned by repositories to the
+// client error they stand for. notFound is used for storage.ErrNotFound
+// without a more specific sentinel; anything unrecognised becomes a 500 with
+// fallback as its message, and callers are expected to log it.
+func repositoryError(err error, notFound, fallback string) *apierror.Error {
+	var conflict *storage.ConflictError
+	switch {
+	case errors.Is(err, storage.ErrJokeNotFound):
+		return apierror.New(http.StatusNotFound, "Joke not found")
+	case errors.Is(err, storage.ErrCommentNotFound):
+		return apierror.New(http.StatusNotFound, "Comment not found")
+	case errors.Is(err, storage.ErrNotFound):
+		return apierror.New(http.StatusNotFound, notFound)
+	case errors.As(err, &conflict) && conflict.Field != "":
+		apiErr := apierror.New(http.StatusConflict, conflict.Field+" is already taken")
+		apiErr.Fields = []apierror.FieldError{{Field: conflict.Field, Message: "already taken"}}
+		return apiErr
+	case errors.Is(err, storage.ErrConflict):
+		return apierror.New(http.StatusConflict, "Already exists")
+	case errors.Is(err, storage.ErrForeignKey):
+		return apierror.New(http.StatusConflict, "Referenced record does not exist")
+	case errors.Is(err, commenttree.ErrInvalidCursor):
+		return apierror.New(http.StatusBadRequest, "Invalid cursor")
+	default:
+		return apierror.New(http.StatusInternalServerError, fallback)
+	}
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"badJokes/internal/config"
+	"badJokes/internal/events"
+	"badJokes/internal/http-server/apierror"
 	"badJokes/internal/http-server/middleware"
 	"badJokes/internal/lib/sl"
 	"badJokes/internal/models"
 	"badJokes/internal/storage"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,16 +18,24 @@ import (
 )
 
 type JokesHandler struct {
-	jokeRepo    storage.JokesRepository
-	commentRepo storage.CommentsRepository
-	log         *slog.Logger
+	jokeRepo        storage.JokesRepository
+	commentRepo     storage.CommentsRepository
+	hub             *events.Hub
+	maxCommentDepth int
+	commentPageSize int
+	log             *slog.Logger
 }
 
-func NewJokesHandler(jokeRepo storage.JokesRepository, commentRepo storage.CommentsRepository, log *slog.Logger) *JokesHandler {
+func NewJokesHandler(jokeRepo storage.JokesRepository, commentRepo storage.CommentsRepository, hub *events.Hub, cfg *config.Config, log *slog.Logger) *JokesHandler {
+	maxDepth, pageSize := commentLimits(cfg)
+
 	return &JokesHandler{
-		jokeRepo:    jokeRepo,
-		commentRepo: commentRepo,
-		log:         log.With(slog.String("component", "jokes_handler")),
+		jokeRepo:        jokeRepo,
+		commentRepo:     commentRepo,
+		hub:             hub,
+		maxCommentDepth: maxDepth,
+		commentPageSize: pageSize,
+		log:             log.With(slog.String("component", "jokes_handler")),
 	}
 }
 
@@ -39,7 +49,7 @@ func (h *JokesHandler) Create(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
 	if !ok {
 		h.log.Warn("Unauthorized attempt to create joke")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -47,7 +57,7 @@ func (h *JokesHandler) Create(w http.ResponseWriter, r *http.Request) {
 		h.log.Error("Failed to decode joke creation request body",
 			sl.Err(err),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
 		return
 	}
 
@@ -56,7 +66,7 @@ func (h *JokesHandler) Create(w http.ResponseWriter, r *http.Request) {
 			sl.Err(err),
 			slog.Int64("user_id", userID),
 			slog.String("body_length", strconv.Itoa(len(input.Body))))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.WriteError(w, apierror.Validation(apierror.FieldError{Field: "body", Message: err.Error()}))
 		return
 	}
 
@@ -64,12 +74,12 @@ func (h *JokesHandler) Create(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("user_id", userID),
 		slog.String("body_length", strconv.Itoa(len(input.Body))))
 
-	id, err := h.jokeRepo.Insert(input.Body, userID)
+	id, err := h.jokeRepo.Insert(r.Context(), input.Body, userID)
 	if err != nil {
 		h.log.Error("Failed to insert joke",
 			sl.Err(err),
 			slog.Int64("user_id", userID))
-		http.Error(w, "Failed to create joke", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to create joke")
 		return
 	}
 
@@ -77,6 +87,12 @@ func (h *JokesHandler) Create(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("joke_id", id),
 		slog.Int64("user_id", userID))
 
+	h.hub.Publish(events.TypeJokeCreated, events.JokeCreated{
+		ID:       id,
+		AuthorID: userID,
+		Body:     input.Body,
+	}, events.TopicFeed)
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]int64{"id": id})
 }
@@ -124,29 +140,62 @@ func validateJokeContent(content string) error {
 func (h *JokesHandler) List(w http.ResponseWriter, r *http.Request) {
 	h.log.Debug("List jokes request received")
 
+	page, pageSize, sortField, order := parseJokeListParams(r, h.log)
+
+	userID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+
+	h.log.Debug("Fetching jokes list",
+		slog.Int("page", page),
+		slog.Int("page_size", pageSize),
+		slog.String("sort_field", sortField),
+		slog.String("order", order),
+		slog.Int64("user_id", userID))
+
+	jokesList, err := h.jokeRepo.ListPage(r.Context(), page, pageSize, sortField, order, userID)
+	if err != nil {
+		h.log.Error("Failed to fetch jokes list",
+			sl.Err(err),
+			slog.Int("page", page),
+			slog.Int("page_size", pageSize))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch jokes")
+		return
+	}
+
+	h.log.Info("Jokes list fetched successfully",
+		slog.Int("count", len(jokesList)),
+		slog.Int("page", page),
+		slog.Int("page_size", pageSize))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jokesList)
+}
+
+// parseJokeListParams reads page, page_size, sort_field and order, falling
+// back to defaults for missing or invalid values.
+func parseJokeListParams(r *http.Request, log *slog.Logger) (page, pageSize int, sortField, order string) {
 	pageStr := r.URL.Query().Get("page")
 	pageSizeStr := r.URL.Query().Get("page_size")
-	sortField := r.URL.Query().Get("sort_field")
-	order := r.URL.Query().Get("order")
+	sortField = r.URL.Query().Get("sort_field")
+	order = r.URL.Query().Get("order")
 
-	page := 1
+	page = 1
 	if pageStr != "" {
 		var err error
 		page, err = strconv.Atoi(pageStr)
 		if err != nil || page < 1 {
-			h.log.Debug("Invalid page parameter, using default",
+			log.Debug("Invalid page parameter, using default",
 				slog.String("page_str", pageStr),
 				slog.Int("default_page", 1))
 			page = 1
 		}
 	}
 
-	pageSize := 10
+	pageSize = 10
 	if pageSizeStr != "" {
 		var err error
 		pageSize, err = strconv.Atoi(pageSizeStr)
 		if err != nil || pageSize < 1 || pageSize > 100 {
-			h.log.Debug("Invalid page size parameter, using default",
+			log.Debug("Invalid page size parameter, using default",
 				slog.String("page_size_str", pageSizeStr),
 				slog.Int("default_page_size", 10))
 			pageSize = 10
@@ -160,66 +209,38 @@ func (h *JokesHandler) List(w http.ResponseWriter, r *http.Request) {
 		"score":           true,
 		"reactions_count": true,
 		"comments_count":  true,
+		"hot":             true,
+		"rising":          true,
+		"top_day":         true,
+		"top_week":        true,
+		"top_month":       true,
+		"top_all":         true,
 	}
 
 	if !allowedSortFields[sortField] {
-		h.log.Debug("Invalid sort field, using default",
+		log.Debug("Invalid sort field, using default",
 			slog.String("requested_sort", sortField),
 			slog.String("default_sort", "created_at"))
 		sortField = "created_at"
 	}
 
 	if order != "asc" && order != "desc" {
-		h.log.Debug("Invalid order parameter, using default",
+		log.Debug("Invalid order parameter, using default",
 			slog.String("requested_order", order),
 			slog.String("default_order", "desc"))
 		order = "desc"
 	}
 
-	userID, _ := r.Context().Value(middleware.UserIDKey).(int64)
-
-	h.log.Debug("Fetching jokes list",
-		slog.Int("page", page),
-		slog.Int("page_size", pageSize),
-		slog.String("sort_field", sortField),
-		slog.String("order", order),
-		slog.Int64("user_id", userID))
-
-	jokesList, err := h.jokeRepo.ListPage(page, pageSize, sortField, order, userID)
-	if err != nil {
-		h.log.Error("Failed to fetch jokes list",
-			sl.Err(err),
-			slog.Int("page", page),
-			slog.Int("page_size", pageSize))
-		http.Error(w, "Failed to fetch jokes", http.StatusInternalServerError)
-		return
-	}
-
-	h.log.Info("Jokes list fetched successfully",
-		slog.Int("count", len(jokesList)),
-		slog.Int("page", page),
-		slog.Int("page_size", pageSize))
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(jokesList)
+	return page, pageSize, sortField, order
 }
 
 func (h *JokesHandler) GetJoke(w http.ResponseWriter, r *http.Request) {
 	h.log.Debug("Get joke request received")
 
-	jokeIDStr, ok := r.Context().Value("jokeId").(string)
-	if !ok {
-		h.log.Warn("Invalid joke ID in context")
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
-		return
-	}
-
-	jokeID, err := strconv.ParseInt(jokeIDStr, 10, 64)
+	jokeID, err := pathID(r, "jokeID")
 	if err != nil {
-		h.log.Error("Failed to parse joke ID",
-			sl.Err(err),
-			slog.String("joke_id_str", jokeIDStr))
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
+		h.log.Warn("Invalid joke ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid joke ID")
 		return
 	}
 
@@ -229,17 +250,17 @@ func (h *JokesHandler) GetJoke(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("user_id", userID))
 
-	joke, err := h.jokeRepo.GetJokeByID(jokeID, userID)
+	joke, err := h.jokeRepo.GetJokeByID(r.Context(), jokeID, userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, storage.ErrNotFound) {
 			h.log.Info("Joke not found", slog.Int64("joke_id", jokeID))
-			http.Error(w, "Joke not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, "Joke not found")
 			return
 		}
 		h.log.Error("Failed to fetch joke by ID",
 			sl.Err(err),
 			slog.Int64("joke_id", jokeID))
-		http.Error(w, "Failed to get joke", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to get joke")
 		return
 	}
 
@@ -254,19 +275,10 @@ func (h *JokesHandler) GetJoke(w http.ResponseWriter, r *http.Request) {
 func (h *JokesHandler) DeleteJoke(w http.ResponseWriter, r *http.Request) {
 	h.log.Debug("Delete joke request received")
 
-	jokeIDStr, ok := r.Context().Value("jokeId").(string)
-	if !ok {
-		h.log.Warn("Invalid joke ID in context")
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
-		return
-	}
-
-	jokeID, err := strconv.ParseInt(jokeIDStr, 10, 64)
+	jokeID, err := pathID(r, "jokeID")
 	if err != nil {
-		h.log.Error("Failed to parse joke ID",
-			sl.Err(err),
-			slog.String("joke_id_str", jokeIDStr))
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
+		h.log.Warn("Invalid joke ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid joke ID")
 		return
 	}
 
@@ -274,7 +286,7 @@ func (h *JokesHandler) DeleteJoke(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		h.log.Warn("Unauthorized attempt to delete joke",
 			slog.Int64("joke_id", jokeID))
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -282,17 +294,17 @@ func (h *JokesHandler) DeleteJoke(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("user_id", userID))
 
-	joke, err := h.jokeRepo.GetJokeByID(jokeID, userID)
+	joke, err := h.jokeRepo.GetJokeByID(r.Context(), jokeID, userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, storage.ErrNotFound) {
 			h.log.Info("Joke not found", slog.Int64("joke_id", jokeID))
-			http.Error(w, "Joke not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, "Joke not found")
 			return
 		}
 		h.log.Error("Failed to fetch joke by ID",
 			sl.Err(err),
 			slog.Int64("joke_id", jokeID))
-		http.Error(w, "Failed to get joke", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to get joke")
 		return
 	}
 
@@ -301,7 +313,7 @@ func (h *JokesHandler) DeleteJoke(w http.ResponseWriter, r *http.Request) {
 			slog.Int64("joke_id", jokeID),
 			slog.Int64("requesting_user_id", userID),
 			slog.Int64("joke_author_id", joke.AuthorID))
-		http.Error(w, "Forbidden: You can only delete your own jokes", http.StatusForbidden)
+		apierror.Write(w, http.StatusForbidden, "Forbidden: You can only delete your own jokes")
 		return
 	}
 
@@ -309,11 +321,11 @@ func (h *JokesHandler) DeleteJoke(w http.ResponseWriter, r *http.Request) {
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("user_id", userID))
 
-	if err := h.jokeRepo.DeleteJoke(jokeID); err != nil {
+	if err := h.jokeRepo.DeleteJoke(r.Context(), jokeID); err != nil {
 		h.log.Error("Failed to delete joke",
 			sl.Err(err),
 			slog.Int64("joke_id", jokeID))
-		http.Error(w, "Failed to delete joke", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to delete joke")
 		return
 	}
 
@@ -327,19 +339,17 @@ func (h *JokesHandler) DeleteJoke(w http.ResponseWriter, r *http.Request) {
 func (h *JokesHandler) GetJokeWithComments(w http.ResponseWriter, r *http.Request) {
 	h.log.Debug("Get joke with comments request received")
 
-	jokeIDStr, ok := r.Context().Value("jokeId").(string)
-	if !ok {
-		h.log.Warn("Invalid joke ID in context")
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
+	jokeID, err := pathID(r, "jokeID")
+	if err != nil {
+		h.log.Warn("Invalid joke ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid joke ID")
 		return
 	}
 
-	jokeID, err := strconv.ParseInt(jokeIDStr, 10, 64)
+	page, err := parseCommentPage(r, h.maxCommentDepth, h.commentPageSize)
 	if err != nil {
-		h.log.Error("Failed to parse joke ID",
-			sl.Err(err),
-			slog.String("joke_id_str", jokeIDStr))
-		http.Error(w, "Invalid joke ID", http.StatusBadRequest)
+		h.log.Warn("Invalid comment page parameters", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -349,17 +359,17 @@ func (h *JokesHandler) GetJokeWithComments(w http.ResponseWriter, r *http.Reques
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("user_id", userID))
 
-	joke, err := h.jokeRepo.GetJokeByID(jokeID, userID)
+	joke, err := h.jokeRepo.GetJokeByID(r.Context(), jokeID, userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, storage.ErrNotFound) {
 			h.log.Info("Joke not found", slog.Int64("joke_id", jokeID))
-			http.Error(w, "Joke not found", http.StatusNotFound)
+			apierror.Write(w, http.StatusNotFound, "Joke not found")
 			return
 		}
 		h.log.Error("Failed to fetch joke by ID",
 			sl.Err(err),
 			slog.Int64("joke_id", jokeID))
-		http.Error(w, "Failed to get joke", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to get joke")
 		return
 	}
 
@@ -367,23 +377,24 @@ func (h *JokesHandler) GetJokeWithComments(w http.ResponseWriter, r *http.Reques
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("user_id", userID))
 
-	comments, err := h.commentRepo.GetCommentsByJokeID(jokeID, userID)
+	comments, err := h.commentRepo.GetTopLevelComments(r.Context(), jokeID, userID, page)
 	if err != nil {
 		h.log.Error("Failed to fetch comments for joke",
 			sl.Err(err),
 			slog.Int64("joke_id", jokeID))
-		http.Error(w, "Failed to get comments", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to get comments")
 		return
 	}
 
 	response := models.JokeWithComments{
-		Joke:     joke,
-		Comments: comments,
+		Joke:       joke,
+		Comments:   comments.Comments,
+		NextCursor: comments.NextCursor,
 	}
 
 	h.log.Info("Joke with comments fetched successfully",
 		slog.Int64("joke_id", jokeID),
-		slog.Int("comment_count", len(comments)))
+		slog.Int("comment_count", len(comments.Comments)))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"badJokes/internal/lib/jwtkeys"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+type JWKSHandler struct {
+	keys *jwtkeys.Keyring
+	log  *slog.Logger
+}
+
+func NewJWKSHandler(keys *jwtkeys.Keyring, log *slog.Logger) *JWKSHandler {
+	return &JWKSHandler{
+		keys: keys,
+		log:  log.With(slog.String("component", "jwks_handler")),
+	}
+}
+
+// GetKeys publishes the public verification keys as a JSON Web Key Set.
+func (h *JWKSHandler) GetKeys(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("JWKS request received")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.keys.JWKS())
+}
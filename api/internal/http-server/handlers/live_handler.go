@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"badJokes/internal/config"
+	"badJokes/internal/events"
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/http-server/middleware"
+	"badJokes/internal/lib/sl"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	liveWriteWait      = 10 * time.Second
+	liveAuthWait       = 10 * time.Second
+	liveMaxMessageSize = 4096
+	liveTypingInterval = 2 * time.Second
+)
+
+// liveMessage is what clients send over the socket: an "auth" message with
+// an access token when no header or cookie authenticated the upgrade, and
+// "typing" while composing a comment.
+type liveMessage struct {
+	Type     string `json:"type"`
+	Token    string `json:"token,omitempty"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+}
+
+type LiveHandler struct {
+	hub       *events.Hub
+	auth      *middleware.AuthMiddleware
+	upgrader  websocket.Upgrader
+	presence  *presenceTracker
+	heartbeat time.Duration
+	log       *slog.Logger
+}
+
+func NewLiveHandler(hub *events.Hub, auth *middleware.AuthMiddleware, cfg *config.Config, log *slog.Logger) *LiveHandler {
+	heartbeat := cfg.Stream.HeartbeatInterval
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
+	if len(cfg.Stream.AllowedOrigins) > 0 {
+		upgrader.CheckOrigin = allowedOrigin(cfg.Stream.AllowedOrigins)
+	}
+
+	return &LiveHandler{
+		hub:       hub,
+		auth:      auth,
+		upgrader:  upgrader,
+		presence:  newPresenceTracker(),
+		heartbeat: heartbeat,
+		log:       log.With(slog.String("component", "live_handler")),
+	}
+}
+
+// Serve upgrades a joke detail page to a WebSocket that pushes the joke's
+// events and relays typing and presence between viewers.
+func (h *LiveHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Live connection request received")
+
+	jokeID, err := pathID(r, "jokeID")
+	if err != nil {
+		h.log.Warn("Invalid joke ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid joke ID")
+		return
+	}
+
+	var identity *middleware.Identity
+	if userID, ok := r.Context().Value(middleware.UserIDKey).(int64); ok {
+		username, _ := r.Context().Value(middleware.UsernameKey).(string)
+		identity = &middleware.Identity{UserID: userID, Username: username}
+	}
+
+	lastEventID, _ := strconv.ParseUint(r.URL.Query().Get("last_event_id"), 10, 64)
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.log.Info("WebSocket upgrade failed", sl.Err(err), slog.Int64("joke_id", jokeID))
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(liveMaxMessageSize)
+
+	if identity == nil {
+		identity, err = h.authenticate(conn)
+		if err != nil {
+			h.log.Info("Live connection authentication failed",
+				sl.Err(err),
+				slog.Int64("joke_id", jokeID))
+			closeLive(conn, websocket.ClosePolicyViolation, "authentication required")
+			return
+		}
+	}
+
+	topic := events.JokeTopic(jokeID)
+
+	sub, backlog, err := h.hub.Subscribe([]string{topic}, lastEventID)
+	if err != nil {
+		h.log.Warn("Live connection rejected", sl.Err(err), slog.Int64("joke_id", jokeID))
+		closeLive(conn, websocket.CloseTryAgainLater, "too many connections")
+		return
+	}
+	defer h.hub.Unsubscribe(sub)
+
+	h.log.Debug("Live connection established",
+		slog.Int64("joke_id", jokeID),
+		slog.Int64("user_id", identity.UserID),
+		slog.Int("backlog", len(backlog)))
+
+	for _, event := range backlog {
+		conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+		if err := conn.WriteJSON(event); err != nil {
+			return
+		}
+	}
+
+	h.hub.Signal(events.TypePresence, h.presence.join(jokeID, identity), topic)
+	defer func() {
+		h.hub.Signal(events.TypePresence, h.presence.leave(jokeID, identity.UserID), topic)
+	}()
+
+	done := make(chan struct{})
+	go h.writePump(conn, sub, done)
+
+	h.readPump(conn, jokeID, identity)
+
+	h.hub.Unsubscribe(sub)
+	<-done
+
+	h.log.Debug("Live connection closed",
+		slog.Int64("joke_id", jokeID),
+		slog.Int64("user_id", identity.UserID))
+}
+
+// authenticate expects the first message on an unauthenticated socket to be
+// an auth message, so tokens never have to appear in the URL.
+func (h *LiveHandler) authenticate(conn *websocket.Conn) (*middleware.Identity, error) {
+	conn.SetReadDeadline(time.Now().Add(liveAuthWait))
+
+	var msg liveMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		return nil, err
+	}
+
+	if msg.Type != "auth" || msg.Token == "" {
+		return nil, middleware.ErrInvalidToken
+	}
+
+	return h.auth.Authenticate(msg.Token)
+}
+
+func (h *LiveHandler) writePump(conn *websocket.Conn, sub *events.Subscription, done chan<- struct{}) {
+	defer close(done)
+	defer conn.Close()
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				closeLive(conn, websocket.CloseGoingAway, "")
+				return
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *LiveHandler) readPump(conn *websocket.Conn, jokeID int64, identity *middleware.Identity) {
+	readWait := 2 * h.heartbeat
+
+	conn.SetReadDeadline(time.Now().Add(readWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readWait))
+	})
+
+	var lastTyping time.Time
+	for {
+		var msg liveMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		switch msg.Type {
+		case "typing":
+			if time.Since(lastTyping) < liveTypingInterval {
+				continue
+			}
+			lastTyping = time.Now()
+
+			h.hub.Signal(events.TypeTyping, events.Typing{
+				JokeID:   jokeID,
+				UserID:   identity.UserID,
+				Username: identity.Username,
+				ParentID: msg.ParentID,
+			}, events.JokeTopic(jokeID))
+		default:
+			h.log.Debug("Ignoring unknown live message",
+				slog.String("type", msg.Type),
+				slog.Int64("user_id", identity.UserID))
+		}
+	}
+}
+
+func closeLive(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(liveWriteWait))
+}
+
+func allowedOrigin(origins []string) func(r *http.Request) bool {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowed[origin] {
+			return true
+		}
+
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+}
+
+// presenceTracker counts connections per user and joke so a user with
+// several tabs open stays present until the last one closes.
+type presenceTracker struct {
+	mu    sync.Mutex
+	rooms map[int64]map[int64]*presenceEntry
+}
+
+type presenceEntry struct {
+	username    string
+	connections int
+}
+
+func newPresenceTracker() *presenceTracker {
+	return &presenceTracker{rooms: map[int64]map[int64]*presenceEntry{}}
+}
+
+func (p *presenceTracker) join(jokeID int64, identity *middleware.Identity) events.Presence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	room, ok := p.rooms[jokeID]
+	if !ok {
+		room = map[int64]*presenceEntry{}
+		p.rooms[jokeID] = room
+	}
+
+	entry, ok := room[identity.UserID]
+	if !ok {
+		entry = &presenceEntry{username: identity.Username}
+		room[identity.UserID] = entry
+	}
+	entry.connections++
+
+	return p.snapshot(jokeID)
+}
+
+func (p *presenceTracker) leave(jokeID, userID int64) events.Presence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if room, ok := p.rooms[jokeID]; ok {
+		if entry, ok := room[userID]; ok {
+			entry.connections--
+			if entry.connections <= 0 {
+				delete(room, userID)
+			}
+		}
+		if len(room) == 0 {
+			delete(p.rooms, jokeID)
+		}
+	}
+
+	return p.snapshot(jokeID)
+}
+
+func (p *presenceTracker) snapshot(jokeID int64) events.Presence {
+	presence := events.Presence{JokeID: jokeID, Users: []events.PresenceUser{}}
+	for userID, entry := range p.rooms[jokeID] {
+		presence.Users = append(presence.Users, events.PresenceUser{ID: userID, Username: entry.username})
+	}
+
+	sort.Slice(presence.Users, func(i, j int) bool {
+		return presence.Users[i].ID < presence.Users[j].ID
+	})
+
+	return presence
+}
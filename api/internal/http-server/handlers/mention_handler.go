@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/http-server/middleware"
+	"badJokes/internal/lib/sl"
+	"badJokes/internal/storage"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type MentionHandler struct {
+	mentionRepo storage.MentionRepository
+	log         *slog.Logger
+}
+
+func NewMentionHandler(repo storage.MentionRepository, log *slog.Logger) *MentionHandler {
+	return &MentionHandler{
+		mentionRepo: repo,
+		log:         log.With(slog.String("component", "mention_handler")),
+	}
+}
+
+// List returns the jokes and comments mentioning the current user, newest
+// first.
+func (h *MentionHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("List mentions request received")
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized mentions request")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	mentions, err := h.mentionRepo.ListForUser(r.Context(), userID, page, pageSize)
+	if err != nil {
+		h.log.Error("Failed to fetch mentions",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch mentions")
+		return
+	}
+
+	h.log.Debug("Mentions fetched",
+		slog.Int64("user_id", userID),
+		slog.Int("count", len(mentions)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mentions":  mentions,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/http-server/middleware"
+	"badJokes/internal/lib/sl"
+	"badJokes/internal/models"
+	"badJokes/internal/storage"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type NotificationHandler struct {
+	notificationRepo storage.NotificationRepository
+	log              *slog.Logger
+}
+
+func NewNotificationHandler(repo storage.NotificationRepository, log *slog.Logger) *NotificationHandler {
+	return &NotificationHandler{
+		notificationRepo: repo,
+		log:              log.With(slog.String("component", "notification_handler")),
+	}
+}
+
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("List notifications request received")
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized notifications request")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	notifications, err := h.notificationRepo.List(r.Context(), userID, page, pageSize, unreadOnly)
+	if err != nil {
+		h.log.Error("Failed to fetch notifications",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch notifications")
+		return
+	}
+
+	unreadCount, err := h.notificationRepo.UnreadCount(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to count unread notifications",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch notifications")
+		return
+	}
+
+	h.log.Debug("Notifications fetched",
+		slog.Int64("user_id", userID),
+		slog.Int("count", len(notifications)),
+		slog.Int("unread_count", unreadCount))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+		"unread_count":  unreadCount,
+		"page":          page,
+		"page_size":     pageSize,
+	})
+}
+
+// MarkRead marks the listed notification ids as read, or every unread
+// notification when no ids are sent.
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Mark notifications read request received")
+
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized mark-read request")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			h.log.Error("Failed to decode mark-read request", sl.Err(err))
+			apierror.Write(w, http.StatusBadRequest, "Invalid input")
+			return
+		}
+	}
+
+	if err := h.notificationRepo.MarkRead(r.Context(), userID, input.IDs); err != nil {
+		h.log.Error("Failed to mark notifications as read",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to mark notifications as read")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Get notification preferences request received")
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized notification preferences request")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	preferences, err := h.notificationRepo.GetPreferences(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to fetch notification preferences",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch notification preferences")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preferences)
+}
+
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Update notification preferences request received")
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized notification preferences update")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var input map[string]bool
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.log.Error("Failed to decode notification preferences", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	for eventType := range input {
+		if !isNotificationType(eventType) {
+			h.log.Warn("Invalid notification type in preferences",
+				slog.String("type", eventType),
+				slog.Int64("user_id", userID))
+			apierror.Write(w, http.StatusBadRequest, "Invalid notification type")
+			return
+		}
+	}
+
+	if err := h.notificationRepo.SetPreferences(r.Context(), userID, input); err != nil {
+		h.log.Error("Failed to update notification preferences",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to update notification preferences")
+		return
+	}
+
+	h.log.Info("Notification preferences updated", slog.Int64("user_id", userID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func isNotificationType(eventType string) bool {
+	for _, t := range models.NotificationTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// notify records a notification without failing the request that caused it.
+// It runs within the request, so ctx bounds it by the request's deadline.
+func notify(ctx context.Context, repo storage.NotificationRepository, log *slog.Logger, eventType, entityType string, entityID, actorID int64) {
+	if err := repo.Notify(ctx, eventType, entityType, entityID, actorID); err != nil {
+		log.WarnContext(ctx, "Failed to record notification",
+			sl.Err(err),
+			slog.String("type", eventType),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID))
+	}
+}
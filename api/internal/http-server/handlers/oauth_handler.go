@@ -2,243 +2,303 @@ package handlers
 
 import (
 	"badJokes/internal/config"
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/http-server/session"
+	"badJokes/internal/lib/jwtkeys"
 	"badJokes/internal/lib/sl"
+	"badJokes/internal/oauth"
 	"badJokes/internal/storage"
-	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/github"
-	"golang.org/x/oauth2/google"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * time.Minute
+	loginCodeTTL     = time.Minute
 )
 
 type OAuthHandler struct {
-	userRepo   storage.UserRepository
-	log        *slog.Logger
-	jwtSecret  []byte
-	oauthConfs map[string]*oauth2.Config
-	config     *config.Config
+	userRepo  storage.UserRepository
+	log       *slog.Logger
+	keys      *jwtkeys.Keyring
+	providers map[string]*oauth.Provider
+	sessions  *session.Manager
+	config    *config.Config
 }
 
-func NewOAuthHandler(repo storage.UserRepository, cfg *config.Config, log *slog.Logger) *OAuthHandler {
-	googleConf := &oauth2.Config{
-		ClientID:     cfg.OAuth.GoogleClientID,
-		ClientSecret: cfg.OAuth.GoogleClientSecret,
-		RedirectURL:  cfg.OAuth.BaseURL + "/api/auth/google/callback",
-		Scopes:       []string{"profile", "email"},
-		Endpoint:     google.Endpoint,
-	}
+func NewOAuthHandler(repo storage.UserRepository, cfg *config.Config, keys *jwtkeys.Keyring, sessions *session.Manager, log *slog.Logger) *OAuthHandler {
+	providers := oauth.NewProviders(cfg)
 
-	githubConf := &oauth2.Config{
-		ClientID:     cfg.OAuth.GithubClientID,
-		ClientSecret: cfg.OAuth.GithubClientSecret,
-		RedirectURL:  cfg.OAuth.BaseURL + "/api/auth/github/callback",
-		Scopes:       []string{"user:email"},
-		Endpoint:     github.Endpoint,
+	handlerLog := log.With(slog.String("component", "oauth_handler"))
+	for name, provider := range providers {
+		handlerLog.Info("OAuth provider configured",
+			slog.String("provider", name),
+			slog.Bool("oidc", provider.IsOIDC()))
 	}
 
 	return &OAuthHandler{
 		userRepo:  repo,
-		log:       log.With(slog.String("component", "oauth_handler")),
-		jwtSecret: []byte(cfg.JWTSecret),
-		oauthConfs: map[string]*oauth2.Config{
-			"google": googleConf,
-			"github": githubConf,
-		},
-		config: cfg,
+		log:       handlerLog,
+		keys:      keys,
+		providers: providers,
+		sessions:  sessions,
+		config:    cfg,
 	}
 }
 
-func (h *OAuthHandler) InitiateOAuth(w http.ResponseWriter, r *http.Request, provider string) {
-	h.log.Debug("OAuth login initiated", slog.String("provider", provider))
+func (h *OAuthHandler) InitiateOAuth(w http.ResponseWriter, r *http.Request) {
+	providerName := pathParam(r, "provider")
+	h.log.Debug("OAuth login initiated", slog.String("provider", providerName))
 
-	conf, ok := h.oauthConfs[provider]
+	provider, ok := h.providers[providerName]
 	if !ok {
-		http.Error(w, "Unsupported OAuth provider", http.StatusBadRequest)
+		apierror.Write(w, http.StatusNotFound, "Unsupported OAuth provider")
+		return
+	}
+
+	stateValue, err := generateRandomState()
+	if err != nil {
+		h.log.Error("Failed to generate OAuth state", sl.Err(err))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to start OAuth flow")
+		return
+	}
+	nonce, err := generateRandomState()
+	if err != nil {
+		h.log.Error("Failed to generate OAuth nonce", sl.Err(err))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to start OAuth flow")
 		return
 	}
 
-	state := generateRandomState()
+	state := oauthState{
+		State:    stateValue,
+		Provider: providerName,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+		ReturnTo: sanitizeReturnTo(r.URL.Query().Get("return_to")),
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state.State, state.Nonce, oauth2.S256ChallengeOption(state.Verifier))
+	if err != nil {
+		h.log.Error("Failed to build OAuth authorization URL",
+			sl.Err(err),
+			slog.String("provider", providerName))
+		apierror.Write(w, http.StatusBadGateway, "OAuth provider unavailable")
+		return
+	}
+
+	stateToken, err := generateOAuthStateToken(h.keys, state, oauthStateTTL)
+	if err != nil {
+		h.log.Error("Failed to sign OAuth state", sl.Err(err))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to start OAuth flow")
+		return
+	}
 
 	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_state",
-		Value:    state,
-		MaxAge:   int(time.Hour.Seconds()),
+		Name:     oauthStateCookie,
+		Value:    stateToken,
+		MaxAge:   int(oauthStateTTL.Seconds()),
 		HttpOnly: true,
-		Secure:   r.TLS != nil,
+		Secure:   h.config.Session.CookieSecure,
 		SameSite: http.SameSiteLaxMode,
-		Path:     "/",
+		Path:     "/api/auth/",
 	})
 
-	url := conf.AuthCodeURL(state)
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
 }
 
-func (h *OAuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request, provider string) {
-	h.log.Debug("OAuth callback received", slog.String("provider", provider))
+func (h *OAuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	providerName := pathParam(r, "provider")
+	h.log.Debug("OAuth callback received", slog.String("provider", providerName))
 
-	stateCookie, err := r.Cookie("oauth_state")
-	if err != nil || stateCookie.Value != r.FormValue("state") {
-		h.log.Error("Invalid OAuth state", sl.Err(err))
-		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
+	stateCookie, err := r.Cookie(oauthStateCookie)
+	if err != nil {
+		h.log.Info("OAuth state cookie missing", slog.String("provider", providerName))
+		apierror.Write(w, http.StatusBadRequest, "Invalid OAuth state")
 		return
 	}
 
 	http.SetCookie(w, &http.Cookie{
-		Name:   "oauth_state",
-		Value:  "",
-		MaxAge: -1,
-		Path:   "/",
+		Name:     oauthStateCookie,
+		Value:    "",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.config.Session.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/api/auth/",
 	})
 
-	conf, ok := h.oauthConfs[provider]
-	if !ok {
-		http.Error(w, "Unsupported OAuth provider", http.StatusBadRequest)
+	state, err := parseOAuthStateToken(h.keys, stateCookie.Value)
+	if err != nil || state.Provider != providerName || state.State != r.URL.Query().Get("state") {
+		h.log.Warn("Invalid OAuth state",
+			slog.String("provider", providerName),
+			slog.String("state_provider", state.Provider))
+		apierror.Write(w, http.StatusBadRequest, "Invalid OAuth state")
 		return
 	}
 
-	code := r.FormValue("code")
-	token, err := conf.Exchange(context.Background(), code)
-	if err != nil {
-		h.log.Error("Failed to exchange OAuth code for token", sl.Err(err))
-		http.Error(w, "Failed to complete OAuth flow", http.StatusInternalServerError)
+	provider, ok := h.providers[providerName]
+	if !ok {
+		apierror.Write(w, http.StatusNotFound, "Unsupported OAuth provider")
 		return
 	}
 
-	userInfo, err := h.getUserInfoFromProvider(provider, token)
+	userInfo, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), state.Nonce, oauth2.VerifierOption(state.Verifier))
 	if err != nil {
-		h.log.Error("Failed to get user info from provider",
+		h.log.Error("Failed to complete OAuth flow",
 			sl.Err(err),
-			slog.String("provider", provider))
-		http.Error(w, "Failed to get user information", http.StatusInternalServerError)
+			slog.String("provider", providerName))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to complete OAuth flow")
+		return
+	}
+
+	if userInfo.Email == "" {
+		h.log.Warn("OAuth provider returned no usable email",
+			slog.String("provider", providerName))
+		apierror.Write(w, http.StatusBadRequest, "OAuth provider did not return a verified email")
 		return
 	}
 
-	user, err := h.userRepo.FindOrCreateOAuthUser(
+	username := userInfo.Username
+	if username == "" {
+		username = extractUsernameFromEmail(userInfo.Email)
+	}
+
+	user, err := h.userRepo.FindOrCreateOAuthUser(r.Context(),
 		userInfo.Email,
-		userInfo.Name,
-		provider,
-		userInfo.ProviderID,
+		userInfo.EmailVerified,
+		username,
+		providerName,
+		userInfo.Subject,
 	)
+	if errors.Is(err, storage.ErrConflict) && !userInfo.EmailVerified {
+		h.log.Info("OAuth email matches an account but is not verified",
+			slog.String("provider", providerName))
+		apierror.Write(w, http.StatusConflict, "An account with this email already exists; sign in with it instead")
+		return
+	}
 	if err != nil {
 		h.log.Error("Failed to create or find user", sl.Err(err))
-		http.Error(w, "Failed to process user data", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, "Failed to process user data")
 		return
 	}
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"is_admin": user.IsAdmin,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	tokenString, err := jwtToken.SignedString(h.jwtSecret)
+	code, err := generateRandomState()
 	if err != nil {
-		h.log.Error("Failed to generate token", sl.Err(err))
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		h.log.Error("Failed to generate login code", sl.Err(err))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to complete OAuth flow")
+		return
+	}
+	if err := h.userRepo.CreateLoginCode(r.Context(), user.ID, hashLoginCode(code), user.TOTPEnabled, loginCodeTTL); err != nil {
+		h.log.Error("Failed to create login code", sl.Err(err), slog.Int64("user_id", user.ID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to complete OAuth flow")
 		return
 	}
 
-	callbackURL := h.config.OAuth.CallbackURL + "/auth/callback?token=" + tokenString
-	http.Redirect(w, r, callbackURL, http.StatusTemporaryRedirect)
-}
+	params := url.Values{}
+	params.Set("code", code)
+	params.Set("return_to", state.ReturnTo)
 
-type OAuthUserInfo struct {
-	Email      string
-	Name       string
-	ProviderID string
+	http.Redirect(w, r, h.config.OAuth.CallbackURL+"/auth/callback?"+params.Encode(), http.StatusFound)
 }
 
-func (h *OAuthHandler) getUserInfoFromProvider(provider string, token *oauth2.Token) (*OAuthUserInfo, error) {
-	client := h.oauthConfs[provider].Client(context.Background(), token)
+// ExchangeCode trades the one-time code from the OAuth redirect for a token.
+// Accounts with two-factor authentication get a pre-auth token instead and
+// finish through the two-factor verification endpoint.
+func (h *OAuthHandler) ExchangeCode(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("OAuth code exchange request received")
 
-	switch provider {
-	case "google":
-		resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		var userInfo struct {
-			ID    string `json:"id"`
-			Email string `json:"email"`
-			Name  string `json:"name"`
-		}
-
-		if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-			return nil, err
-		}
-        
-        username := extractUsernameFromEmail(userInfo.Email)
-		
-		return &OAuthUserInfo{
-			Email:      userInfo.Email,
-			Name:       username,
-			ProviderID: userInfo.ID,
-		}, nil
-
-	case "github":
-		resp, err := client.Get("https://api.github.com/user")
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
+	var input struct {
+		Code string `json:"code"`
+	}
 
-		var userInfo struct {
-			ID    int    `json:"id"`
-			Login string `json:"login"`
-			Name  string `json:"name"`
-		}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		h.log.Info("Invalid code exchange request")
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
 
-		if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-			return nil, err
+	userID, twoFactorPending, err := h.userRepo.ConsumeLoginCode(r.Context(), hashLoginCode(input.Code))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusUnauthorized, "Invalid or expired code")
+			return
 		}
+		h.log.Error("Failed to consume login code", sl.Err(err))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to exchange code")
+		return
+	}
 
-		emailResp, err := client.Get("https://api.github.com/user/emails")
+	if twoFactorPending {
+		preAuthToken, err := generatePreAuthToken(h.keys, userID, h.config.TwoFactor.PreAuthTokenTTL)
 		if err != nil {
-			return nil, err
+			h.log.Error("Failed to generate pre-auth token", sl.Err(err))
+			apierror.Write(w, http.StatusInternalServerError, "Failed to generate token")
+			return
 		}
-		defer emailResp.Body.Close()
 
-		var emails []struct {
-			Email    string `json:"email"`
-			Primary  bool   `json:"primary"`
-			Verified bool   `json:"verified"`
-		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"two_factor_required": true,
+			"pre_auth_token":      preAuthToken,
+		})
+		return
+	}
 
-		if err := json.NewDecoder(emailResp.Body).Decode(&emails); err != nil {
-			return nil, err
-		}
+	user, err := h.userRepo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to fetch user", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to exchange code")
+		return
+	}
 
-		var email string
-		for _, e := range emails {
-			if e.Primary && e.Verified {
-				email = e.Email
-				break
-			}
-		}
+	tokenString, err := generateAccessToken(h.keys, user, false)
+	if err != nil {
+		h.log.Error("Failed to generate token", sl.Err(err))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
 
-		username := extractUsernameFromEmail(email)
+	h.log.Info("OAuth login completed", slog.Int64("user_id", userID))
 
-		return &OAuthUserInfo{
-			Email:      email,
-			Name:       username,
-			ProviderID: string(userInfo.ID),
-		}, nil
+	if err := writeSession(w, h.sessions, tokenString, user, nil, http.StatusOK); err != nil {
+		h.log.Error("Failed to write session", sl.Err(err), slog.Int64("user_id", userID))
 	}
+}
 
-	return nil, nil
+// sanitizeReturnTo only allows local paths so the login flow cannot be used
+// as an open redirect.
+func sanitizeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.Contains(returnTo, "\\") {
+		return "/"
+	}
+	return returnTo
 }
 
-func generateRandomState() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+func hashLoginCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateRandomState() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
 }
 
 func extractUsernameFromEmail(email string) string {
@@ -250,4 +310,4 @@ func extractUsernameFromEmail(email string) string {
 		}
 	}
 	return username
-}
\ No newline at end of file
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// pathParam returns a named parameter of the matched route, e.g. "jokeID"
+// for /api/jokes/{jokeID}.
+func pathParam(r *http.Request, name string) string {
+	return chi.URLParam(r, name)
+}
+
+// pathID parses a named route parameter as a positive id.
+func pathID(r *http.Request, name string) (int64, error) {
+	value := pathParam(r, name)
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return id, nil
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/http-server/middleware"
+	"badJokes/internal/lib/sl"
+	"badJokes/internal/models"
+	"badJokes/internal/storage"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var reactionKeyPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+type ReactionHandler struct {
+	reactionRepo storage.ReactionRepository
+	log          *slog.Logger
+}
+
+func NewReactionHandler(reactionRepo storage.ReactionRepository, log *slog.Logger) *ReactionHandler {
+	return &ReactionHandler{
+		reactionRepo: reactionRepo,
+		log:          log.With(slog.String("component", "reaction_handler")),
+	}
+}
+
+// Catalog lists every reaction, including retired ones so clients can still
+// render their counts; only enabled reactions should be offered.
+func (h *ReactionHandler) Catalog(w http.ResponseWriter, r *http.Request) {
+	reactions, err := h.reactionRepo.List(r.Context())
+	if err != nil {
+		h.log.Error("Failed to list reaction catalog", sl.Err(err))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch reactions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	json.NewEncoder(w).Encode(reactions)
+}
+
+func (h *ReactionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Create reaction request received")
+
+	adminID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+
+	var input struct {
+		Key       string `json:"key"`
+		Emoji     string `json:"emoji"`
+		Label     string `json:"label"`
+		SortOrder int    `json:"sort_order"`
+		Enabled   *bool  `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.log.Warn("Failed to decode reaction", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	reaction := models.Reaction{
+		Key:       input.Key,
+		Emoji:     strings.TrimSpace(input.Emoji),
+		Label:     strings.TrimSpace(input.Label),
+		SortOrder: input.SortOrder,
+		Enabled:   input.Enabled == nil || *input.Enabled,
+	}
+	if fields := validateReaction(reaction); len(fields) > 0 {
+		apierror.WriteError(w, apierror.Validation(fields...))
+		return
+	}
+
+	created, err := h.reactionRepo.Create(r.Context(), reaction)
+	if err != nil {
+		h.log.Error("Failed to create reaction", sl.Err(err), slog.String("key", reaction.Key))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to create reaction")
+		return
+	}
+	if !created {
+		apierror.Write(w, http.StatusConflict, "Reaction already exists")
+		return
+	}
+
+	h.log.Info("Reaction added to catalog",
+		slog.String("key", reaction.Key),
+		slog.Int64("admin_id", adminID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reaction)
+}
+
+// Update changes the fields present in the body, e.g. {"enabled": true} to
+// bring a retired reaction back.
+func (h *ReactionHandler) Update(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Update reaction request received")
+
+	adminID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+	key := pathParam(r, "reactionKey")
+
+	var input struct {
+		Emoji     *string `json:"emoji"`
+		Label     *string `json:"label"`
+		SortOrder *int    `json:"sort_order"`
+		Enabled   *bool   `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.log.Warn("Failed to decode reaction update", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	reaction, err := h.reactionRepo.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusNotFound, "Reaction not found")
+			return
+		}
+		h.log.Error("Failed to fetch reaction", sl.Err(err), slog.String("key", key))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to update reaction")
+		return
+	}
+
+	if input.Emoji != nil {
+		reaction.Emoji = strings.TrimSpace(*input.Emoji)
+	}
+	if input.Label != nil {
+		reaction.Label = strings.TrimSpace(*input.Label)
+	}
+	if input.SortOrder != nil {
+		reaction.SortOrder = *input.SortOrder
+	}
+	if input.Enabled != nil {
+		reaction.Enabled = *input.Enabled
+	}
+	if fields := validateReaction(*reaction); len(fields) > 0 {
+		apierror.WriteError(w, apierror.Validation(fields...))
+		return
+	}
+
+	if err := h.reactionRepo.Update(r.Context(), *reaction); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusNotFound, "Reaction not found")
+			return
+		}
+		h.log.Error("Failed to update reaction", sl.Err(err), slog.String("key", key))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to update reaction")
+		return
+	}
+
+	h.log.Info("Reaction updated",
+		slog.String("key", key),
+		slog.Bool("enabled", reaction.Enabled),
+		slog.Int64("admin_id", adminID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reaction)
+}
+
+// Retire disables a reaction instead of deleting it, so counts already
+// given keep rendering.
+func (h *ReactionHandler) Retire(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Retire reaction request received")
+
+	adminID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+	key := pathParam(r, "reactionKey")
+
+	if err := h.reactionRepo.Retire(r.Context(), key); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusNotFound, "Reaction not found")
+			return
+		}
+		h.log.Error("Failed to retire reaction", sl.Err(err), slog.String("key", key))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to retire reaction")
+		return
+	}
+
+	h.log.Info("Reaction retired",
+		slog.String("key", key),
+		slog.Int64("admin_id", adminID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateReaction(reaction models.Reaction) []apierror.FieldError {
+	var fields []apierror.FieldError
+	if !reactionKeyPattern.MatchString(reaction.Key) {
+		fields = append(fields, apierror.FieldError{Field: "key", Message: "Reaction key must be 1-32 lowercase letters, digits or underscores"})
+	}
+	if reaction.Emoji == "" || len(reaction.Emoji) > 32 {
+		fields = append(fields, apierror.FieldError{Field: "emoji", Message: "Reaction emoji is required"})
+	}
+	if reaction.Label == "" || len(reaction.Label) > 64 {
+		fields = append(fields, apierror.FieldError{Field: "label", Message: "Reaction label must be 1-64 characters"})
+	}
+	return fields
+}
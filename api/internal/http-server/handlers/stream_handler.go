@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"badJokes/internal/config"
+	"badJokes/internal/events"
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/lib/sl"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type StreamHandler struct {
+	hub       *events.Hub
+	heartbeat time.Duration
+	log       *slog.Logger
+}
+
+const defaultHeartbeat = 25 * time.Second
+
+func NewStreamHandler(hub *events.Hub, cfg *config.Config, log *slog.Logger) *StreamHandler {
+	heartbeat := cfg.Stream.HeartbeatInterval
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+
+	return &StreamHandler{
+		hub:       hub,
+		heartbeat: heartbeat,
+		log:       log.With(slog.String("component", "stream_handler")),
+	}
+}
+
+// Stream serves Server-Sent Events for one joke (?joke_id=) or, without a
+// joke id, the global feed. Clients resume through the Last-Event-ID header
+// that EventSource sends on reconnect.
+func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Stream request received")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.log.Error("Streaming not supported by response writer")
+		apierror.Write(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	topic := events.TopicFeed
+	if jokeIDStr := r.URL.Query().Get("joke_id"); jokeIDStr != "" {
+		jokeID, err := strconv.ParseInt(jokeIDStr, 10, 64)
+		if err != nil || jokeID < 1 {
+			h.log.Warn("Invalid joke ID in stream request",
+				slog.String("joke_id_str", jokeIDStr))
+			apierror.Write(w, http.StatusBadRequest, "Invalid joke ID")
+			return
+		}
+		topic = events.JokeTopic(jokeID)
+	}
+
+	lastEventIDStr := r.Header.Get("Last-Event-ID")
+	if lastEventIDStr == "" {
+		lastEventIDStr = r.URL.Query().Get("last_event_id")
+	}
+	lastEventID, _ := strconv.ParseUint(lastEventIDStr, 10, 64)
+
+	sub, backlog, err := h.hub.Subscribe([]string{topic}, lastEventID)
+	if err != nil {
+		h.log.Warn("Stream connection rejected", sl.Err(err), slog.String("topic", topic))
+		w.Header().Set("Retry-After", "5")
+		apierror.Write(w, http.StatusServiceUnavailable, "Too many stream connections")
+		return
+	}
+	defer h.hub.Unsubscribe(sub)
+
+	h.log.Debug("Stream subscribed",
+		slog.String("topic", topic),
+		slog.Uint64("last_event_id", lastEventID),
+		slog.Int("backlog", len(backlog)))
+
+	// The server's write timeout would cut the stream off, so it is lifted
+	// here; dead clients are caught by failed heartbeat writes instead.
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		h.log.Warn("Failed to lift stream write deadline", sl.Err(err))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, event := range backlog {
+		if err := writeSSE(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			h.log.Debug("Stream client disconnected", slog.String("topic", topic))
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				h.log.Debug("Stream subscriber dropped", slog.String("topic", topic))
+				return
+			}
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
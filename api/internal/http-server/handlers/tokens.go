@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"badJokes/internal/http-server/session"
+	"badJokes/internal/lib/jwtkeys"
+	"badJokes/internal/models"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	accessTokenTTL = time.Hour * 24
+
+	tokenTypePreAuth    = "pre_auth"
+	tokenTypeOAuthState = "oauth_state"
+)
+
+func generateAccessToken(keys *jwtkeys.Keyring, user *models.User, mfa bool) (string, error) {
+	return keys.Sign(jwt.MapClaims{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"is_admin": user.IsAdmin,
+		"mfa":      mfa,
+		"exp":      time.Now().Add(accessTokenTTL).Unix(),
+	})
+}
+
+// generatePreAuthToken issues the short-lived token handed out after a correct
+// password for accounts with two-factor authentication. It is only accepted
+// by the two-factor verification endpoint, never by AuthMiddleware.
+func generatePreAuthToken(keys *jwtkeys.Keyring, userID int64, ttl time.Duration) (string, error) {
+	return keys.Sign(jwt.MapClaims{
+		"user_id":    userID,
+		"token_type": tokenTypePreAuth,
+		"exp":        time.Now().Add(ttl).Unix(),
+	})
+}
+
+func parsePreAuthToken(keys *jwtkeys.Keyring, tokenString string) (int64, error) {
+	claims, err := keys.Parse(tokenString)
+	if err != nil {
+		return 0, err
+	}
+
+	if tokenType, _ := claims["token_type"].(string); tokenType != tokenTypePreAuth {
+		return 0, jwt.ErrTokenInvalidClaims
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, jwt.ErrTokenInvalidClaims
+	}
+
+	return int64(userID), nil
+}
+
+// oauthState is carried through the provider round trip in a signed cookie so
+// the callback can check it was started for the same provider and recover the
+// PKCE verifier, OIDC nonce and where to send the user afterwards.
+type oauthState struct {
+	State    string
+	Provider string
+	Nonce    string
+	Verifier string
+	ReturnTo string
+}
+
+func generateOAuthStateToken(keys *jwtkeys.Keyring, state oauthState, ttl time.Duration) (string, error) {
+	return keys.Sign(jwt.MapClaims{
+		"token_type": tokenTypeOAuthState,
+		"state":      state.State,
+		"provider":   state.Provider,
+		"nonce":      state.Nonce,
+		"verifier":   state.Verifier,
+		"return_to":  state.ReturnTo,
+		"exp":        time.Now().Add(ttl).Unix(),
+	})
+}
+
+func parseOAuthStateToken(keys *jwtkeys.Keyring, tokenString string) (oauthState, error) {
+	claims, err := keys.Parse(tokenString)
+	if err != nil {
+		return oauthState{}, err
+	}
+
+	if tokenType, _ := claims["token_type"].(string); tokenType != tokenTypeOAuthState {
+		return oauthState{}, jwt.ErrTokenInvalidClaims
+	}
+
+	var state oauthState
+	state.State, _ = claims["state"].(string)
+	state.Provider, _ = claims["provider"].(string)
+	state.Nonce, _ = claims["nonce"].(string)
+	state.Verifier, _ = claims["verifier"].(string)
+	state.ReturnTo, _ = claims["return_to"].(string)
+
+	return state, nil
+}
+
+// writeSession delivers an access token according to the session mode: in the
+// response body for bearer clients and as HttpOnly cookie plus CSRF token for
+// cookie sessions.
+func writeSession(w http.ResponseWriter, sessions *session.Manager, tokenString string, user *models.User, response map[string]interface{}, status int) error {
+	if response == nil {
+		response = map[string]interface{}{}
+	}
+
+	if sessions.CookiesEnabled() {
+		csrfToken, err := sessions.Issue(w, tokenString, accessTokenTTL)
+		if err != nil {
+			return err
+		}
+		response["csrf_token"] = csrfToken
+		response["user"] = user
+	}
+
+	if sessions.BearerEnabled() {
+		response["token"] = tokenString
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"badJokes/internal/config"
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/http-server/middleware"
+	"badJokes/internal/http-server/session"
+	"badJokes/internal/lib/jwtkeys"
+	"badJokes/internal/lib/sl"
+	"badJokes/internal/lib/totp"
+	"badJokes/internal/storage"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+type TwoFactorHandler struct {
+	repo      storage.UserRepository
+	keys      *jwtkeys.Keyring
+	twoFactor config.TwoFactor
+	sessions  *session.Manager
+	log       *slog.Logger
+}
+
+func NewTwoFactorHandler(repo storage.UserRepository, cfg *config.Config, keys *jwtkeys.Keyring, sessions *session.Manager, log *slog.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		repo:      repo,
+		keys:      keys,
+		twoFactor: cfg.TwoFactor,
+		sessions:  sessions,
+		log:       log.With(slog.String("component", "two_factor_handler")),
+	}
+}
+
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Two-factor enrollment request received")
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized two-factor enrollment attempt")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.log.Error("Failed to fetch user", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+
+	if user.TOTPEnabled {
+		h.log.Info("Two-factor already enabled", slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.log.Error("Failed to generate TOTP secret", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+
+	if err := h.repo.SetPendingTOTPSecret(r.Context(), userID, secret); err != nil {
+		h.log.Error("Failed to store TOTP secret", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+
+	h.log.Info("Two-factor enrollment started", slog.Int64("user_id", userID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(h.twoFactor.Issuer, user.Email, secret),
+	})
+}
+
+func (h *TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Two-factor confirmation request received")
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized two-factor confirmation attempt")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.log.Error("Failed to decode two-factor confirmation request", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	secret, enabled, err := h.repo.GetTOTPSecret(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to fetch TOTP secret", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to confirm enrollment")
+		return
+	}
+
+	if enabled {
+		apierror.Write(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	if secret == "" {
+		apierror.Write(w, http.StatusBadRequest, "Two-factor enrollment has not been started")
+		return
+	}
+
+	step, ok := totp.ValidateStep(input.Code, secret, time.Now())
+	if !ok {
+		h.log.Info("Invalid TOTP code during confirmation", slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusUnauthorized, "Invalid verification code")
+		return
+	}
+
+	// Burn the confirmation code so it cannot be replayed to log in.
+	accepted, err := h.repo.AcceptTOTPStep(r.Context(), userID, step)
+	if err != nil {
+		h.log.Error("Failed to record TOTP step", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to confirm enrollment")
+		return
+	}
+
+	if !accepted {
+		apierror.Write(w, http.StatusUnauthorized, "Invalid verification code")
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		h.log.Error("Failed to generate recovery codes", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to confirm enrollment")
+		return
+	}
+
+	if err := h.repo.EnableTOTP(r.Context(), userID, hashes); err != nil {
+		h.log.Error("Failed to enable TOTP", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to confirm enrollment")
+		return
+	}
+
+	h.log.Info("Two-factor authentication enabled", slog.Int64("user_id", userID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Two-factor disable request received")
+
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized two-factor disable attempt")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.log.Error("Failed to decode two-factor disable request", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	verified, err := h.verifySecondFactor(r.Context(), userID, input.Code, input.RecoveryCode)
+	if err != nil {
+		h.writeSecondFactorError(w, userID, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	if !verified {
+		h.log.Info("Invalid second factor on disable", slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusUnauthorized, "Invalid verification code")
+		return
+	}
+
+	if err := h.repo.DisableTOTP(r.Context(), userID); err != nil {
+		h.log.Error("Failed to disable TOTP", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+
+	h.log.Info("Two-factor authentication disabled", slog.Int64("user_id", userID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Recovery codes regeneration request received")
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized recovery codes regeneration attempt")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.log.Error("Failed to decode recovery codes request", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	verified, err := h.verifySecondFactor(r.Context(), userID, input.Code, "")
+	if err != nil {
+		h.writeSecondFactorError(w, userID, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	if !verified {
+		apierror.Write(w, http.StatusUnauthorized, "Invalid verification code")
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		h.log.Error("Failed to generate recovery codes", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to regenerate recovery codes")
+		return
+	}
+
+	if err := h.repo.ReplaceRecoveryCodes(r.Context(), userID, hashes); err != nil {
+		h.log.Error("Failed to store recovery codes", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to regenerate recovery codes")
+		return
+	}
+
+	h.log.Info("Recovery codes regenerated", slog.Int64("user_id", userID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// Verify completes the second step of Login: it exchanges the pre-auth token
+// and a TOTP or recovery code for a regular access token.
+func (h *TwoFactorHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Two-factor verification request received")
+
+	var input struct {
+		PreAuthToken string `json:"pre_auth_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.log.Error("Failed to decode two-factor verification request", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	userID, err := parsePreAuthToken(h.keys, input.PreAuthToken)
+	if err != nil {
+		h.log.Info("Invalid pre-auth token", sl.Err(err))
+		apierror.Write(w, http.StatusUnauthorized, "Invalid or expired pre-auth token")
+		return
+	}
+
+	verified, err := h.verifySecondFactor(r.Context(), userID, input.Code, input.RecoveryCode)
+	if err != nil {
+		h.writeSecondFactorError(w, userID, err, "Failed to verify code")
+		return
+	}
+
+	if !verified {
+		h.log.Info("Invalid second factor on login", slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusUnauthorized, "Invalid verification code")
+		return
+	}
+
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to fetch user", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+
+	tokenString, err := generateAccessToken(h.keys, user, true)
+	if err != nil {
+		h.log.Error("Failed to generate token", sl.Err(err), slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	h.log.Info("Two-factor verification succeeded", slog.Int64("user_id", userID))
+
+	if err := writeSession(w, h.sessions, tokenString, user, nil, http.StatusOK); err != nil {
+		h.log.Error("Failed to write session", sl.Err(err), slog.Int64("user_id", userID))
+	}
+}
+
+// secondFactorLockedError is returned by verifySecondFactor while the user
+// is locked out after too many invalid codes.
+type secondFactorLockedError struct {
+	retryAfter time.Duration
+}
+
+func (e *secondFactorLockedError) Error() string {
+	return fmt.Sprintf("second factor locked for %s", e.retryAfter)
+}
+
+// verifySecondFactor checks a TOTP or recovery code. TOTP codes are only
+// accepted once per time step, and every rejected code counts towards the
+// lockout configured by TOTP_MAX_ATTEMPTS and TOTP_LOCKOUT.
+func (h *TwoFactorHandler) verifySecondFactor(ctx context.Context, userID int64, code, recoveryCode string) (bool, error) {
+	secret, enabled, err := h.repo.GetTOTPSecret(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if !enabled || secret == "" {
+		return false, nil
+	}
+
+	remaining, err := h.repo.TOTPLockRemaining(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if remaining > 0 {
+		return false, &secondFactorLockedError{retryAfter: remaining}
+	}
+
+	var verified bool
+	switch {
+	case code != "":
+		if step, ok := totp.ValidateStep(code, secret, time.Now()); ok {
+			verified, err = h.repo.AcceptTOTPStep(ctx, userID, step)
+		}
+	case recoveryCode != "":
+		verified, err = h.repo.UseRecoveryCode(ctx, userID, hashRecoveryCode(recoveryCode))
+		if err == nil && verified {
+			err = h.repo.ResetTOTPFailures(ctx, userID)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !verified && h.twoFactor.MaxAttempts > 0 {
+		locked, err := h.repo.RecordTOTPFailure(ctx, userID, h.twoFactor.MaxAttempts, h.twoFactor.Lockout)
+		if err != nil {
+			return false, err
+		}
+		if locked {
+			return false, &secondFactorLockedError{retryAfter: h.twoFactor.Lockout}
+		}
+	}
+
+	return verified, nil
+}
+
+func (h *TwoFactorHandler) writeSecondFactorError(w http.ResponseWriter, userID int64, err error, message string) {
+	var locked *secondFactorLockedError
+	if errors.As(err, &locked) {
+		h.log.Warn("Second factor locked", slog.Int64("user_id", userID), slog.Duration("retry_after", locked.retryAfter))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.retryAfter.Seconds()))))
+		apierror.Write(w, http.StatusTooManyRequests, "Too many invalid verification codes, try again later")
+		return
+	}
+
+	h.log.Error("Failed to verify second factor", sl.Err(err), slog.Int64("user_id", userID))
+	apierror.Write(w, http.StatusInternalServerError, message)
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		raw := hex.EncodeToString(buf)
+		code := raw[:5] + "-" + raw[5:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.TrimSpace(code))
+	normalized = strings.ReplaceAll(normalized, "-", "")
+	normalized = strings.ReplaceAll(normalized, " ", "")
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
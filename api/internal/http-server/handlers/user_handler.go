@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/http-server/middleware"
+	"badJokes/internal/lib/sl"
+	"badJokes/internal/models"
+	"badJokes/internal/storage"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	feedSourceFollowing = "following"
+	feedSourceTrending  = "trending"
+)
+
+type UserHandler struct {
+	userRepo storage.UserRepository
+	jokeRepo storage.JokesRepository
+	log      *slog.Logger
+}
+
+func NewUserHandler(userRepo storage.UserRepository, jokeRepo storage.JokesRepository, log *slog.Logger) *UserHandler {
+	return &UserHandler{
+		userRepo: userRepo,
+		jokeRepo: jokeRepo,
+		log:      log.With(slog.String("component", "user_handler")),
+	}
+}
+
+func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Get profile request received")
+
+	userID, ok := h.userIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	viewerID, _ := r.Context().Value(middleware.UserIDKey).(int64)
+
+	profile, err := h.userRepo.GetProfile(r.Context(), userID, viewerID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.log.Error("Failed to fetch profile",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch profile")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+func (h *UserHandler) Follow(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Follow request received")
+
+	followeeID, followerID, ok := h.followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.userRepo.GetUserByID(r.Context(), followeeID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			apierror.Write(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.log.Error("Failed to fetch user to follow",
+			sl.Err(err),
+			slog.Int64("followee_id", followeeID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to follow user")
+		return
+	}
+
+	if err := h.userRepo.Follow(r.Context(), followerID, followeeID); err != nil {
+		// The target can be deleted between the existence check and the insert.
+		if errors.Is(err, storage.ErrForeignKey) {
+			apierror.Write(w, http.StatusNotFound, "User not found")
+			return
+		}
+		h.log.Error("Failed to follow user",
+			sl.Err(err),
+			slog.Int64("follower_id", followerID),
+			slog.Int64("followee_id", followeeID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to follow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Unfollow request received")
+
+	followeeID, followerID, ok := h.followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.Unfollow(r.Context(), followerID, followeeID); err != nil {
+		h.log.Error("Failed to unfollow user",
+			sl.Err(err),
+			slog.Int64("follower_id", followerID),
+			slog.Int64("followee_id", followeeID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to unfollow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Feed lists jokes from followed authors. Users who follow nobody get the
+// trending list instead, marked by the "source" field.
+func (h *UserHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	h.log.Debug("Feed request received")
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized feed request")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	page, pageSize, sortField, order := parseJokeListParams(r, h.log)
+
+	following, err := h.userRepo.CountFollowing(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Failed to count followed users",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch feed")
+		return
+	}
+
+	var jokes []models.Joke
+	source := feedSourceFollowing
+	if following == 0 {
+		source = feedSourceTrending
+		jokes, err = h.jokeRepo.ListPage(r.Context(), page, pageSize, "hot", "desc", userID)
+	} else {
+		jokes, err = h.jokeRepo.ListFeed(r.Context(), userID, page, pageSize, sortField, order)
+	}
+	if err != nil {
+		h.log.Error("Failed to fetch feed",
+			sl.Err(err),
+			slog.Int64("user_id", userID),
+			slog.String("source", source))
+		apierror.Write(w, http.StatusInternalServerError, "Failed to fetch feed")
+		return
+	}
+
+	if jokes == nil {
+		jokes = []models.Joke{}
+	}
+
+	h.log.Info("Feed fetched successfully",
+		slog.Int64("user_id", userID),
+		slog.String("source", source),
+		slog.Int("count", len(jokes)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jokes":     jokes,
+		"source":    source,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (h *UserHandler) userIDFromPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID, err := pathID(r, "userID")
+	if err != nil {
+		h.log.Warn("Invalid user ID in path", sl.Err(err))
+		apierror.Write(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+
+	return userID, true
+}
+
+func (h *UserHandler) followTarget(w http.ResponseWriter, r *http.Request) (followeeID, followerID int64, ok bool) {
+	followeeID, ok = h.userIDFromPath(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	followerID, ok = r.Context().Value(middleware.UserIDKey).(int64)
+	if !ok {
+		h.log.Warn("Unauthorized follow request")
+		apierror.Write(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, 0, false
+	}
+
+	if followerID == followeeID {
+		apierror.Write(w, http.StatusBadRequest, "You cannot follow yourself")
+		return 0, 0, false
+	}
+
+	return followeeID, followerID, true
+}
@@ -2,13 +2,15 @@ package middleware
 
 import (
 	"badJokes/internal/config"
+	"badJokes/internal/http-server/apierror"
+	"badJokes/internal/http-server/session"
+	"badJokes/internal/lib/jwtkeys"
 	"badJokes/internal/lib/sl"
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
 type key int
@@ -16,17 +18,32 @@ type key int
 const (
 	UserIDKey   key = iota
 	UserAdminKey
+	UserMFAKey
+	UsernameKey
 )
 
+var ErrInvalidToken = errors.New("invalid access token")
+
+type Identity struct {
+	UserID   int64
+	Username string
+	IsAdmin  bool
+	MFA      bool
+}
+
 type AuthMiddleware struct {
-	jwtSecret []byte
-	log       *slog.Logger
+	keys              *jwtkeys.Keyring
+	requireAdminTwoFA bool
+	sessions          *session.Manager
+	log               *slog.Logger
 }
 
-func NewAuthMiddleware(cfg *config.Config, log *slog.Logger) *AuthMiddleware {
+func NewAuthMiddleware(cfg *config.Config, keys *jwtkeys.Keyring, sessions *session.Manager, log *slog.Logger) *AuthMiddleware {
 	return &AuthMiddleware{
-		jwtSecret: []byte(cfg.JWTSecret),
-		log:       log.With(slog.String("component", "auth_middleware")),
+		keys:              keys,
+		requireAdminTwoFA: cfg.TwoFactor.RequireForAdmin,
+		sessions:          sessions,
+		log:               log.With(slog.String("component", "auth_middleware")),
 	}
 }
 
@@ -34,68 +51,94 @@ func (a *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 
-		if authHeader == "" {
-			next.ServeHTTP(w, r)
-			return
-		}
+		var tokenString string
+		switch {
+		case authHeader != "":
+			if !a.sessions.BearerEnabled() {
+				a.log.Debug("Bearer token rejected in cookie session mode")
+				apierror.Write(w, http.StatusUnauthorized, "Bearer authentication is disabled")
+				return
+			}
 
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
-			return
-		}
+			if !strings.HasPrefix(authHeader, "Bearer ") {
+				apierror.Write(w, http.StatusUnauthorized, "Invalid authorization header format")
+				return
+			}
 
-		tokenString := authHeader[len("Bearer "):]
+			tokenString = authHeader[len("Bearer "):]
+		case a.sessions.CookiesEnabled():
+			cookieToken, ok := a.sessions.TokenFromCookie(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
+			if !a.sessions.VerifyCSRF(r) {
+				a.log.Info("CSRF token missing or invalid",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path))
+				apierror.Write(w, http.StatusForbidden, "Invalid CSRF token")
+				return
 			}
-			return a.jwtSecret, nil
-		})
 
-		if err != nil || !token.Valid {
-			a.log.Debug("Invalid token", sl.Err(err))
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			tokenString = cookieToken
+		default:
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
-			a.log.Debug("Invalid token claims")
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		identity, err := a.Authenticate(tokenString)
+		if err != nil {
+			a.log.Debug("Invalid token", sl.Err(err))
+			apierror.Write(w, http.StatusUnauthorized, "Invalid token")
 			return
 		}
 
-		userID, ok := claims["user_id"].(float64)
-		if !ok {
-			a.log.Debug("Invalid user ID in token")
-			http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
-			return
-		}
+		ctx := context.WithValue(r.Context(), UserIDKey, identity.UserID)
+		ctx = context.WithValue(ctx, UsernameKey, identity.Username)
+		ctx = context.WithValue(ctx, UserMFAKey, identity.MFA)
+		ctx = context.WithValue(ctx, UserAdminKey, identity.IsAdmin)
+		ctx = sl.WithAttrs(ctx, slog.Int64("user_id", identity.UserID))
 
-		ctx := context.WithValue(r.Context(), UserIDKey, int64(userID))
-		
-		if isAdmin, ok := claims["is_admin"].(bool); ok {
-			ctx = context.WithValue(ctx, UserAdminKey, isAdmin)
-			a.log.Debug("User authenticated", 
-				slog.Int64("user_id", int64(userID)), 
-				slog.Bool("is_admin", isAdmin))
-		} else {
-			ctx = context.WithValue(ctx, UserAdminKey, false)
-			a.log.Debug("User authenticated (non-admin)", 
-				slog.Int64("user_id", int64(userID)))
-		}
+		a.log.Debug("User authenticated",
+			slog.Int64("user_id", identity.UserID),
+			slog.Bool("is_admin", identity.IsAdmin))
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// Authenticate verifies an access token and returns who it was issued to.
+// Pre-auth and other special-purpose tokens are rejected.
+func (a *AuthMiddleware) Authenticate(tokenString string) (*Identity, error) {
+	claims, err := a.keys.Parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokenType, _ := claims["token_type"].(string); tokenType != "" {
+		return nil, ErrInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	identity := &Identity{UserID: int64(userID)}
+	identity.Username, _ = claims["username"].(string)
+	identity.IsAdmin, _ = claims["is_admin"].(bool)
+	identity.MFA, _ = claims["mfa"].(bool)
+
+	return identity, nil
+}
+
 func (a *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, ok := r.Context().Value(UserIDKey).(int64)
 		if !ok {
 			a.log.Info("Authentication required but not provided")
-			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, "Authentication required")
 			return
 		}
 
@@ -109,7 +152,7 @@ func (a *AuthMiddleware) RequireAdmin(next http.Handler) http.Handler {
 		userID, ok := r.Context().Value(UserIDKey).(int64)
 		if !ok {
 			a.log.Info("Authentication required but not provided")
-			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, "Authentication required")
 			return
 		}
 
@@ -117,10 +160,19 @@ func (a *AuthMiddleware) RequireAdmin(next http.Handler) http.Handler {
 		if !ok || !isAdmin {
 			a.log.Info("Admin privileges required but not granted", 
 				slog.Int64("user_id", userID))
-			http.Error(w, "Forbidden: Admin privileges required", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, "Forbidden: Admin privileges required")
 			return
 		}
 
+		if a.requireAdminTwoFA {
+			if mfa, _ := r.Context().Value(UserMFAKey).(bool); !mfa {
+				a.log.Info("Admin request without two-factor authentication",
+					slog.Int64("user_id", userID))
+				apierror.Write(w, http.StatusForbidden, "Forbidden: Two-factor authentication required for admin access")
+				return
+			}
+		}
+
 		a.log.Debug("Admin request authorized", 
 			slog.Int64("user_id", userID), 
 			slog.Bool("is_admin", isAdmin))
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Deadline bounds each request's context by timeout, so repository queries
+// are cancelled once the server would no longer deliver the response anyway.
+// The write deadline is moved to match, which lets routes that call out to
+// other services run longer than the server's write timeout.
+// Long-lived routes such as event streams and websockets must not use it.
+func Deadline(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Writers that cannot move their deadline keep the server's.
+			_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout))
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
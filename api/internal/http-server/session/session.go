@@ -0,0 +1,161 @@
+package session
+
+import (
+	"badJokes/internal/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ModeBearer = "bearer"
+	ModeCookie = "cookie"
+	ModeBoth   = "both"
+)
+
+// Manager issues and reads the cookie-based session and enforces the
+// double-submit CSRF check: the CSRF cookie is readable by the frontend, which
+// echoes it in a header on every state-changing request.
+type Manager struct {
+	mode           string
+	cookieName     string
+	csrfCookieName string
+	csrfHeaderName string
+	domain         string
+	secure         bool
+	sameSite       http.SameSite
+}
+
+func NewManager(cfg config.Session) *Manager {
+	return &Manager{
+		mode:           cfg.Mode,
+		cookieName:     cfg.CookieName,
+		csrfCookieName: cfg.CSRFCookieName,
+		csrfHeaderName: cfg.CSRFHeaderName,
+		domain:         cfg.CookieDomain,
+		secure:         cfg.CookieSecure,
+		sameSite:       parseSameSite(cfg.SameSite),
+	}
+}
+
+func (m *Manager) BearerEnabled() bool {
+	return m.mode == ModeBearer || m.mode == ModeBoth
+}
+
+func (m *Manager) CookiesEnabled() bool {
+	return m.mode == ModeCookie || m.mode == ModeBoth
+}
+
+func (m *Manager) CSRFHeaderName() string {
+	return m.csrfHeaderName
+}
+
+// Issue stores the token in the session cookie and returns the fresh CSRF
+// token that was set alongside it.
+func (m *Manager) Issue(w http.ResponseWriter, token string, ttl time.Duration) (string, error) {
+	csrfToken, err := generateCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   m.domain,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   m.secure,
+		SameSite: m.sameSite,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.csrfCookieName,
+		Value:    csrfToken,
+		Path:     "/",
+		Domain:   m.domain,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: false,
+		Secure:   m.secure,
+		SameSite: m.sameSite,
+	})
+
+	return csrfToken, nil
+}
+
+func (m *Manager) Clear(w http.ResponseWriter) {
+	for _, name := range []string{m.cookieName, m.csrfCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			Domain:   m.domain,
+			MaxAge:   -1,
+			HttpOnly: name == m.cookieName,
+			Secure:   m.secure,
+			SameSite: m.sameSite,
+		})
+	}
+}
+
+func (m *Manager) TokenFromCookie(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(m.cookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// CSRFToken returns the CSRF token from the request's cookie, so a client
+// that cannot read the cookie itself can recover it after a reload.
+func (m *Manager) CSRFToken(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(m.csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// VerifyCSRF passes safe methods unconditionally and otherwise requires the
+// CSRF header to match the CSRF cookie.
+func (m *Manager) VerifyCSRF(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := r.Cookie(m.csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	header := r.Header.Get(m.csrfHeaderName)
+	if header == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
+
+func generateCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate csrf token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func parseSameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
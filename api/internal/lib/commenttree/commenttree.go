@@ -0,0 +1,117 @@
+// Package commenttree nests the flat rows of a comment thread into the tree
+// returned to clients.
+package commenttree
+
+import (
+	"badJokes/internal/models"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or were issued
+// for a different sort.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Per-thread orderings accepted for sibling comments.
+const (
+	SortBest = "best"
+	SortNew  = "new"
+	SortOld  = "old"
+)
+
+// ValidSort reports whether sort is one of the supported orderings.
+func ValidSort(sort string) bool {
+	switch sort {
+	case SortBest, SortNew, SortOld:
+		return true
+	default:
+		return false
+	}
+}
+
+// Page selects one page of sibling comments: up to Limit of them after the
+// After cursor, each with its replies down to MaxDepth levels below.
+type Page struct {
+	Sort     string
+	MaxDepth int
+	Limit    int
+	After    *Cursor
+}
+
+// Cursor marks the last comment of a page. Sorting is keyed on the score and
+// the id, which increases with creation time and breaks ties.
+type Cursor struct {
+	Sort  string
+	Score int
+	ID    int64
+}
+
+// EncodeCursor returns the opaque cursor that continues after comment.
+func EncodeCursor(sort string, comment models.Comment) string {
+	raw := fmt.Sprintf("%s:%d:%d", sort, comment.Social.Score, comment.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor from EncodeCursor and checks that it was issued
+// for sort.
+func DecodeCursor(sort, value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || parts[0] != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	score, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{Sort: sort, Score: score, ID: id}, nil
+}
+
+// Build nests comments under their parents and returns the shallowest ones.
+// The rows must be ordered by depth with siblings in display order, which is
+// how the recursive thread queries return them.
+func Build(rows []models.Comment) []models.Comment {
+	children := make(map[int64][]models.Comment)
+	roots := []models.Comment{}
+	if len(rows) == 0 {
+		return roots
+	}
+	rootDepth := rows[0].Depth
+
+	// Walking from the deepest rows up means every reply is complete before
+	// it is copied into its parent.
+	for i := len(rows) - 1; i >= 0; i-- {
+		comment := rows[i]
+		comment.Children = reverse(children[comment.ID])
+		delete(children, comment.ID)
+
+		if comment.Depth == rootDepth {
+			roots = append(roots, comment)
+		} else {
+			children[comment.ParentID] = append(children[comment.ParentID], comment)
+		}
+	}
+
+	return reverse(roots)
+}
+
+func reverse(comments []models.Comment) []models.Comment {
+	reversed := make([]models.Comment, len(comments))
+	for i, comment := range comments {
+		reversed[len(comments)-1-i] = comment
+	}
+	return reversed
+}
@@ -0,0 +1,314 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKeyID       = errors.New("unknown key id")
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+	ErrNoSigningKey       = errors.New("no signing key configured")
+)
+
+// Key is a single verification key, identified by the RFC 7638 thumbprint of
+// its public part so every service derives the same kid from the same file.
+type Key struct {
+	ID     string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// Keyring signs tokens with one active private key and verifies tokens with
+// any of the configured public keys, so a new key can be rolled out while
+// tokens signed with the previous one are still accepted.
+//
+// When no signing key is configured the keyring falls back to HS256 with the
+// legacy shared secret. With both configured, HS256 tokens without a kid keep
+// verifying so existing sessions survive the switch to asymmetric signing.
+type Keyring struct {
+	signingKey    crypto.Signer
+	signingMethod jwt.SigningMethod
+	signingKeyID  string
+
+	keys       map[string]*Key
+	order      []string
+	hmacSecret []byte
+}
+
+// Load reads the signing key and the extra verification keys from PEM files.
+// Verification files may hold either public or private keys.
+func Load(signingKeyFile string, verificationKeyFiles []string, legacySecret string) (*Keyring, error) {
+	k := &Keyring{
+		keys: map[string]*Key{},
+	}
+
+	if legacySecret != "" {
+		k.hmacSecret = []byte(legacySecret)
+	}
+
+	if signingKeyFile != "" {
+		block, err := readPEM(signingKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+		}
+
+		key, err := k.add(signer.Public())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", signingKeyFile, err)
+		}
+
+		k.signingKey = signer
+		k.signingMethod = key.method
+		k.signingKeyID = key.ID
+	}
+
+	for _, path := range verificationKeyFiles {
+		if path == "" {
+			continue
+		}
+
+		block, err := readPEM(path)
+		if err != nil {
+			return nil, err
+		}
+
+		public, err := parsePublicKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if _, err := k.add(public); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if k.signingKey == nil && k.hmacSecret == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	return k, nil
+}
+
+// SigningKeyID returns the kid stamped on new tokens, or "" in HS256 mode.
+func (k *Keyring) SigningKeyID() string {
+	return k.signingKeyID
+}
+
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	if k.signingKey == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(k.signingMethod, claims)
+	token.Header["kid"] = k.signingKeyID
+
+	return token.SignedString(k.signingKey)
+}
+
+// Parse verifies the token signature and expiry and returns its claims.
+func (k *Keyring) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, k.keyFunc, jwt.WithValidMethods(k.validMethods()))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
+}
+
+func (k *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && k.hmacSecret != nil {
+			return k.hmacSecret, nil
+		}
+		return nil, ErrUnknownKeyID
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	return key.public, nil
+}
+
+func (k *Keyring) validMethods() []string {
+	methods := []string{}
+	seen := map[string]bool{}
+
+	if k.hmacSecret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+		seen[jwt.SigningMethodHS256.Alg()] = true
+	}
+
+	for _, id := range k.order {
+		alg := k.keys[id].method.Alg()
+		if !seen[alg] {
+			methods = append(methods, alg)
+			seen[alg] = true
+		}
+	}
+
+	return methods
+}
+
+func (k *Keyring) add(public crypto.PublicKey) (*Key, error) {
+	var method jwt.SigningMethod
+	switch public.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKeyType
+	}
+
+	jwk := newJWK(public, method.Alg(), "")
+	key := &Key{
+		ID:     jwk.thumbprint(),
+		method: method,
+		public: public,
+	}
+
+	if _, exists := k.keys[key.ID]; !exists {
+		k.keys[key.ID] = key
+		k.order = append(k.order, key.ID)
+	}
+
+	return k.keys[key.ID], nil
+}
+
+// JWK is the public JSON Web Key representation published in the JWKS.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every verification key so other services can validate tokens.
+// The HS256 legacy secret is never published.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(k.order))}
+	for _, id := range k.order {
+		key := k.keys[id]
+		set.Keys = append(set.Keys, newJWK(key.public, key.method.Alg(), key.ID))
+	}
+	return set
+}
+
+func newJWK(public crypto.PublicKey, alg, kid string) JWK {
+	jwk := JWK{KeyID: kid, Use: "sig", Algorithm: alg}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+
+	return jwk
+}
+
+// thumbprint computes the RFC 7638 thumbprint over the required members in
+// lexicographic order.
+func (j JWK) thumbprint() string {
+	var canonical string
+	switch j.KeyType {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, j.E, j.N)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, j.Curve, j.X)
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case ed25519.PrivateKey:
+			return key, nil
+		}
+	}
+
+	return nil, ErrUnsupportedKeyType
+}
+
+func parsePublicKey(block *pem.Block) (crypto.PublicKey, error) {
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	signer, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
@@ -0,0 +1,68 @@
+// Package mentions finds @username references in joke and comment bodies.
+package mentions
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MaxPerBody caps how many distinct users one body can mention.
+const MaxPerBody = 20
+
+// Usernames are 3 to 20 characters long.
+const (
+	minNameLength = 3
+	maxNameLength = 20
+)
+
+// pattern matches "@" followed by a run of the characters usernames may
+// contain. The "@" must not follow a name character, so e-mail addresses are
+// not taken for mentions. RE2 has no lookahead, so the character ending the
+// name is captured by the last group, and Find resumes scanning at it so that
+// it can also open the next mention.
+var pattern = regexp.MustCompile(`(?:^|[^a-zA-Z0-9._@-])(@([a-zA-Z0-9._-]+))([^a-zA-Z0-9._@-]|$)`)
+
+// Span is one "@username" token: the name without the "@" and the byte
+// offsets of the whole token in the body.
+type Span struct {
+	Username string
+	Start    int
+	End      int
+}
+
+// Find returns the mentions in body in order of appearance. A trailing dot is
+// treated as punctuation rather than part of the name. Tokens too long to be
+// a username are skipped rather than cut down to one.
+func Find(body string) []Span {
+	var spans []Span
+	seen := make(map[string]bool)
+
+	for offset := 0; offset < len(body); {
+		match := pattern.FindStringSubmatchIndex(body[offset:])
+		if match == nil {
+			break
+		}
+		for i := range match {
+			match[i] += offset
+		}
+		offset = match[6]
+
+		start, end := match[2], match[3]
+		username := strings.TrimRight(body[match[4]:match[5]], ".")
+		end -= match[5] - match[4] - len(username)
+		if len(username) < minNameLength || len(username) > maxNameLength {
+			continue
+		}
+
+		if !seen[username] {
+			if len(seen) == MaxPerBody {
+				continue
+			}
+			seen[username] = true
+		}
+
+		spans = append(spans, Span{Username: username, Start: start, End: end})
+	}
+
+	return spans
+}
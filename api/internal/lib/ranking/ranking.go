@@ -0,0 +1,73 @@
+// Package ranking computes the precomputed sort keys stored on jokes.
+//
+// The "hot" score follows the Reddit formula: the order of magnitude of a
+// joke's points plus its creation time scaled by a decay constant. Because
+// the time term grows for newer jokes instead of shrinking for older ones,
+// the stored value never goes stale and only has to be refreshed when the
+// points change.
+//
+// The "rising" score is vote velocity instead: the net votes a joke collected
+// within VelocityWindow per hour of its age. It changes as votes leave the
+// window, so recent jokes have to be re-ranked periodically.
+package ranking
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// epoch keeps the time term small enough for float precision.
+	epoch = 1134028003
+
+	// HotDecay is how many seconds of age cost as much as a tenfold
+	// difference in points for the "hot" sort.
+	HotDecay = 45000
+
+	// RisingWindow limits "rising" to jokes posted this recently, and
+	// VelocityWindow is how far back votes count towards their velocity.
+	RisingWindow   = 24 * time.Hour
+	VelocityWindow = time.Hour
+
+	// minRisingAge stops a joke posted seconds ago from dividing its first
+	// vote by a near-zero age.
+	minRisingAge = time.Hour
+
+	commentWeight  = 1.0
+	reactionWeight = 0.5
+)
+
+// Points weighs the engagement of a joke into a single number.
+func Points(netVotes, reactions, comments int) float64 {
+	return float64(netVotes) + reactionWeight*float64(reactions) + commentWeight*float64(comments)
+}
+
+func Hot(points float64, createdAt time.Time) float64 {
+	sign := 0.0
+	if points > 0 {
+		sign = 1
+	} else if points < 0 {
+		sign = -1
+	}
+
+	order := math.Log10(math.Max(math.Abs(points), 1))
+	seconds := float64(createdAt.Unix() - epoch)
+	return sign*order + seconds/HotDecay
+}
+
+// Rising divides the net votes cast within VelocityWindow by the joke's age
+// in hours, so a young joke gaining votes quickly outranks an older one that
+// collected the same votes more slowly.
+func Rising(recentVotes int, age time.Duration) float64 {
+	hours := math.Max(age.Hours(), minRisingAge.Hours())
+	return float64(recentVotes) / hours
+}
+
+// TopPeriods maps the "top_*" sort fields to how far back they look. Zero
+// means all time.
+var TopPeriods = map[string]time.Duration{
+	"top_day":   24 * time.Hour,
+	"top_week":  7 * 24 * time.Hour,
+	"top_month": 30 * 24 * time.Hour,
+	"top_all":   0,
+}
@@ -10,6 +10,7 @@ type Joke struct {
 	ModifiedAt     string             `json:"modified_at"`
 	Social         SocialInteractions `json:"social"`
 	CommentCount   int                `json:"comment_count"`
+	Mentions       []Mention          `json:"mentions"`
 }
 
 type Comment struct {
@@ -25,21 +26,78 @@ type Comment struct {
 	AuthorID       int64              `json:"author_id"`
 	AuthorUsername string             `json:"author_username"`
     IsDeleted      bool               `json:"is_deleted"`
+	Mentions       []Mention          `json:"mentions"`
+	// Depth, ReplyCount and Children are filled in thread responses. Depth is
+	// 0 for top-level comments; ReplyCount counts direct replies, including
+	// those beyond the depth limit that Children leaves out.
+	Depth      int       `json:"depth"`
+	ReplyCount int       `json:"reply_count"`
+	Children   []Comment `json:"children"`
 }
 
+// Mention is a resolved @username in a joke or comment body. Start and End
+// are the byte offsets of the "@username" token in the body.
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// UserMention is a joke or comment that mentions a user, as listed by
+// GET /api/mentions.
+type UserMention struct {
+	ID             int64  `json:"id"`
+	EntityType     string `json:"entity_type"`
+	EntityID       int64  `json:"entity_id"`
+	JokeID         int64  `json:"joke_id"`
+	AuthorID       int64  `json:"author_id"`
+	AuthorUsername string `json:"author_username"`
+	Body           string `json:"body"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// SocialInteractions holds the vote tallies of a joke or comment. Score is
+// the net vote, Pluses minus Minuses.
 type SocialInteractions struct {
 	Pluses    int              `json:"pluses"`
 	Minuses   int              `json:"minuses"`
+	Score     int              `json:"score"`
 	Reactions map[string]int   `json:"reactions"`
 	User      *UserInteraction `json:"user,omitempty"`
 }
 
 type UserInteraction struct {
-	VoteType  string   `json:"vote_type,omitempty"`
-	Reactions []string `json:"reactions,omitempty"`
+	VoteType   string   `json:"vote_type,omitempty"`
+	Reactions  []string `json:"reactions,omitempty"`
+	Bookmarked bool     `json:"bookmarked,omitempty"`
+}
+
+// BookmarkCollection is one of a user's bookmark collections. The unnamed
+// collection holds bookmarks saved without one.
+type BookmarkCollection struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
 }
 
 type JokeWithComments struct {
-	Joke     Joke      `json:"joke"`
-	Comments []Comment `json:"comments"`
+	Joke       Joke      `json:"joke"`
+	Comments   []Comment `json:"comments"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// CommentThread is the permalink view of a comment: the chain of comments
+// above it, root first, and the comment with a page of its replies as
+// Children.
+type CommentThread struct {
+	Ancestors  []Comment `json:"ancestors"`
+	Comment    Comment   `json:"comment"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// CommentPage is one page of sibling comments with their reply trees.
+// NextCursor is empty on the last page.
+type CommentPage struct {
+	Comments   []Comment `json:"comments"`
+	NextCursor string    `json:"next_cursor,omitempty"`
 }
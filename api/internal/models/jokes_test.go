@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSocialInteractionsJSONKeys(t *testing.T) {
+	social := SocialInteractions{Pluses: 3, Minuses: 1, Score: 2, Reactions: map[string]int{"laugh": 2}}
+	withUser := social
+	withUser.User = &UserInteraction{VoteType: "plus"}
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		wantUser bool
+	}{
+		{"joke", Joke{Social: social}, false},
+		{"joke with user", Joke{Social: withUser}, true},
+		{"comment", Comment{Social: social}, false},
+		{"comment with user", Comment{Social: withUser}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+
+			var body struct {
+				Social map[string]json.RawMessage `json:"social"`
+			}
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			want := map[string]string{
+				"pluses":    "3",
+				"minuses":   "1",
+				"score":     "2",
+				"reactions": `{"laugh":2}`,
+			}
+			for key, value := range want {
+				got, ok := body.Social[key]
+				if !ok {
+					t.Errorf("social.%s missing in %s", key, data)
+					continue
+				}
+				if string(got) != value {
+					t.Errorf("social.%s = %s, want %s", key, got, value)
+				}
+			}
+
+			if _, ok := body.Social["user"]; ok != tt.wantUser {
+				t.Errorf("social.user present = %v, want %v in %s", ok, tt.wantUser, data)
+			}
+			if len(body.Social) != len(want)+btoi(tt.wantUser) {
+				t.Errorf("social has unexpected keys: %s", data)
+			}
+		})
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
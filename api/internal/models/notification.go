@@ -0,0 +1,30 @@
+package models
+
+const (
+	NotificationReply    = "reply"
+	NotificationComment  = "comment"
+	NotificationVote     = "vote"
+	NotificationReaction = "reaction"
+)
+
+// NotificationTypes lists every event a user can receive or mute.
+var NotificationTypes = []string{
+	NotificationReply,
+	NotificationComment,
+	NotificationVote,
+	NotificationReaction,
+}
+
+type Notification struct {
+	ID                int64  `json:"id"`
+	Type              string `json:"type"`
+	EntityType        string `json:"entity_type"`
+	EntityID          int64  `json:"entity_id"`
+	JokeID            int64  `json:"joke_id"`
+	LastActorID       int64  `json:"last_actor_id,omitempty"`
+	LastActorUsername string `json:"last_actor_username,omitempty"`
+	EventCount        int    `json:"event_count"`
+	Read              bool   `json:"read"`
+	CreatedAt         string `json:"created_at"`
+	UpdatedAt         string `json:"updated_at"`
+}
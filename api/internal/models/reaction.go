@@ -0,0 +1,11 @@
+package models
+
+// Reaction is an entry of the reaction catalog. Disabled reactions can no
+// longer be added but are still listed so existing counts can be rendered.
+type Reaction struct {
+	Key       string `json:"key"`
+	Emoji     string `json:"emoji"`
+	Label     string `json:"label"`
+	SortOrder int    `json:"sort_order"`
+	Enabled   bool   `json:"enabled"`
+}
@@ -1,12 +1,13 @@
 package models
 
 type User struct {
-	ID         int64  `json:"id"`
-	Username   string `json:"username"`
-	Email      string `json:"email"`
-	IsAdmin    bool   `json:"is_admin"`
-	CreatedAt  string `json:"created_at"`
-	ModifiedAt string `json:"modified_at"`
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	IsAdmin     bool   `json:"is_admin"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	CreatedAt   string `json:"created_at"`
+	ModifiedAt  string `json:"modified_at"`
 }
 
 type ModerationLog struct {
@@ -34,4 +35,13 @@ type ActiveUser struct {
 	Username      string `json:"username"`
 	JokesCount    int    `json:"jokes_count"`
 	CommentsCount int    `json:"comments_count"`
-}
\ No newline at end of file
+}
+type UserProfile struct {
+	ID             int64  `json:"id"`
+	Username       string `json:"username"`
+	CreatedAt      string `json:"created_at"`
+	JokesCount     int    `json:"jokes_count"`
+	FollowersCount int    `json:"followers_count"`
+	FollowingCount int    `json:"following_count"`
+	IsFollowing    bool   `json:"is_following"`
+}
@@ -0,0 +1,267 @@
+package oauth
+
+import (
+	"badJokes/internal/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownProvider    = errors.New("unknown oauth provider")
+	ErrMissingIDToken     = errors.New("id_token missing from token response")
+	ErrNonceMismatch      = errors.New("id_token nonce mismatch")
+	ErrMissingSubject     = errors.New("subject claim missing from provider response")
+	ErrIncompleteEndpoint = errors.New("provider needs an issuer or auth and token urls")
+)
+
+// UserInfo is the identity a provider vouched for. EmailVerified is only set
+// when the provider confirmed the address or is configured with trust_email;
+// unverified emails must never be used to link to an existing account.
+type UserInfo struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+}
+
+type Provider struct {
+	name        string
+	cfg         config.OAuthProvider
+	redirectURL string
+
+	mu          sync.Mutex
+	oauth       *oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+	userInfoURL string
+}
+
+func NewProviders(cfg *config.Config) map[string]*Provider {
+	providers := make(map[string]*Provider, len(cfg.OAuth.Providers))
+	for name, providerCfg := range cfg.OAuth.Providers {
+		providers[name] = &Provider{
+			name:        name,
+			cfg:         providerCfg,
+			redirectURL: cfg.OAuth.BaseURL + "/api/auth/" + name + "/callback",
+		}
+	}
+	return providers
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// IsOIDC reports whether the provider verifies an ID token and therefore
+// needs a nonce on the authorization request.
+func (p *Provider) IsOIDC() bool {
+	return p.cfg.Issuer != ""
+}
+
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce string, opts ...oauth2.AuthCodeOption) (string, error) {
+	conf, _, err := p.setup(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if p.IsOIDC() {
+		opts = append(opts, oidc.Nonce(nonce))
+	}
+
+	return conf.AuthCodeURL(state, opts...), nil
+}
+
+func (p *Provider) Exchange(ctx context.Context, code, nonce string, opts ...oauth2.AuthCodeOption) (*UserInfo, error) {
+	conf, verifier, err := p.setup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := conf.Exchange(ctx, code, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	claims := map[string]interface{}{}
+
+	if verifier != nil {
+		rawIDToken, ok := token.Extra("id_token").(string)
+		if !ok || rawIDToken == "" {
+			return nil, ErrMissingIDToken
+		}
+
+		idToken, err := verifier.Verify(ctx, rawIDToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify id_token: %w", err)
+		}
+
+		if idToken.Nonce != nonce {
+			return nil, ErrNonceMismatch
+		}
+
+		if err := idToken.Claims(&claims); err != nil {
+			return nil, fmt.Errorf("failed to decode id_token claims: %w", err)
+		}
+	}
+
+	client := conf.Client(ctx, token)
+
+	if p.userInfoURL != "" {
+		var userInfoClaims map[string]interface{}
+		if err := getJSON(ctx, client, p.userInfoURL, &userInfoClaims); err != nil {
+			return nil, fmt.Errorf("failed to fetch user info: %w", err)
+		}
+		for k, v := range userInfoClaims {
+			if _, ok := claims[k]; !ok {
+				claims[k] = v
+			}
+		}
+	}
+
+	info := &UserInfo{
+		Subject:       claimString(claims, p.cfg.Claims.Subject),
+		Email:         claimString(claims, p.cfg.Claims.Email),
+		EmailVerified: claimString(claims, "email_verified") == "true" || p.cfg.TrustEmail,
+		Username:      claimString(claims, p.cfg.Claims.Username),
+	}
+
+	if p.cfg.EmailsURL != "" {
+		email, err := primaryVerifiedEmail(ctx, client, p.cfg.EmailsURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch emails: %w", err)
+		}
+		info.Email = email
+		info.EmailVerified = email != ""
+	}
+
+	if info.Subject == "" {
+		return nil, ErrMissingSubject
+	}
+
+	return info, nil
+}
+
+// setup resolves the provider endpoints on first use so that an identity
+// provider being unreachable at boot does not disable it until a restart.
+func (p *Provider) setup(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+
+	endpoint := oauth2.Endpoint{
+		AuthURL:  p.cfg.AuthURL,
+		TokenURL: p.cfg.TokenURL,
+	}
+	userInfoURL := p.cfg.UserInfoURL
+	scopes := p.cfg.Scopes
+
+	var verifier *oidc.IDTokenVerifier
+	if p.cfg.Issuer != "" {
+		discovered, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("oidc discovery for %s failed: %w", p.name, err)
+		}
+
+		if endpoint.AuthURL == "" {
+			endpoint.AuthURL = discovered.Endpoint().AuthURL
+		}
+		if endpoint.TokenURL == "" {
+			endpoint.TokenURL = discovered.Endpoint().TokenURL
+		}
+		if userInfoURL == "" {
+			userInfoURL = discovered.UserInfoEndpoint()
+		}
+		if len(scopes) == 0 {
+			scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+		}
+
+		verifier = discovered.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	}
+
+	if endpoint.AuthURL == "" || endpoint.TokenURL == "" {
+		return nil, nil, fmt.Errorf("%s: %w", p.name, ErrIncompleteEndpoint)
+	}
+
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.redirectURL,
+		Scopes:       scopes,
+		Endpoint:     endpoint,
+	}
+	p.verifier = verifier
+	p.userInfoURL = userInfoURL
+
+	return p.oauth, p.verifier, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func primaryVerifiedEmail(ctx context.Context, client *http.Client, url string) (string, error) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+
+	if err := getJSON(ctx, client, url, &emails); err != nil {
+		return "", err
+	}
+
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return e.Email, nil
+		}
+	}
+
+	return "", nil
+}
+
+func claimString(claims map[string]interface{}, key string) string {
+	if key == "" {
+		return ""
+	}
+
+	switch v := claims[key].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
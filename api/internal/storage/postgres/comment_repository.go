@@ -1,8 +1,10 @@
 package postgres
 
 import (
+	"badJokes/internal/lib/commenttree"
 	"badJokes/internal/lib/sl"
 	"badJokes/internal/models"
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
@@ -21,63 +23,89 @@ func NewCommentsRepository(db *sql.DB, log *slog.Logger) *CommentsRepository {
 	}
 }
 
-func (r *CommentsRepository) AddComment(jokeID, userID int64, body string, parentID *int64) (int64, error) {
-	r.log.Debug("Adding comment",
+func (r *CommentsRepository) AddComment(ctx context.Context, jokeID, userID int64, body string, parentID *int64) (int64, error) {
+	r.log.DebugContext(ctx, "Adding comment",
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("user_id", userID),
 		slog.String("body_length", fmt.Sprintf("%d chars", len(body))),
 		slog.Int64("parent_id", func() int64 { if parentID != nil { return *parentID } else { return 0 } }()))
 
 	var exists bool
-	err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM jokes WHERE id = $1)", jokeID).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM jokes WHERE id = $1)", jokeID).Scan(&exists)
 	if err != nil {
-		r.log.Error("Failed to check joke existence", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to check joke existence", sl.Err(err))
 		return 0, err
 	}
 	if !exists {
-		r.log.Info("Joke not found", slog.Int64("joke_id", jokeID))
+		r.log.InfoContext(ctx, "Joke not found", slog.Int64("joke_id", jokeID))
 		return 0, ErrJokeNotFound
 	}
 
 	if parentID != nil {
-		err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1 AND joke_id = $2)",
+		err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1 AND joke_id = $2)",
 			*parentID, jokeID).Scan(&exists)
 		if err != nil {
-			r.log.Error("Failed to check parent comment existence", sl.Err(err))
+			r.log.ErrorContext(ctx, "Failed to check parent comment existence", sl.Err(err))
 			return 0, err
 		}
 		if !exists {
-			r.log.Info("Parent comment not found", slog.Int64("parent_id", *parentID))
+			r.log.InfoContext(ctx, "Parent comment not found", slog.Int64("parent_id", *parentID))
 			return 0, ErrCommentNotFound
 		}
 	}
 
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to begin transaction", sl.Err(err))
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	var id int64
 	query := `
         INSERT INTO comments (joke_id, parent_id, body, user_id, created_at, modified_at)
         VALUES ($1, $2, $3, $4, NOW(), NOW())
         RETURNING id
     `
-	err = r.db.QueryRow(query, jokeID, parentID, body, userID).Scan(&id)
+	err = tx.QueryRowContext(ctx, query, jokeID, parentID, body, userID).Scan(&id)
 	if err != nil {
-		r.log.Error("Failed to insert comment", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to insert comment", sl.Err(err))
+		return 0, err
+	}
+
+	if err := recordMentions(ctx, tx, "comment", id, jokeID, userID, body); err != nil {
+		r.log.ErrorContext(ctx, "Failed to record comment mentions", sl.Err(err), slog.Int64("comment_id", id))
+		return 0, err
+	}
+
+	if err := applyCommentDelta(ctx, tx, jokeID, 1); err != nil {
+		r.log.ErrorContext(ctx, "Failed to update joke comment count", sl.Err(err), slog.Int64("joke_id", jokeID))
+		return 0, err
+	}
+
+	if err := refreshJokeRanking(ctx, tx, r.log, jokeID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.log.ErrorContext(ctx, "Failed to commit comment", sl.Err(err))
 		return 0, err
 	}
 
-	r.log.Info("Comment added successfully", slog.Int64("comment_id", id))
+	r.log.InfoContext(ctx, "Comment added successfully", slog.Int64("comment_id", id))
 	return id, nil
 }
 
-func (r *CommentsRepository) GetComments(jokeID int64) ([]models.Comment, error) {
-	r.log.Debug("Fetching comments", slog.Int64("joke_id", jokeID))
+func (r *CommentsRepository) GetComments(ctx context.Context, jokeID int64) ([]models.Comment, error) {
+	r.log.DebugContext(ctx, "Fetching comments", slog.Int64("joke_id", jokeID))
 
-	rows, err := r.db.Query(`
+	rows, err := r.db.QueryContext(ctx, `
 		SELECT id, joke_id, user_id, body, created_at, modified_at
 		FROM comments
 		WHERE joke_id = $1
 	`, jokeID)
 	if err != nil {
-		r.log.Error("Failed to fetch comments", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to fetch comments", sl.Err(err))
 		return nil, fmt.Errorf("failed to fetch comments: %w", err)
 	}
 	defer rows.Close()
@@ -93,27 +121,81 @@ func (r *CommentsRepository) GetComments(jokeID int64) ([]models.Comment, error)
 			&comment.CreatedAt,
 			&comment.ModifiedAt,
 		); err != nil {
-			r.log.Error("Failed to scan comment", sl.Err(err))
+			r.log.ErrorContext(ctx, "Failed to scan comment", sl.Err(err))
 			return nil, fmt.Errorf("failed to scan comment: %w", err)
 		}
 		comments = append(comments, comment)
 	}
 
 	if err = rows.Err(); err != nil {
-		r.log.Error("Error iterating comment rows", sl.Err(err))
+		r.log.ErrorContext(ctx, "Error iterating comment rows", sl.Err(err))
 		return nil, fmt.Errorf("error iterating comment rows: %w", err)
 	}
 
-	r.log.Debug("Comments fetched successfully", slog.Int("count", len(comments)))
+	r.log.DebugContext(ctx, "Comments fetched successfully", slog.Int("count", len(comments)))
 	return comments, nil
 }
 
-func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([]models.Comment, error) {
-	r.log.Debug("Fetching comments by joke ID",
+// GetTopLevelComments returns a page of the joke's top-level comments, each
+// with its replies down to page.MaxDepth levels.
+func (r *CommentsRepository) GetTopLevelComments(ctx context.Context, jokeID, currentUserID int64, page commenttree.Page) (models.CommentPage, error) {
+	r.log.DebugContext(ctx, "Fetching top-level comments",
 		slog.Int64("joke_id", jokeID),
+		slog.Int64("current_user_id", currentUserID),
+		slog.String("sort", page.Sort))
+
+	return r.commentPage(ctx, "c.joke_id = $1 AND c.parent_id IS NULL", jokeID, 0, currentUserID, page)
+}
+
+// GetReplies returns a page of the direct replies to parentID, each with its
+// own replies down to page.MaxDepth levels. A missing parent yields
+// ErrCommentNotFound.
+func (r *CommentsRepository) GetReplies(ctx context.Context, parentID, currentUserID int64, page commenttree.Page) (models.CommentPage, error) {
+	r.log.DebugContext(ctx, "Fetching comment replies",
+		slog.Int64("parent_id", parentID),
+		slog.Int64("current_user_id", currentUserID),
+		slog.String("sort", page.Sort))
+
+	// The parent's ancestor chain, itself included, is as long as the depth of
+	// its replies.
+	var depth int
+	err := r.db.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM comments WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.parent_id FROM comments c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT COUNT(*) FROM ancestors`, parentID).Scan(&depth)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to resolve comment depth", sl.Err(err), slog.Int64("parent_id", parentID))
+		return models.CommentPage{}, err
+	}
+	if depth == 0 {
+		return models.CommentPage{}, ErrCommentNotFound
+	}
+
+	return r.commentPage(ctx, "c.parent_id = $1", parentID, depth, currentUserID, page)
+}
+
+// GetCommentThread returns commentID with its ancestors and a page of its
+// replies. A missing comment yields ErrCommentNotFound.
+func (r *CommentsRepository) GetCommentThread(ctx context.Context, commentID, currentUserID int64, page commenttree.Page) (models.CommentThread, error) {
+	r.log.DebugContext(ctx, "Fetching comment thread",
+		slog.Int64("comment_id", commentID),
 		slog.Int64("current_user_id", currentUserID))
 
-	query := `
+	// chain.depth counts up from the requested comment and is flipped into
+	// the usual top-down depth once the whole chain is known.
+	rows, err := r.db.QueryContext(ctx, `
+        WITH RECURSIVE chain AS (
+            SELECT id, parent_id, 0 AS depth
+            FROM comments
+            WHERE id = $1
+            UNION ALL
+            SELECT c.id, c.parent_id, ch.depth + 1
+            FROM comments c
+            JOIN chain ch ON c.id = ch.parent_id
+        )
         SELECT 
             c.id,
             c.joke_id,
@@ -124,48 +206,257 @@ func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([
             c.created_at,
             c.is_deleted,
             c.modified_at,
-            (
-                SELECT COALESCE(SUM(CASE WHEN vote_type = 'plus' THEN 1 WHEN vote_type = 'minus' THEN -1 ELSE 0 END), 0)
-                FROM votes WHERE entity_id = c.id AND entity_type = 'comment'
-            ) AS vote_count,
-            (
-                SELECT json_object_agg(type, count) 
-                FROM (
-                    SELECT type, COUNT(*) as count 
-                    FROM interactions 
-                    WHERE entity_id = c.id AND entity_type = 'comment' 
-                    GROUP BY type
-                ) reaction_counts
-            ) AS reactions_json,
+            c.pluses,
+            c.minuses,
+            c.score,
+            c.reaction_counts,
+            c.mentions,
+            t.depth,
+            (SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count,
             COALESCE(uv.vote_type, '') AS user_vote,
             COALESCE(
                 (SELECT array_to_string(array_agg(type), ',')
                  FROM interactions 
-                 WHERE entity_id = c.id AND entity_type = 'comment' AND user_id = $1), 
+                 WHERE entity_id = c.id AND entity_type = 'comment' AND user_id = $2), 
                 ''
             ) AS user_reactions
-        FROM comments c
+        FROM chain t
+        JOIN comments c ON c.id = t.id
         JOIN users u ON c.user_id = u.id
         LEFT JOIN votes uv ON c.id = uv.entity_id AND uv.entity_type = 'comment' AND uv.user_id = $2
-        WHERE c.joke_id = $3
-        ORDER BY 
-            CASE WHEN c.parent_id IS NULL THEN c.id ELSE c.parent_id END ASC,
-            c.parent_id IS NOT NULL ASC,
-            c.created_at ASC
+        ORDER BY t.depth DESC
+    `, commentID, currentUserID)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to fetch comment chain", sl.Err(err), slog.Int64("comment_id", commentID))
+		return models.CommentThread{}, err
+	}
+	defer rows.Close()
+
+	chain, err := scanThread(rows)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to scan comment chain", sl.Err(err), slog.Int64("comment_id", commentID))
+		return models.CommentThread{}, err
+	}
+	if len(chain) == 0 {
+		return models.CommentThread{}, ErrCommentNotFound
+	}
+
+	replies, err := r.GetReplies(ctx, commentID, currentUserID, page)
+	if err != nil {
+		return models.CommentThread{}, err
+	}
+
+	return buildCommentThread(chain, replies), nil
+}
+
+// commentPage loads the page of siblings matching seed, whose only parameter
+// is seedID, together with their reply trees.
+func (r *CommentsRepository) commentPage(ctx context.Context, seed string, seedID int64, depth int, currentUserID int64, page commenttree.Page) (models.CommentPage, error) {
+	args := []interface{}{seedID}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := seed
+	if page.After != nil {
+		where += " AND " + cursorCondition(page.Sort, arg(page.After.Score), arg(page.After.ID))
+	}
+
+	query := `
+        WITH RECURSIVE page AS (
+            SELECT c.id, c.score
+            FROM comments c
+            WHERE ` + where + `
+            ORDER BY ` + commentOrder(page.Sort) + `
+            LIMIT ` + arg(page.Limit+1) + `
+        ),
+        thread AS (
+            SELECT id, ` + arg(depth) + `::integer AS depth
+            FROM page
+            UNION ALL
+            SELECT c.id, t.depth + 1
+            FROM comments c
+            JOIN thread t ON c.parent_id = t.id
+            WHERE t.depth < ` + arg(depth+page.MaxDepth) + `
+        )
+        SELECT 
+            c.id,
+            c.joke_id,
+            c.parent_id,
+            c.body,
+            c.user_id,
+            u.username AS author_username,
+            c.created_at,
+            c.is_deleted,
+            c.modified_at,
+            c.pluses,
+            c.minuses,
+            c.score,
+            c.reaction_counts,
+            c.mentions,
+            t.depth,
+            (SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count,
+            COALESCE(uv.vote_type, '') AS user_vote,
+            COALESCE(
+                (SELECT array_to_string(array_agg(type), ',')
+                 FROM interactions 
+                 WHERE entity_id = c.id AND entity_type = 'comment' AND user_id = ` + arg(currentUserID) + `), 
+                ''
+            ) AS user_reactions
+        FROM thread t
+        JOIN comments c ON c.id = t.id
+        JOIN users u ON c.user_id = u.id
+        LEFT JOIN votes uv ON c.id = uv.entity_id AND uv.entity_type = 'comment' AND uv.user_id = ` + arg(currentUserID) + `
+        ORDER BY t.depth, ` + commentOrder(page.Sort) + `
     `
 
-	rows, err := r.db.Query(query, currentUserID, currentUserID, jokeID)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		r.log.Error("Failed to fetch comments by joke ID", sl.Err(err))
-		return nil, err
+		r.log.ErrorContext(ctx, "Failed to fetch comment page", sl.Err(err))
+		return models.CommentPage{}, err
 	}
 	defer rows.Close()
 
+	comments, err := scanThread(rows)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to scan comment page", sl.Err(err))
+		return models.CommentPage{}, err
+	}
+
+	r.log.DebugContext(ctx, "Comments fetched successfully", slog.Int("count", len(comments)))
+	return paginate(comments, page), nil
+}
+
+func (r *CommentsRepository) DeleteComment(ctx context.Context, commentID int64) error {
+	r.log.InfoContext(ctx, "Deleting comment", slog.Int64("comment_id", commentID))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to begin transaction", sl.Err(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	var jokeID int64
+	err = tx.QueryRowContext(ctx, "UPDATE comments SET is_deleted = TRUE WHERE id = $1 AND is_deleted = FALSE RETURNING joke_id",
+		commentID).Scan(&jokeID)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1)", commentID).Scan(&exists); err != nil {
+			r.log.ErrorContext(ctx, "Failed to check comment existence", sl.Err(err))
+			return err
+		}
+		if !exists {
+			r.log.InfoContext(ctx, "Comment not found", slog.Int64("comment_id", commentID))
+			return ErrCommentNotFound
+		}
+		r.log.DebugContext(ctx, "Comment already deleted", slog.Int64("comment_id", commentID))
+		return nil
+	}
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to delete comment", sl.Err(err))
+		return err
+	}
+
+	if err := applyCommentDelta(ctx, tx, jokeID, -1); err != nil {
+		r.log.ErrorContext(ctx, "Failed to update joke comment count", sl.Err(err), slog.Int64("joke_id", jokeID))
+		return err
+	}
+
+	if err := clearCommentSocial(ctx, tx, commentID); err != nil {
+		r.log.ErrorContext(ctx, "Failed to clean up comment votes and reactions", sl.Err(err), slog.Int64("comment_id", commentID))
+		return err
+	}
+
+	if err := refreshJokeRanking(ctx, tx, r.log, jokeID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.log.ErrorContext(ctx, "Failed to commit comment deletion", sl.Err(err))
+		return err
+	}
+
+	r.log.InfoContext(ctx, "Comment deleted successfully", slog.Int64("comment_id", commentID))
+	return nil
+}
+
+func (r *CommentsRepository) GetCommentByID(ctx context.Context, commentID int64) (models.Comment, error) {
+	r.log.DebugContext(ctx, "Fetching comment by ID", slog.Int64("comment_id", commentID))
+
+	query := `
+		SELECT 
+			c.id, 
+			c.joke_id, 
+			c.parent_id, 
+			c.body, 
+			c.user_id,
+			u.username AS author_username,
+			c.created_at, 
+			c.modified_at,
+			c.is_deleted,
+			c.pluses,
+			c.minuses,
+			c.score,
+			c.reaction_counts,
+			c.mentions
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.id = $1
+	`
+
+	var comment models.Comment
+	var parentID sql.NullInt64
+	var reactionsJSON sql.NullString
+	var mentionsJSON sql.NullString
+
+	err := r.db.QueryRowContext(ctx, query, commentID).Scan(
+		&comment.ID,
+		&comment.JokeID,
+		&parentID,
+		&comment.Body,
+		&comment.AuthorID,
+		&comment.AuthorUsername,
+		&comment.CreatedAt,
+		&comment.ModifiedAt,
+		&comment.IsDeleted,
+		&comment.Social.Pluses,
+		&comment.Social.Minuses,
+		&comment.Social.Score,
+		&reactionsJSON,
+		&mentionsJSON,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.log.InfoContext(ctx, "Comment not found", slog.Int64("comment_id", commentID))
+			return comment, ErrCommentNotFound
+		}
+		r.log.ErrorContext(ctx, "Failed to fetch comment by ID", sl.Err(err))
+		return comment, err
+	}
+
+	if parentID.Valid {
+		comment.ParentID = parentID.Int64
+	}
+	comment.Social.Reactions = decodeReactionCounts(reactionsJSON)
+	comment.Mentions = decodeMentions(mentionsJSON)
+
+	r.log.DebugContext(ctx, "Comment fetched successfully", slog.Int64("comment_id", commentID))
+	return comment, nil
+}
+
+// scanThread reads the rows of a thread query, which select the comment
+// columns followed by depth, reply count and the current user's vote and
+// reactions.
+func scanThread(rows *sql.Rows) ([]models.Comment, error) {
 	var comments []models.Comment
 	for rows.Next() {
 		var comment models.Comment
 		var parentID sql.NullInt64
 		var reactionsJSON sql.NullString
+		var mentionsJSON sql.NullString
 		var userVote sql.NullString
 		var userReactions sql.NullString
 
@@ -180,11 +471,15 @@ func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([
 			&comment.IsDeleted,
 			&comment.ModifiedAt,
 			&comment.Social.Pluses,
+			&comment.Social.Minuses,
+			&comment.Social.Score,
 			&reactionsJSON,
+			&mentionsJSON,
+			&comment.Depth,
+			&comment.ReplyCount,
 			&userVote,
 			&userReactions,
 		); err != nil {
-			r.log.Error("Failed to scan comment", sl.Err(err))
 			return nil, err
 		}
 
@@ -192,24 +487,8 @@ func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([
 			comment.ParentID = parentID.Int64
 		}
 
-		reactionMap := map[string]int{}
-		if reactionsJSON.Valid && reactionsJSON.String != "" && reactionsJSON.String != "null" {
-			jsonStr := strings.Trim(reactionsJSON.String, "{}")
-			if jsonStr != "" {
-				pairs := strings.Split(jsonStr, ",")
-				for _, pair := range pairs {
-					kv := strings.Split(pair, ":")
-					if len(kv) == 2 {
-						key := strings.Trim(kv[0], "\" ")
-						val := strings.Trim(kv[1], " ")
-						count := 0
-						fmt.Sscanf(val, "%d", &count)
-						reactionMap[key] = count
-					}
-				}
-			}
-		}
-		comment.Social.Reactions = reactionMap
+		comment.Social.Reactions = decodeReactionCounts(reactionsJSON)
+		comment.Mentions = decodeMentions(mentionsJSON)
 
 		if userVote.Valid && userVote.String != "" {
 			comment.Social.User = &models.UserInteraction{VoteType: userVote.String}
@@ -228,89 +507,71 @@ func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([
 
 		if comment.IsDeleted {
 			comment.Body = ""
+			comment.Mentions = []models.Mention{}
 		}
 
 		comments = append(comments, comment)
 	}
 
-	if err = rows.Err(); err != nil {
-		r.log.Error("Error iterating comment rows", sl.Err(err))
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	r.log.Debug("Comments fetched successfully", slog.Int("count", len(comments)))
 	return comments, nil
 }
 
-func (r *CommentsRepository) DeleteComment(commentID int64) error {
-	r.log.Info("Deleting comment", slog.Int64("comment_id", commentID))
-
-	result, err := r.db.Exec("UPDATE comments SET is_deleted = TRUE WHERE id = $1", commentID)
-	if err != nil {
-		r.log.Error("Failed to delete comment", sl.Err(err))
-		return err
+// buildCommentThread turns the chain, read root first with depths counted
+// upwards, into a CommentThread around its last element.
+func buildCommentThread(chain []models.Comment, replies models.CommentPage) models.CommentThread {
+	top := chain[0].Depth
+	for i := range chain {
+		chain[i].Depth = top - chain[i].Depth
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		r.log.Error("Failed to get rows affected", sl.Err(err))
-		return err
-	}
+	comment := chain[len(chain)-1]
+	comment.Children = replies.Comments
 
-	if rowsAffected == 0 {
-		r.log.Info("Comment not found", slog.Int64("comment_id", commentID))
-		return ErrCommentNotFound
+	return models.CommentThread{
+		Ancestors:  chain[:len(chain)-1],
+		Comment:    comment,
+		NextCursor: replies.NextCursor,
 	}
-
-	r.log.Info("Comment deleted successfully", slog.Int64("comment_id", commentID))
-	return nil
 }
 
-func (r *CommentsRepository) GetCommentByID(commentID int64) (models.Comment, error) {
-	r.log.Debug("Fetching comment by ID", slog.Int64("comment_id", commentID))
-
-	query := `
-		SELECT 
-			c.id, 
-			c.joke_id, 
-			c.parent_id, 
-			c.body, 
-			c.user_id,
-			u.username AS author_username,
-			c.created_at, 
-			c.modified_at
-		FROM comments c
-		JOIN users u ON c.user_id = u.id
-		WHERE c.id = $1
-	`
-
-	var comment models.Comment
-	var parentID sql.NullInt64
-
-	err := r.db.QueryRow(query, commentID).Scan(
-		&comment.ID,
-		&comment.JokeID,
-		&parentID,
-		&comment.Body,
-		&comment.AuthorID,
-		&comment.AuthorUsername,
-		&comment.CreatedAt,
-		&comment.ModifiedAt,
-	)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			r.log.Info("Comment not found", slog.Int64("comment_id", commentID))
-			return comment, ErrCommentNotFound
-		}
-		r.log.Error("Failed to fetch comment by ID", sl.Err(err))
-		return comment, err
+// commentOrder is the ORDER BY applied among sibling comments. Comment ids
+// increase with creation time, so they give the chronological orders and
+// break ties in a way cursors can resume from.
+func commentOrder(sort string) string {
+	switch sort {
+	case commenttree.SortBest:
+		return "c.score DESC, c.id ASC"
+	case commenttree.SortNew:
+		return "c.id DESC"
+	default:
+		return "c.id ASC"
 	}
+}
 
-	if parentID.Valid {
-		comment.ParentID = parentID.Int64
+// cursorCondition restricts a page to the comments after the cursor's score
+// and id placeholders in commentOrder.
+func cursorCondition(sort, score, id string) string {
+	switch sort {
+	case commenttree.SortBest:
+		return "(c.score < " + score + " OR (c.score = " + score + " AND c.id > " + id + "))"
+	case commenttree.SortNew:
+		return "c.id < " + id
+	default:
+		return "c.id > " + id
 	}
+}
 
-	r.log.Debug("Comment fetched successfully", slog.Int64("comment_id", commentID))
-	return comment, nil
-}
\ No newline at end of file
+// paginate nests the rows and trims the extra top-level comment fetched to
+// tell whether another page follows.
+func paginate(comments []models.Comment, page commenttree.Page) models.CommentPage {
+	result := models.CommentPage{Comments: commenttree.Build(comments)}
+	if len(result.Comments) > page.Limit {
+		result.Comments = result.Comments[:page.Limit]
+		result.NextCursor = commenttree.EncodeCursor(page.Sort, result.Comments[page.Limit-1])
+	}
+	return result
+}
@@ -0,0 +1,256 @@
+package postgres
+
+import (
+	"badJokes/internal/lib/sl"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx so counter updates can run
+// inside the transaction that changed the underlying rows.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// counterTable maps an entity type to the table holding its counters.
+func counterTable(entityType string) (string, error) {
+	switch entityType {
+	case "joke":
+		return "jokes", nil
+	case "comment":
+		return "comments", nil
+	default:
+		return "", fmt.Errorf("unknown entity type %q", entityType)
+	}
+}
+
+// lockCounters locks the entity row so concurrent votes and reactions on it
+// apply their counter deltas one after another. With requireLive a missing
+// joke or a missing or soft-deleted comment is reported as sql.ErrNoRows.
+func lockCounters(ctx context.Context, tx *sql.Tx, table string, entityID int64, requireLive bool) error {
+	query := "SELECT id FROM " + table + " WHERE id = $1"
+	if table == "comments" {
+		query += " AND is_deleted = FALSE"
+	}
+
+	var id int64
+	err := tx.QueryRowContext(ctx, query+" FOR UPDATE", entityID).Scan(&id)
+	if err == sql.ErrNoRows && !requireLive {
+		return nil
+	}
+	return err
+}
+
+// clearCommentSocial drops the votes, reactions, notifications and mentions of
+// a soft-deleted comment and zeroes its counters.
+func clearCommentSocial(ctx context.Context, ex execer, commentID int64) error {
+	if _, err := ex.ExecContext(ctx, "DELETE FROM votes WHERE entity_type = 'comment' AND entity_id = $1", commentID); err != nil {
+		return err
+	}
+	if _, err := ex.ExecContext(ctx, "DELETE FROM interactions WHERE entity_type = 'comment' AND entity_id = $1", commentID); err != nil {
+		return err
+	}
+	if _, err := ex.ExecContext(ctx, "DELETE FROM notifications WHERE entity_type = 'comment' AND entity_id = $1", commentID); err != nil {
+		return err
+	}
+	if _, err := ex.ExecContext(ctx, "DELETE FROM mentions WHERE entity_type = 'comment' AND entity_id = $1", commentID); err != nil {
+		return err
+	}
+	_, err := ex.ExecContext(ctx, `
+		UPDATE comments
+		SET pluses = 0, minuses = 0, score = 0, reaction_count = 0, reaction_counts = '{}', mentions = '[]'
+		WHERE id = $1`, commentID)
+	return err
+}
+
+func applyVoteDelta(ctx context.Context, ex execer, table string, entityID int64, voteType string, delta int) error {
+	var pluses, minuses int
+	switch voteType {
+	case "plus":
+		pluses = delta
+	case "minus":
+		minuses = delta
+	default:
+		return nil
+	}
+
+	_, err := ex.ExecContext(ctx,
+		"UPDATE "+table+" SET pluses = pluses + $1, minuses = minuses + $2, score = score + $1 - $2 WHERE id = $3",
+		pluses, minuses, entityID)
+	return err
+}
+
+func applyReactionDelta(ctx context.Context, ex execer, table string, entityID int64, reactionType string, delta int) error {
+	_, err := ex.ExecContext(ctx, `
+		UPDATE `+table+` SET
+			reaction_count = reaction_count + $1,
+			reaction_counts = CASE
+				WHEN COALESCE((reaction_counts->>$2::text)::integer, 0) + $1 <= 0 THEN reaction_counts - $2::text
+				ELSE jsonb_set(reaction_counts, ARRAY[$2::text], to_jsonb(COALESCE((reaction_counts->>$2::text)::integer, 0) + $1))
+			END
+		WHERE id = $3`,
+		delta, reactionType, entityID)
+	return err
+}
+
+func applyCommentDelta(ctx context.Context, ex execer, jokeID int64, delta int) error {
+	_, err := ex.ExecContext(ctx, "UPDATE jokes SET comment_count = comment_count + $1 WHERE id = $2", delta, jokeID)
+	return err
+}
+
+func decodeReactionCounts(raw sql.NullString) map[string]int {
+	reactions := map[string]int{}
+	if raw.Valid && raw.String != "" {
+		json.Unmarshal([]byte(raw.String), &reactions)
+	}
+	return reactions
+}
+
+type CountersRepository struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func NewCountersRepository(db *sql.DB, log *slog.Logger) *CountersRepository {
+	return &CountersRepository{
+		db:  db,
+		log: log.With(slog.String("component", "counters_repository")),
+	}
+}
+
+// Reconcile recomputes the denormalized counters of every joke and comment
+// from the votes, interactions and comments tables and returns how many rows
+// had drifted. The ranking of every joke is recomputed as well.
+func (r *CountersRepository) Reconcile(ctx context.Context) (int64, int64, error) {
+	r.log.InfoContext(ctx, "Reconciling social counters")
+
+	rows, err := r.db.QueryContext(ctx, `
+		WITH fresh AS (
+			SELECT j.id,
+				(SELECT COUNT(*) FROM votes WHERE entity_type = 'joke' AND entity_id = j.id AND vote_type = 'plus') AS pluses,
+				(SELECT COUNT(*) FROM votes WHERE entity_type = 'joke' AND entity_id = j.id AND vote_type = 'minus') AS minuses,
+				(SELECT COUNT(*) FROM comments WHERE joke_id = j.id AND is_deleted = FALSE) AS comment_count,
+				(SELECT COUNT(*) FROM interactions WHERE entity_type = 'joke' AND entity_id = j.id) AS reaction_count,
+				COALESCE((
+					SELECT jsonb_object_agg(type, n)
+					FROM (SELECT type, COUNT(*) AS n FROM interactions WHERE entity_type = 'joke' AND entity_id = j.id GROUP BY type) rc
+				), '{}') AS reaction_counts
+			FROM jokes j
+		)
+		UPDATE jokes j SET
+			pluses = f.pluses,
+			minuses = f.minuses,
+			score = f.pluses - f.minuses,
+			comment_count = f.comment_count,
+			reaction_count = f.reaction_count,
+			reaction_counts = f.reaction_counts
+		FROM fresh f
+		WHERE j.id = f.id
+		  AND (j.pluses, j.minuses, j.score, j.comment_count, j.reaction_count, j.reaction_counts)
+		      IS DISTINCT FROM (f.pluses, f.minuses, f.pluses - f.minuses, f.comment_count, f.reaction_count, f.reaction_counts)
+		RETURNING j.id
+	`)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to reconcile joke counters", sl.Err(err))
+		return 0, 0, fmt.Errorf("failed to reconcile joke counters: %w", err)
+	}
+
+	var jokeIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan reconciled joke: %w", err)
+		}
+		jokeIDs = append(jokeIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error iterating reconciled jokes: %w", err)
+	}
+
+	if _, err := r.RefreshRankings(ctx, 0); err != nil {
+		return 0, 0, err
+	}
+
+	result, err := r.db.ExecContext(ctx, `
+		WITH fresh AS (
+			SELECT c.id,
+				(SELECT COUNT(*) FROM votes WHERE entity_type = 'comment' AND entity_id = c.id AND vote_type = 'plus') AS pluses,
+				(SELECT COUNT(*) FROM votes WHERE entity_type = 'comment' AND entity_id = c.id AND vote_type = 'minus') AS minuses,
+				(SELECT COUNT(*) FROM interactions WHERE entity_type = 'comment' AND entity_id = c.id) AS reaction_count,
+				COALESCE((
+					SELECT jsonb_object_agg(type, n)
+					FROM (SELECT type, COUNT(*) AS n FROM interactions WHERE entity_type = 'comment' AND entity_id = c.id GROUP BY type) rc
+				), '{}') AS reaction_counts
+			FROM comments c
+		)
+		UPDATE comments c SET
+			pluses = f.pluses,
+			minuses = f.minuses,
+			score = f.pluses - f.minuses,
+			reaction_count = f.reaction_count,
+			reaction_counts = f.reaction_counts
+		FROM fresh f
+		WHERE c.id = f.id
+		  AND (c.pluses, c.minuses, c.score, c.reaction_count, c.reaction_counts)
+		      IS DISTINCT FROM (f.pluses, f.minuses, f.pluses - f.minuses, f.reaction_count, f.reaction_counts)
+	`)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to reconcile comment counters", sl.Err(err))
+		return 0, 0, fmt.Errorf("failed to reconcile comment counters: %w", err)
+	}
+	comments, _ := result.RowsAffected()
+
+	r.log.InfoContext(ctx, "Social counters reconciled",
+		slog.Int("jokes_fixed", len(jokeIDs)),
+		slog.Int64("comments_fixed", comments))
+
+	return int64(len(jokeIDs)), comments, nil
+}
+
+// RefreshRankings recomputes the ranking of every joke posted within window,
+// or of all jokes when window is zero. Jokes that were never ranked, such as
+// rows inserted by the seed migrations, are always included.
+func (r *CountersRepository) RefreshRankings(ctx context.Context, window time.Duration) (int64, error) {
+	r.log.DebugContext(ctx, "Refreshing joke rankings", slog.Duration("window", window))
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM jokes
+		WHERE $1::float8 = 0
+		   OR created_at >= NOW() - make_interval(secs => $1::float8)
+		   OR hot_score = 0
+	`, window.Seconds())
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to list jokes to rank", sl.Err(err))
+		return 0, fmt.Errorf("failed to list jokes to rank: %w", err)
+	}
+
+	var jokeIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan joke to rank: %w", err)
+		}
+		jokeIDs = append(jokeIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating jokes to rank: %w", err)
+	}
+
+	for _, id := range jokeIDs {
+		if err := refreshJokeRanking(ctx, r.db, r.log, id); err != nil {
+			return 0, err
+		}
+	}
+
+	r.log.DebugContext(ctx, "Joke rankings refreshed", slog.Int("jokes", len(jokeIDs)))
+	return int64(len(jokeIDs)), nil
+}
@@ -2,7 +2,10 @@ package postgres
 
 import (
 	"badJokes/internal/lib/sl"
+	"badJokes/internal/models"
+	"context"
 	"database/sql"
+	"fmt"
 	"log/slog"
 )
 
@@ -18,21 +21,40 @@ func NewEntityRepository(db *sql.DB, log *slog.Logger) *EntityRepository {
 	}
 }
 
-func (r *EntityRepository) AddVote(entityType string, entityID, userID int64, voteType string) error {
-	r.log.Debug("Adding vote",
+func (r *EntityRepository) AddVote(ctx context.Context, entityType string, entityID, userID int64, voteType string) error {
+	r.log.DebugContext(ctx, "Adding vote",
 		slog.String("entity_type", entityType),
 		slog.Int64("entity_id", entityID),
 		slog.Int64("user_id", userID),
 		slog.String("vote_type", voteType))
 
-	_, err := r.db.Exec(`
-		INSERT INTO votes (entity_type, entity_id, user_id, vote_type, created_at, modified_at)
-		VALUES ($1, $2, $3, $4, NOW(), NOW())
-		ON CONFLICT(entity_type, entity_id, user_id) DO UPDATE SET vote_type = $5, modified_at = NOW()`,
-		entityType, entityID, userID, voteType, voteType)
-	
+	err := r.mutate(ctx, entityType, entityID, true, func(tx *sql.Tx, table string) error {
+		var previous sql.NullString
+		err := tx.QueryRowContext(ctx, "SELECT vote_type FROM votes WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3",
+			entityType, entityID, userID).Scan(&previous)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if previous.String == voteType {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO votes (entity_type, entity_id, user_id, vote_type, created_at, modified_at)
+			VALUES ($1, $2, $3, $4, NOW(), NOW())
+			ON CONFLICT(entity_type, entity_id, user_id) DO UPDATE SET vote_type = $5, modified_at = NOW()`,
+			entityType, entityID, userID, voteType, voteType)
+		if err != nil {
+			return err
+		}
+
+		if err := applyVoteDelta(ctx, tx, table, entityID, previous.String, -1); err != nil {
+			return err
+		}
+		return applyVoteDelta(ctx, tx, table, entityID, voteType, 1)
+	})
 	if err != nil {
-		r.log.Error("Failed to add vote",
+		r.log.ErrorContext(ctx, "Failed to add vote",
 			sl.Err(err),
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
@@ -40,7 +62,7 @@ func (r *EntityRepository) AddVote(entityType string, entityID, userID int64, vo
 		return err
 	}
 
-	r.log.Info("Vote added successfully",
+	r.log.InfoContext(ctx, "Vote added successfully",
 		slog.String("entity_type", entityType),
 		slog.Int64("entity_id", entityID),
 		slog.Int64("user_id", userID),
@@ -48,52 +70,63 @@ func (r *EntityRepository) AddVote(entityType string, entityID, userID int64, vo
 	return nil
 }
 
-func (r *EntityRepository) RemoveVote(entityType string, entityID, userID int64) error {
-	r.log.Debug("Removing vote",
+func (r *EntityRepository) RemoveVote(ctx context.Context, entityType string, entityID, userID int64) error {
+	r.log.DebugContext(ctx, "Removing vote",
 		slog.String("entity_type", entityType),
 		slog.Int64("entity_id", entityID),
 		slog.Int64("user_id", userID))
 
-	result, err := r.db.Exec("DELETE FROM votes WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3", 
-		entityType, entityID, userID)
-	
+	removed := false
+	err := r.mutate(ctx, entityType, entityID, false, func(tx *sql.Tx, table string) error {
+		var previous string
+		err := tx.QueryRowContext(ctx, "DELETE FROM votes WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3 RETURNING vote_type",
+			entityType, entityID, userID).Scan(&previous)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		removed = true
+		return applyVoteDelta(ctx, tx, table, entityID, previous, -1)
+	})
 	if err != nil {
-		r.log.Error("Failed to remove vote",
+		r.log.ErrorContext(ctx, "Failed to remove vote",
 			sl.Err(err),
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
 			slog.Int64("user_id", userID))
 		return err
 	}
-	
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected > 0 {
-		r.log.Info("Vote removed successfully",
+
+	if removed {
+		r.log.InfoContext(ctx, "Vote removed successfully",
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
 			slog.Int64("user_id", userID))
 	} else {
-		r.log.Debug("No vote found to remove",
+		r.log.DebugContext(ctx, "No vote found to remove",
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
 			slog.Int64("user_id", userID))
 	}
-	
+
 	return nil
 }
 
-func (r *EntityRepository) GetVote(entityType string, entityID, userID int64) (string, error) {
-	r.log.Debug("Getting vote",
+func (r *EntityRepository) GetVote(ctx context.Context, entityType string, entityID, userID int64) (string, error) {
+	r.log.DebugContext(ctx, "Getting vote",
 		slog.String("entity_type", entityType),
 		slog.Int64("entity_id", entityID),
 		slog.Int64("user_id", userID))
 
 	var voteType sql.NullString
-	err := r.db.QueryRow("SELECT vote_type FROM votes WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3", 
+	err := r.db.QueryRowContext(ctx, "SELECT vote_type FROM votes WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3", 
 		entityType, entityID, userID).Scan(&voteType)
 	
 	if err == sql.ErrNoRows {
-		r.log.Debug("No vote found",
+		r.log.DebugContext(ctx, "No vote found",
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
 			slog.Int64("user_id", userID))
@@ -101,7 +134,7 @@ func (r *EntityRepository) GetVote(entityType string, entityID, userID int64) (s
 	}
 	
 	if err != nil {
-		r.log.Error("Failed to get vote",
+		r.log.ErrorContext(ctx, "Failed to get vote",
 			sl.Err(err),
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
@@ -109,7 +142,7 @@ func (r *EntityRepository) GetVote(entityType string, entityID, userID int64) (s
 		return "", err
 	}
 
-	r.log.Debug("Vote retrieved successfully",
+	r.log.DebugContext(ctx, "Vote retrieved successfully",
 		slog.String("entity_type", entityType),
 		slog.Int64("entity_id", entityID),
 		slog.Int64("user_id", userID),
@@ -117,21 +150,32 @@ func (r *EntityRepository) GetVote(entityType string, entityID, userID int64) (s
 	return voteType.String, nil
 }
 
-func (r *EntityRepository) AddReaction(entityType string, entityID, userID int64, reactionType string) error {
-	r.log.Debug("Adding reaction",
+func (r *EntityRepository) AddReaction(ctx context.Context, entityType string, entityID, userID int64, reactionType string) error {
+	r.log.DebugContext(ctx, "Adding reaction",
 		slog.String("entity_type", entityType),
 		slog.Int64("entity_id", entityID),
 		slog.Int64("user_id", userID),
 		slog.String("reaction_type", reactionType))
 
-	_, err := r.db.Exec(`
-		INSERT INTO interactions (entity_type, entity_id, user_id, type, created_at, modified_at)
-		VALUES ($1, $2, $3, $4, NOW(), NOW())
-		ON CONFLICT(entity_type, entity_id, user_id, type) DO NOTHING`,
-		entityType, entityID, userID, reactionType)
-	
+	err := r.mutate(ctx, entityType, entityID, true, func(tx *sql.Tx, table string) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO interactions (entity_type, entity_id, user_id, type, created_at, modified_at)
+			VALUES ($1, $2, $3, $4, NOW(), NOW())
+			ON CONFLICT(entity_type, entity_id, user_id, type) DO NOTHING
+			RETURNING id`,
+			entityType, entityID, userID, reactionType).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return applyReactionDelta(ctx, tx, table, entityID, reactionType, 1)
+	})
 	if err != nil {
-		r.log.Error("Failed to add reaction",
+		r.log.ErrorContext(ctx, "Failed to add reaction",
 			sl.Err(err),
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
@@ -140,7 +184,7 @@ func (r *EntityRepository) AddReaction(entityType string, entityID, userID int64
 		return err
 	}
 
-	r.log.Info("Reaction added successfully",
+	r.log.InfoContext(ctx, "Reaction added successfully",
 		slog.String("entity_type", entityType),
 		slog.Int64("entity_id", entityID),
 		slog.Int64("user_id", userID),
@@ -148,18 +192,30 @@ func (r *EntityRepository) AddReaction(entityType string, entityID, userID int64
 	return nil
 }
 
-func (r *EntityRepository) RemoveReaction(entityType string, entityID, userID int64, reactionType string) error {
-	r.log.Debug("Removing reaction",
+func (r *EntityRepository) RemoveReaction(ctx context.Context, entityType string, entityID, userID int64, reactionType string) error {
+	r.log.DebugContext(ctx, "Removing reaction",
 		slog.String("entity_type", entityType),
 		slog.Int64("entity_id", entityID),
 		slog.Int64("user_id", userID),
 		slog.String("reaction_type", reactionType))
 
-	result, err := r.db.Exec("DELETE FROM interactions WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3 AND type = $4", 
-		entityType, entityID, userID, reactionType)
-	
+	removed := false
+	err := r.mutate(ctx, entityType, entityID, false, func(tx *sql.Tx, table string) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, "DELETE FROM interactions WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3 AND type = $4 RETURNING id",
+			entityType, entityID, userID, reactionType).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		removed = true
+		return applyReactionDelta(ctx, tx, table, entityID, reactionType, -1)
+	})
 	if err != nil {
-		r.log.Error("Failed to remove reaction",
+		r.log.ErrorContext(ctx, "Failed to remove reaction",
 			sl.Err(err),
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
@@ -167,38 +223,37 @@ func (r *EntityRepository) RemoveReaction(entityType string, entityID, userID in
 			slog.String("reaction_type", reactionType))
 		return err
 	}
-	
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected > 0 {
-		r.log.Info("Reaction removed successfully",
+
+	if removed {
+		r.log.InfoContext(ctx, "Reaction removed successfully",
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
 			slog.Int64("user_id", userID),
 			slog.String("reaction_type", reactionType))
 	} else {
-		r.log.Debug("No reaction found to remove",
+		r.log.DebugContext(ctx, "No reaction found to remove",
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
 			slog.Int64("user_id", userID),
 			slog.String("reaction_type", reactionType))
 	}
-	
+
 	return nil
 }
 
-func (r *EntityRepository) GetReaction(entityType string, entityID, userID int64, reactionType string) (bool, error) {
-	r.log.Debug("Checking for reaction",
+func (r *EntityRepository) GetReaction(ctx context.Context, entityType string, entityID, userID int64, reactionType string) (bool, error) {
+	r.log.DebugContext(ctx, "Checking for reaction",
 		slog.String("entity_type", entityType),
 		slog.Int64("entity_id", entityID),
 		slog.Int64("user_id", userID),
 		slog.String("reaction_type", reactionType))
 
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM interactions WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3 AND type = $4", 
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM interactions WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3 AND type = $4", 
 		entityType, entityID, userID, reactionType).Scan(&count)
 	
 	if err != nil {
-		r.log.Error("Failed to check reaction",
+		r.log.ErrorContext(ctx, "Failed to check reaction",
 			sl.Err(err),
 			slog.String("entity_type", entityType),
 			slog.Int64("entity_id", entityID),
@@ -207,11 +262,149 @@ func (r *EntityRepository) GetReaction(entityType string, entityID, userID int64
 		return false, err
 	}
 
-	r.log.Debug("Reaction check completed",
+	r.log.DebugContext(ctx, "Reaction check completed",
 		slog.String("entity_type", entityType),
 		slog.Int64("entity_id", entityID),
 		slog.Int64("user_id", userID),
 		slog.String("reaction_type", reactionType),
 		slog.Bool("exists", count > 0))
 	return count > 0, nil
-}
\ No newline at end of file
+}
+
+// GetAuthorID returns who wrote a joke or comment. Missing jokes and missing
+// or deleted comments yield storeerr.ErrNotFound.
+func (r *EntityRepository) GetAuthorID(ctx context.Context, entityType string, entityID int64) (int64, error) {
+	var query string
+	switch entityType {
+	case "joke":
+		query = "SELECT author_id FROM jokes WHERE id = $1"
+	case "comment":
+		query = "SELECT user_id FROM comments WHERE id = $1 AND is_deleted = FALSE"
+	default:
+		return 0, fmt.Errorf("unknown entity type %q", entityType)
+	}
+
+	var authorID int64
+	if err := r.db.QueryRowContext(ctx, query, entityID).Scan(&authorID); err != nil {
+		if err != sql.ErrNoRows {
+			r.log.ErrorContext(ctx, "Failed to fetch entity author",
+				sl.Err(err),
+				slog.String("entity_type", entityType),
+				slog.Int64("entity_id", entityID))
+		}
+		return 0, mapError(err)
+	}
+
+	return authorID, nil
+}
+
+// GetSocial reads the current counters of a joke or comment together with
+// userID's own vote and reactions on it.
+func (r *EntityRepository) GetSocial(ctx context.Context, entityType string, entityID, userID int64) (models.SocialInteractions, error) {
+	social := models.SocialInteractions{User: &models.UserInteraction{}}
+
+	table, err := counterTable(entityType)
+	if err != nil {
+		return social, err
+	}
+
+	var reactionCounts sql.NullString
+	err = r.db.QueryRowContext(ctx, "SELECT pluses, minuses, score, reaction_counts FROM "+table+" WHERE id = $1", entityID).
+		Scan(&social.Pluses, &social.Minuses, &social.Score, &reactionCounts)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.log.ErrorContext(ctx, "Failed to read entity counters",
+				sl.Err(err),
+				slog.String("entity_type", entityType),
+				slog.Int64("entity_id", entityID))
+		}
+		return social, mapError(err)
+	}
+	social.Reactions = decodeReactionCounts(reactionCounts)
+
+	social.User.VoteType, err = r.GetVote(ctx, entityType, entityID, userID)
+	if err != nil {
+		return social, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, 
+		"SELECT type FROM interactions WHERE entity_type = $1 AND entity_id = $2 AND user_id = $3 ORDER BY type",
+		entityType, entityID, userID)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to read user reactions",
+			sl.Err(err),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID),
+			slog.Int64("user_id", userID))
+		return social, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reactionType string
+		if err := rows.Scan(&reactionType); err != nil {
+			return social, err
+		}
+		social.User.Reactions = append(social.User.Reactions, reactionType)
+	}
+
+	return social, rows.Err()
+}
+
+// GetJokeID returns the joke an entity belongs to: the joke itself, or the
+// joke a comment was posted on.
+func (r *EntityRepository) GetJokeID(ctx context.Context, entityType string, entityID int64) (int64, error) {
+	if entityType == "joke" {
+		return entityID, nil
+	}
+
+	var jokeID int64
+	err := r.db.QueryRowContext(ctx, "SELECT joke_id FROM comments WHERE id = $1", entityID).Scan(&jokeID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.log.ErrorContext(ctx, "Failed to resolve joke for comment",
+				sl.Err(err),
+				slog.Int64("comment_id", entityID))
+		}
+		return 0, mapError(err)
+	}
+
+	return jokeID, nil
+}
+
+// mutate runs change in a transaction with the entity row locked, then
+// refreshes the joke ranking, so the denormalized counters never drift from
+// the votes and interactions tables. Votes and reactions on comments do not
+// count towards the joke's ranking. Additions pass requireLive so nothing is
+// recorded against a missing joke or a deleted comment.
+func (r *EntityRepository) mutate(ctx context.Context, entityType string, entityID int64, requireLive bool, change func(tx *sql.Tx, table string) error) error {
+	table, err := counterTable(entityType)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockCounters(ctx, tx, table, entityID, requireLive); err != nil {
+		if err == sql.ErrNoRows {
+			return mapError(err)
+		}
+		return fmt.Errorf("failed to lock %s row: %w", table, err)
+	}
+
+	if err := change(tx, table); err != nil {
+		return err
+	}
+
+	if entityType == "joke" {
+		if err := refreshJokeRanking(ctx, tx, r.log, entityID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -1,6 +1,55 @@
 package postgres
 
-import "fmt"
+import (
+	"badJokes/internal/storage/storeerr"
+	"database/sql"
+	"errors"
+	"strings"
 
-var ErrJokeNotFound = fmt.Errorf("joke not found")
-var ErrCommentNotFound = fmt.Errorf("comment not found")
\ No newline at end of file
+	"github.com/lib/pq"
+)
+
+var ErrJokeNotFound = storeerr.ErrJokeNotFound
+var ErrCommentNotFound = storeerr.ErrCommentNotFound
+
+// SQLSTATE codes of the integrity constraint violations mapped by mapError.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// mapError translates sql.ErrNoRows and constraint violations into the
+// storeerr sentinels. Other errors are returned unchanged.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return storeerr.NotFound(err)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case uniqueViolation:
+			return &storeerr.ConflictError{Field: conflictField(pqErr.Detail), Err: err}
+		case foreignKeyViolation:
+			return storeerr.ForeignKey(err)
+		}
+	}
+	return err
+}
+
+// conflictField extracts the column from a unique violation detail such as
+// `Key (email)=(a@example.com) already exists.` Composite keys yield "".
+func conflictField(detail string) string {
+	rest, ok := strings.CutPrefix(detail, "Key (")
+	if !ok {
+		return ""
+	}
+	field, _, ok := strings.Cut(rest, ")=")
+	if !ok || strings.Contains(field, ",") {
+		return ""
+	}
+	return field
+}
@@ -1,12 +1,15 @@
 package postgres
 
 import (
+	"badJokes/internal/lib/ranking"
 	"badJokes/internal/lib/sl"
 	"badJokes/internal/models"
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 )
 
 type JokesRepository struct {
@@ -21,8 +24,8 @@ func NewJokesRepository(db *sql.DB, log *slog.Logger) *JokesRepository {
 	}
 }
 
-func (r *JokesRepository) Insert(body string, authorID int64) (int64, error) {
-	r.log.Debug("Inserting new joke",
+func (r *JokesRepository) Insert(ctx context.Context, body string, authorID int64) (int64, error) {
+	r.log.DebugContext(ctx, "Inserting new joke",
 		slog.Int64("author_id", authorID),
 		slog.String("body_length", fmt.Sprintf("%d chars", len(body))))
 
@@ -31,31 +34,192 @@ func (r *JokesRepository) Insert(body string, authorID int64) (int64, error) {
 		VALUES ($1, $2, NOW(), NOW())
 		RETURNING id
 	`
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to begin transaction", sl.Err(err))
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	var id int64
-	err := r.db.QueryRow(query, body, authorID).Scan(&id)
+	err = tx.QueryRowContext(ctx, query, body, authorID).Scan(&id)
 	if err != nil {
-		r.log.Error("Failed to insert joke",
+		r.log.ErrorContext(ctx, "Failed to insert joke",
 			sl.Err(err),
 			slog.Int64("author_id", authorID))
 		return 0, fmt.Errorf("failed to insert joke: %w", err)
 	}
-	
-	r.log.Info("Joke created successfully",
+
+	if err := recordMentions(ctx, tx, "joke", id, id, authorID, body); err != nil {
+		r.log.ErrorContext(ctx, "Failed to record joke mentions",
+			sl.Err(err),
+			slog.Int64("joke_id", id))
+		return 0, err
+	}
+
+	if err := refreshJokeRanking(ctx, tx, r.log, id); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.log.ErrorContext(ctx, "Failed to commit joke", sl.Err(err))
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	r.log.InfoContext(ctx, "Joke created successfully",
 		slog.Int64("joke_id", id),
 		slog.Int64("author_id", authorID))
 	return id, nil
 }
 
-func (r *JokesRepository) ListPage(page, pageSize int, sortField, order string, currentUserID int64) ([]models.Joke, error) {
-	r.log.Debug("Listing jokes with pagination",
+func (r *JokesRepository) ListPage(ctx context.Context, page, pageSize int, sortField, order string, currentUserID int64) ([]models.Joke, error) {
+	r.log.DebugContext(ctx, "Listing jokes with pagination",
 		slog.Int("page", page),
 		slog.Int("page_size", pageSize),
 		slog.String("sort_field", sortField),
 		slog.String("order", order),
 		slog.Int64("current_user_id", currentUserID))
 
+	return r.listPage(ctx, page, pageSize, sortField, order, currentUserID, "")
+}
+
+// ListFeed lists jokes by the authors the user follows, with the same sorting
+// and social data as ListPage.
+func (r *JokesRepository) ListFeed(ctx context.Context, userID int64, page, pageSize int, sortField, order string) ([]models.Joke, error) {
+	r.log.DebugContext(ctx, "Listing feed jokes",
+		slog.Int64("user_id", userID),
+		slog.Int("page", page),
+		slog.Int("page_size", pageSize),
+		slog.String("sort_field", sortField),
+		slog.String("order", order))
+
+	return r.listPage(ctx, page, pageSize, sortField, order, userID,
+		"j.author_id IN (SELECT followee_id FROM follows WHERE follower_id = $1)")
+}
+
+// ListBookmarks lists the jokes the user bookmarked, optionally only those in
+// one collection, with the same sorting and social data as ListPage.
+func (r *JokesRepository) ListBookmarks(ctx context.Context, userID int64, collection *string, page, pageSize int, sortField, order string) ([]models.Joke, error) {
+	r.log.DebugContext(ctx, "Listing bookmarked jokes",
+		slog.Int64("user_id", userID),
+		slog.Int("page", page),
+		slog.Int("page_size", pageSize),
+		slog.String("sort_field", sortField),
+		slog.String("order", order))
+
+	if collection != nil {
+		return r.listPage(ctx, page, pageSize, sortField, order, userID,
+			"j.id IN (SELECT joke_id FROM bookmarks WHERE user_id = $1 AND collection = $5)", *collection)
+	}
+	return r.listPage(ctx, page, pageSize, sortField, order, userID,
+		"j.id IN (SELECT joke_id FROM bookmarks WHERE user_id = $1)")
+}
+
+// AddBookmark bookmarks a joke for the user, moving an existing bookmark into
+// collection.
+func (r *JokesRepository) AddBookmark(ctx context.Context, userID, jokeID int64, collection string) error {
+	r.log.DebugContext(ctx, "Adding bookmark",
+		slog.Int64("user_id", userID),
+		slog.Int64("joke_id", jokeID),
+		slog.String("collection", collection))
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO bookmarks (user_id, joke_id, collection, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, joke_id) DO UPDATE SET collection = EXCLUDED.collection`,
+		userID, jokeID, collection)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to add bookmark",
+			sl.Err(err),
+			slog.Int64("user_id", userID),
+			slog.Int64("joke_id", jokeID))
+		return fmt.Errorf("failed to add bookmark: %w", mapError(err))
+	}
+
+	r.log.InfoContext(ctx, "Bookmark added",
+		slog.Int64("user_id", userID),
+		slog.Int64("joke_id", jokeID))
+	return nil
+}
+
+func (r *JokesRepository) RemoveBookmark(ctx context.Context, userID, jokeID int64) error {
+	r.log.DebugContext(ctx, "Removing bookmark",
+		slog.Int64("user_id", userID),
+		slog.Int64("joke_id", jokeID))
+
+	_, err := r.db.ExecContext(ctx, "DELETE FROM bookmarks WHERE user_id = $1 AND joke_id = $2", userID, jokeID)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to remove bookmark",
+			sl.Err(err),
+			slog.Int64("user_id", userID),
+			slog.Int64("joke_id", jokeID))
+		return fmt.Errorf("failed to remove bookmark: %w", err)
+	}
+
+	r.log.InfoContext(ctx, "Bookmark removed",
+		slog.Int64("user_id", userID),
+		slog.Int64("joke_id", jokeID))
+	return nil
+}
+
+// ListBookmarkCollections returns the user's collections by name with their
+// bookmark counts.
+func (r *JokesRepository) ListBookmarkCollections(ctx context.Context, userID int64) ([]models.BookmarkCollection, error) {
+	r.log.DebugContext(ctx, "Listing bookmark collections", slog.Int64("user_id", userID))
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT collection, COUNT(*)
+		FROM bookmarks
+		WHERE user_id = $1
+		GROUP BY collection
+		ORDER BY collection`, userID)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to list bookmark collections",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return nil, fmt.Errorf("failed to list bookmark collections: %w", err)
+	}
+	defer rows.Close()
+
+	collections := []models.BookmarkCollection{}
+	for rows.Next() {
+		var collection models.BookmarkCollection
+		if err := rows.Scan(&collection.Name, &collection.Count); err != nil {
+			r.log.ErrorContext(ctx, "Failed to scan bookmark collection", sl.Err(err))
+			return nil, fmt.Errorf("failed to scan bookmark collection: %w", err)
+		}
+		collections = append(collections, collection)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.log.ErrorContext(ctx, "Error iterating bookmark collections", sl.Err(err))
+		return nil, fmt.Errorf("error iterating bookmark collections: %w", err)
+	}
+
+	return collections, nil
+}
+
+// listPage lists jokes matching filter, whose own placeholders are numbered
+// from $5 and bound to filterArgs. $1 is always the current user.
+func (r *JokesRepository) listPage(ctx context.Context, page, pageSize int, sortField, order string, currentUserID int64, filter string, filterArgs ...interface{}) ([]models.Joke, error) {
 	offset := (page - 1) * pageSize
 
+	var conditions []string
+	if filter != "" {
+		conditions = append(conditions, filter)
+	}
+	if sortField == "rising" {
+		conditions = append(conditions, rankingWindow(ranking.RisingWindow))
+	}
+	if period, ok := ranking.TopPeriods[sortField]; ok && period > 0 {
+		conditions = append(conditions, rankingWindow(period))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
     baseQuery := `
         SELECT 
             j.id,
@@ -63,20 +227,12 @@ func (r *JokesRepository) ListPage(page, pageSize int, sortField, order string,
             j.author_id,
             j.created_at,
             j.modified_at,
-            (
-                SELECT COALESCE(SUM(CASE WHEN vote_type = 'plus' THEN 1 WHEN vote_type = 'minus' THEN -1 ELSE 0 END), 0)
-                FROM votes WHERE entity_id = j.id AND entity_type = 'joke'
-            ) AS vote_count,
-            COUNT(DISTINCT c.id) AS comment_count,
-            (
-                SELECT json_object_agg(type, count) 
-                FROM (
-                    SELECT type, COUNT(*) as count 
-                    FROM interactions 
-                    WHERE entity_id = j.id AND entity_type = 'joke' 
-                    GROUP BY type
-                ) reaction_counts
-            ) AS reactions_json,
+            j.pluses,
+            j.minuses,
+            j.score,
+            j.comment_count,
+            j.reaction_counts,
+            j.mentions,
             COALESCE(uv.vote_type, '') AS user_vote,
             COALESCE(
                 (SELECT array_to_string(array_agg(type), ',')
@@ -84,17 +240,18 @@ func (r *JokesRepository) ListPage(page, pageSize int, sortField, order string,
                  WHERE entity_id = j.id AND entity_type = 'joke' AND user_id = $2), 
                 ''
             ) AS user_reactions,
+            EXISTS(SELECT 1 FROM bookmarks b WHERE b.joke_id = j.id AND b.user_id = $1) AS bookmarked,
             u.username AS author_username
         FROM jokes j
-        LEFT JOIN comments c ON j.id = c.joke_id
         LEFT JOIN votes uv ON j.id = uv.entity_id AND uv.entity_type = 'joke' AND uv.user_id = $1
         JOIN users u ON j.author_id = u.id
-        GROUP BY j.id, j.body, j.author_id, j.created_at, j.modified_at, uv.vote_type, u.username
+        ` + where + `
     `
 
 	var query string
 	var args []interface{}
 	args = append(args, currentUserID, currentUserID, pageSize, offset)
+	args = append(args, filterArgs...)
 
 	switch sortField {
 	case "created_at":
@@ -117,40 +274,48 @@ func (r *JokesRepository) ListPage(page, pageSize int, sortField, order string,
 		}
 	case "score":
 		if order == "asc" {
-			query = baseQuery + " ORDER BY vote_count ASC LIMIT $3 OFFSET $4"
+			query = baseQuery + " ORDER BY j.score ASC LIMIT $3 OFFSET $4"
 		} else {
-			query = baseQuery + " ORDER BY vote_count DESC LIMIT $3 OFFSET $4"
+			query = baseQuery + " ORDER BY j.score DESC LIMIT $3 OFFSET $4"
 		}
     case "comments_count":
         if order == "asc" {
-            query = baseQuery + " ORDER BY comment_count ASC LIMIT $3 OFFSET $4"
+            query = baseQuery + " ORDER BY j.comment_count ASC LIMIT $3 OFFSET $4"
         } else {
-            query = baseQuery + " ORDER BY comment_count DESC LIMIT $3 OFFSET $4"
+            query = baseQuery + " ORDER BY j.comment_count DESC LIMIT $3 OFFSET $4"
         }
 	case "reactions_count":
 		if order == "asc" {
-			query = baseQuery + ` 
-                ORDER BY (
-                    SELECT COUNT(*) 
-                    FROM interactions 
-                    WHERE entity_id = j.id AND entity_type = 'joke'
-                ) ASC LIMIT $3 OFFSET $4`
+			query = baseQuery + " ORDER BY j.reaction_count ASC LIMIT $3 OFFSET $4"
+		} else {
+			query = baseQuery + " ORDER BY j.reaction_count DESC LIMIT $3 OFFSET $4"
+		}
+	case "hot":
+		if order == "asc" {
+			query = baseQuery + " ORDER BY j.hot_score ASC, j.id ASC LIMIT $3 OFFSET $4"
+		} else {
+			query = baseQuery + " ORDER BY j.hot_score DESC, j.id DESC LIMIT $3 OFFSET $4"
+		}
+	case "rising":
+		if order == "asc" {
+			query = baseQuery + " ORDER BY j.rising_score ASC, j.id ASC LIMIT $3 OFFSET $4"
+		} else {
+			query = baseQuery + " ORDER BY j.rising_score DESC, j.id DESC LIMIT $3 OFFSET $4"
+		}
+	case "top_day", "top_week", "top_month", "top_all":
+		if order == "asc" {
+			query = baseQuery + " ORDER BY j.points ASC, j.created_at ASC LIMIT $3 OFFSET $4"
 		} else {
-			query = baseQuery + ` 
-                ORDER BY (
-                    SELECT COUNT(*) 
-                    FROM interactions 
-                    WHERE entity_id = j.id AND entity_type = 'joke'
-                ) DESC LIMIT $3 OFFSET $4`
+			query = baseQuery + " ORDER BY j.points DESC, j.created_at DESC LIMIT $3 OFFSET $4"
 		}
 	default:
 		query = baseQuery + " ORDER BY j.created_at DESC LIMIT $3 OFFSET $4"
-		r.log.Debug("Using default sort", slog.String("sort_field", "created_at"), slog.String("order", "desc"))
+		r.log.DebugContext(ctx, "Using default sort", slog.String("sort_field", "created_at"), slog.String("order", "desc"))
 	}
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		r.log.Error("Failed to list jokes",
+		r.log.ErrorContext(ctx, "Failed to list jokes",
 			sl.Err(err),
 			slog.Int("page", page),
 			slog.Int("page_size", pageSize))
@@ -162,8 +327,10 @@ func (r *JokesRepository) ListPage(page, pageSize int, sortField, order string,
 	for rows.Next() {
 		var joke models.Joke
 		var reactionsJSON sql.NullString
+		var mentionsJSON sql.NullString
 		var userVote sql.NullString
 		var userReactions sql.NullString
+		var bookmarked bool
 		if err := rows.Scan(
 			&joke.ID,
 			&joke.Body,
@@ -171,34 +338,22 @@ func (r *JokesRepository) ListPage(page, pageSize int, sortField, order string,
 			&joke.CreatedAt,
 			&joke.ModifiedAt,
 			&joke.Social.Pluses,
+			&joke.Social.Minuses,
+			&joke.Social.Score,
 			&joke.CommentCount,
 			&reactionsJSON,
+			&mentionsJSON,
 			&userVote,
 			&userReactions,
+			&bookmarked,
 			&joke.AuthorUsername,
 		); err != nil {
-			r.log.Error("Failed to scan joke row", sl.Err(err))
+			r.log.ErrorContext(ctx, "Failed to scan joke row", sl.Err(err))
 			return nil, fmt.Errorf("failed to scan joke: %w", err)
 		}
 
-		reactionMap := map[string]int{}
-		if reactionsJSON.Valid && reactionsJSON.String != "" && reactionsJSON.String != "null" {
-			jsonStr := strings.Trim(reactionsJSON.String, "{}")
-			if jsonStr != "" {
-				pairs := strings.Split(jsonStr, ",")
-				for _, pair := range pairs {
-					kv := strings.Split(pair, ":")
-					if len(kv) == 2 {
-						key := strings.Trim(kv[0], "\" ")
-						val := strings.Trim(kv[1], " ")
-						count := 0
-						fmt.Sscanf(val, "%d", &count)
-						reactionMap[key] = count
-					}
-				}
-			}
-		}
-		joke.Social.Reactions = reactionMap
+		joke.Social.Reactions = decodeReactionCounts(reactionsJSON)
+		joke.Mentions = decodeMentions(mentionsJSON)
 
 		if userVote.Valid && userVote.String != "" {
 			joke.Social.User = &models.UserInteraction{VoteType: userVote.String}
@@ -214,22 +369,29 @@ func (r *JokesRepository) ListPage(page, pageSize int, sortField, order string,
 			}
 			joke.Social.User.Reactions = userReactionsArray
 		}
+
+		if bookmarked {
+			if joke.Social.User == nil {
+				joke.Social.User = &models.UserInteraction{}
+			}
+			joke.Social.User.Bookmarked = true
+		}
 		jokes = append(jokes, joke)
 	}
 
 	if err = rows.Err(); err != nil {
-		r.log.Error("Error iterating joke rows", sl.Err(err))
+		r.log.ErrorContext(ctx, "Error iterating joke rows", sl.Err(err))
 		return nil, fmt.Errorf("error iterating joke rows: %w", err)
 	}
 
-	r.log.Debug("Retrieved jokes successfully", 
+	r.log.DebugContext(ctx, "Retrieved jokes successfully", 
 		slog.Int("page", page),
 		slog.Int("count", len(jokes)))
 	return jokes, nil
 }
 
-func (r *JokesRepository) GetJokeByID(jokeID, currentUserID int64) (models.Joke, error) {
-	r.log.Debug("Fetching joke by ID",
+func (r *JokesRepository) GetJokeByID(ctx context.Context, jokeID, currentUserID int64) (models.Joke, error) {
+	r.log.DebugContext(ctx, "Fetching joke by ID",
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("current_user_id", currentUserID))
 
@@ -240,20 +402,12 @@ func (r *JokesRepository) GetJokeByID(jokeID, currentUserID int64) (models.Joke,
             j.author_id,
             j.created_at,
             j.modified_at,
-            (
-                SELECT COALESCE(SUM(CASE WHEN vote_type = 'plus' THEN 1 WHEN vote_type = 'minus' THEN -1 ELSE 0 END), 0)
-                FROM votes WHERE entity_id = j.id AND entity_type = 'joke'
-            ) AS vote_count,
-            COUNT(DISTINCT c.id) AS comment_count,
-            (
-                SELECT json_object_agg(type, count) 
-                FROM (
-                    SELECT type, COUNT(*) as count 
-                    FROM interactions 
-                    WHERE entity_id = j.id AND entity_type = 'joke' 
-                    GROUP BY type
-                ) reaction_counts
-            ) AS reactions_json,
+            j.pluses,
+            j.minuses,
+            j.score,
+            j.comment_count,
+            j.reaction_counts,
+            j.mentions,
             COALESCE(uv.vote_type, '') AS user_vote,
             COALESCE(
                 (SELECT array_to_string(array_agg(type), ',')
@@ -261,63 +415,52 @@ func (r *JokesRepository) GetJokeByID(jokeID, currentUserID int64) (models.Joke,
                  WHERE entity_id = j.id AND entity_type = 'joke' AND user_id = $2), 
                 ''
             ) AS user_reactions,
+            EXISTS(SELECT 1 FROM bookmarks b WHERE b.joke_id = j.id AND b.user_id = $1) AS bookmarked,
             u.username AS author_username
         FROM jokes j
-        LEFT JOIN comments c ON j.id = c.joke_id
         LEFT JOIN votes uv ON j.id = uv.entity_id AND uv.entity_type = 'joke' AND uv.user_id = $1
         JOIN users u ON j.author_id = u.id
         WHERE j.id = $3
-        GROUP BY j.id, j.body, j.author_id, j.created_at, j.modified_at, uv.vote_type, u.username
     `
 
 	var joke models.Joke
 	var reactionsJSON sql.NullString
+	var mentionsJSON sql.NullString
 	var userVote sql.NullString
 	var userReactions sql.NullString
+	var bookmarked bool
 	var authorUsername string
 
-	err := r.db.QueryRow(query, currentUserID, currentUserID, jokeID).Scan(
+	err := r.db.QueryRowContext(ctx, query, currentUserID, currentUserID, jokeID).Scan(
 		&joke.ID,
 		&joke.Body,
 		&joke.AuthorID,
 		&joke.CreatedAt,
 		&joke.ModifiedAt,
 		&joke.Social.Pluses,
+		&joke.Social.Minuses,
+		&joke.Social.Score,
 		&joke.CommentCount,
 		&reactionsJSON,
+		&mentionsJSON,
 		&userVote,
 		&userReactions,
+		&bookmarked,
 		&authorUsername,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			r.log.Info("Joke not found", slog.Int64("joke_id", jokeID))
-		} else {
-			r.log.Error("Failed to get joke by ID", 
-				sl.Err(err),
-				slog.Int64("joke_id", jokeID))
+			r.log.InfoContext(ctx, "Joke not found", slog.Int64("joke_id", jokeID))
+			return joke, ErrJokeNotFound
 		}
+		r.log.ErrorContext(ctx, "Failed to get joke by ID", 
+			sl.Err(err),
+			slog.Int64("joke_id", jokeID))
 		return joke, err
 	}
 
-	reactionMap := map[string]int{}
-	if reactionsJSON.Valid && reactionsJSON.String != "" && reactionsJSON.String != "null" {
-		jsonStr := strings.Trim(reactionsJSON.String, "{}")
-		if jsonStr != "" {
-			pairs := strings.Split(jsonStr, ",")
-			for _, pair := range pairs {
-				kv := strings.Split(pair, ":")
-				if len(kv) == 2 {
-					key := strings.Trim(kv[0], "\" ")
-					val := strings.Trim(kv[1], " ")
-					count := 0
-					fmt.Sscanf(val, "%d", &count)
-					reactionMap[key] = count
-				}
-			}
-		}
-	}
-	joke.Social.Reactions = reactionMap
+	joke.Social.Reactions = decodeReactionCounts(reactionsJSON)
+	joke.Mentions = decodeMentions(mentionsJSON)
 
 	if userVote.Valid && userVote.String != "" {
 		joke.Social.User = &models.UserInteraction{VoteType: userVote.String}
@@ -334,35 +477,83 @@ func (r *JokesRepository) GetJokeByID(jokeID, currentUserID int64) (models.Joke,
 		joke.Social.User.Reactions = userReactionsArray
 	}
 
+	if bookmarked {
+		if joke.Social.User == nil {
+			joke.Social.User = &models.UserInteraction{}
+		}
+		joke.Social.User.Bookmarked = true
+	}
+
 	joke.AuthorUsername = authorUsername
 	
-	r.log.Debug("Joke retrieved successfully", 
+	r.log.DebugContext(ctx, "Joke retrieved successfully", 
 		slog.Int64("joke_id", jokeID),
 		slog.Int64("author_id", joke.AuthorID),
 		slog.String("author", authorUsername))
 	return joke, nil
 }
 
-func (r *JokesRepository) DeleteJoke(jokeID int64) error {
-	r.log.Info("Attempting to delete joke", 
+// DeleteJoke removes a joke with its comments and every vote, reaction and
+// notification attached to either, since those reference them without a
+// foreign key.
+func (r *JokesRepository) DeleteJoke(ctx context.Context, jokeID int64) error {
+	r.log.InfoContext(ctx, "Attempting to delete joke",
 		slog.Int64("joke_id", jokeID))
 
-	result, err := r.db.Exec("DELETE FROM jokes WHERE id = $1", jokeID)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to begin transaction", sl.Err(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	cleanup := []string{
+		`DELETE FROM votes
+		 WHERE (entity_type = 'joke' AND entity_id = $1)
+		    OR (entity_type = 'comment' AND entity_id IN (SELECT id FROM comments WHERE joke_id = $1))`,
+		`DELETE FROM interactions
+		 WHERE (entity_type = 'joke' AND entity_id = $1)
+		    OR (entity_type = 'comment' AND entity_id IN (SELECT id FROM comments WHERE joke_id = $1))`,
+		`DELETE FROM notifications WHERE joke_id = $1`,
+	}
+	for _, query := range cleanup {
+		if _, err := tx.ExecContext(ctx, query, jokeID); err != nil {
+			r.log.ErrorContext(ctx, "Failed to clean up joke interactions",
+				sl.Err(err),
+				slog.Int64("joke_id", jokeID))
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM jokes WHERE id = $1", jokeID)
 	if err != nil {
-		r.log.Error("Failed to delete joke", 
+		r.log.ErrorContext(ctx, "Failed to delete joke",
 			sl.Err(err),
 			slog.Int64("joke_id", jokeID))
 		return err
 	}
-	
+
+	if err := tx.Commit(); err != nil {
+		r.log.ErrorContext(ctx, "Failed to commit joke deletion",
+			sl.Err(err),
+			slog.Int64("joke_id", jokeID))
+		return err
+	}
+
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		r.log.Info("No joke found to delete", 
+		r.log.InfoContext(ctx, "No joke found to delete",
 			slog.Int64("joke_id", jokeID))
 	} else {
-		r.log.Info("Joke deleted successfully", 
+		r.log.InfoContext(ctx, "Joke deleted successfully",
 			slog.Int64("joke_id", jokeID))
 	}
-	
+
 	return nil
-}
\ No newline at end of file
+}
+
+
+// rankingWindow restricts a listing to jokes posted within the given period.
+func rankingWindow(period time.Duration) string {
+	return fmt.Sprintf("j.created_at >= NOW() - INTERVAL '%d seconds'", int64(period.Seconds()))
+}
@@ -0,0 +1,255 @@
+package postgres
+
+import (
+	"badJokes/internal/lib/sl"
+	"badJokes/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type NotificationRepository struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func NewNotificationRepository(db *sql.DB, log *slog.Logger) *NotificationRepository {
+	return &NotificationRepository{
+		db:  db,
+		log: log.With(slog.String("component", "notification_repository")),
+	}
+}
+
+// Notify records an event for the author of the joke or comment. Self-events
+// and muted types are dropped, and while the recipient has an unread
+// notification for the same target the event is folded into it.
+func (r *NotificationRepository) Notify(ctx context.Context, eventType, entityType string, entityID, actorID int64) error {
+	r.log.DebugContext(ctx, "Recording notification",
+		slog.String("type", eventType),
+		slog.String("entity_type", entityType),
+		slog.Int64("entity_id", entityID),
+		slog.Int64("actor_id", actorID))
+
+	query := `
+		WITH target AS (
+			SELECT author_id AS user_id, id AS joke_id
+			FROM jokes
+			WHERE $2::text = 'joke' AND id = $3::integer
+			UNION ALL
+			SELECT user_id, joke_id
+			FROM comments
+			WHERE $2::text = 'comment' AND id = $3::integer AND is_deleted = FALSE
+		)
+		INSERT INTO notifications (user_id, type, entity_type, entity_id, joke_id, last_actor_id, event_count, created_at, updated_at)
+		SELECT t.user_id, $1::text, $2::text, $3::integer, t.joke_id, $4::integer, 1, NOW(), NOW()
+		FROM target t
+		WHERE t.user_id <> $4::integer
+		  AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences p
+			WHERE p.user_id = t.user_id AND p.type = $1::text AND p.enabled = FALSE
+		  )
+		ON CONFLICT (user_id, type, entity_type, entity_id) WHERE read_at IS NULL
+		DO UPDATE SET
+			event_count = notifications.event_count + 1,
+			last_actor_id = EXCLUDED.last_actor_id,
+			updated_at = NOW()
+	`
+
+	result, err := r.db.ExecContext(ctx, query, eventType, entityType, entityID, actorID)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to record notification",
+			sl.Err(err),
+			slog.String("type", eventType),
+			slog.String("entity_type", entityType),
+			slog.Int64("entity_id", entityID))
+		return fmt.Errorf("failed to record notification: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	r.log.DebugContext(ctx, "Notification recorded",
+		slog.String("type", eventType),
+		slog.Int64("entity_id", entityID),
+		slog.Int64("rows_affected", rowsAffected))
+
+	return nil
+}
+
+func (r *NotificationRepository) List(ctx context.Context, userID int64, page, pageSize int, unreadOnly bool) ([]models.Notification, error) {
+	r.log.DebugContext(ctx, "Fetching notifications",
+		slog.Int64("user_id", userID),
+		slog.Int("page", page),
+		slog.Int("page_size", pageSize),
+		slog.Bool("unread_only", unreadOnly))
+
+	offset := (page - 1) * pageSize
+
+	query := `
+		SELECT n.id, n.type, n.entity_type, n.entity_id, n.joke_id,
+		       COALESCE(n.last_actor_id, 0), COALESCE(u.username, ''),
+		       n.event_count, n.read_at IS NOT NULL, n.created_at, n.updated_at
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.last_actor_id
+		WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, unreadOnly, pageSize, offset)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to fetch notifications", sl.Err(err), slog.Int64("user_id", userID))
+		return nil, fmt.Errorf("failed to fetch notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var createdAt, updatedAt time.Time
+
+		if err := rows.Scan(
+			&n.ID,
+			&n.Type,
+			&n.EntityType,
+			&n.EntityID,
+			&n.JokeID,
+			&n.LastActorID,
+			&n.LastActorUsername,
+			&n.EventCount,
+			&n.Read,
+			&createdAt,
+			&updatedAt,
+		); err != nil {
+			r.log.ErrorContext(ctx, "Failed to scan notification row", sl.Err(err))
+			return nil, fmt.Errorf("failed to scan notification row: %w", err)
+		}
+
+		n.CreatedAt = createdAt.Format(time.RFC3339)
+		n.UpdatedAt = updatedAt.Format(time.RFC3339)
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.log.ErrorContext(ctx, "Error iterating notification rows", sl.Err(err))
+		return nil, fmt.Errorf("error iterating notification rows: %w", err)
+	}
+
+	r.log.DebugContext(ctx, "Notifications fetched",
+		slog.Int64("user_id", userID),
+		slog.Int("count", len(notifications)))
+
+	return notifications, nil
+}
+
+func (r *NotificationRepository) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL",
+		userID).Scan(&count)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to count unread notifications", sl.Err(err), slog.Int64("user_id", userID))
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkRead marks the given notifications of the user as read, or all of them
+// when ids is empty.
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID int64, ids []int64) error {
+	r.log.DebugContext(ctx, "Marking notifications as read",
+		slog.Int64("user_id", userID),
+		slog.Int("count", len(ids)))
+
+	var result sql.Result
+	var err error
+	if len(ids) == 0 {
+		result, err = r.db.ExecContext(ctx,
+			"UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL",
+			userID)
+	} else {
+		result, err = r.db.ExecContext(ctx,
+			"UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL AND id = ANY($2)",
+			userID, pq.Array(ids))
+	}
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to mark notifications as read", sl.Err(err), slog.Int64("user_id", userID))
+		return fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	r.log.InfoContext(ctx, "Notifications marked as read",
+		slog.Int64("user_id", userID),
+		slog.Int64("rows_affected", rowsAffected))
+
+	return nil
+}
+
+func (r *NotificationRepository) GetPreferences(ctx context.Context, userID int64) (map[string]bool, error) {
+	preferences := make(map[string]bool, len(models.NotificationTypes))
+	for _, t := range models.NotificationTypes {
+		preferences[t] = true
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT type, enabled FROM notification_preferences WHERE user_id = $1",
+		userID)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to fetch notification preferences", sl.Err(err), slog.Int64("user_id", userID))
+		return nil, fmt.Errorf("failed to fetch notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventType string
+		var enabled bool
+		if err := rows.Scan(&eventType, &enabled); err != nil {
+			r.log.ErrorContext(ctx, "Failed to scan notification preference", sl.Err(err))
+			return nil, fmt.Errorf("failed to scan notification preference: %w", err)
+		}
+		preferences[eventType] = enabled
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notification preferences: %w", err)
+	}
+
+	return preferences, nil
+}
+
+func (r *NotificationRepository) SetPreferences(ctx context.Context, userID int64, preferences map[string]bool) error {
+	r.log.DebugContext(ctx, "Updating notification preferences", slog.Int64("user_id", userID))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to begin transaction", sl.Err(err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for eventType, enabled := range preferences {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO notification_preferences (user_id, type, enabled)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled`,
+			userID, eventType, enabled)
+		if err != nil {
+			r.log.ErrorContext(ctx, "Failed to store notification preference",
+				sl.Err(err),
+				slog.Int64("user_id", userID),
+				slog.String("type", eventType))
+			return fmt.Errorf("failed to store notification preference: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.log.ErrorContext(ctx, "Failed to commit notification preferences", sl.Err(err))
+		return fmt.Errorf("failed to commit notification preferences: %w", err)
+	}
+
+	r.log.InfoContext(ctx, "Notification preferences updated", slog.Int64("user_id", userID))
+	return nil
+}
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"badJokes/internal/lib/ranking"
+	"badJokes/internal/lib/sl"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// refreshJokeRanking recomputes the stored points, hot and rising scores of
+// a joke after one of its votes, reactions or comments changed.
+func refreshJokeRanking(ctx context.Context, ex execer, log *slog.Logger, jokeID int64) error {
+	var score, reactions, comments, recentVotes int
+	var createdAt time.Time
+	var ageSeconds float64
+
+	err := ex.QueryRowContext(ctx, `
+		SELECT j.score, j.reaction_count, j.comment_count, j.created_at,
+			EXTRACT(EPOCH FROM (NOW() - j.created_at)),
+			(SELECT COALESCE(SUM(CASE WHEN v.vote_type = 'plus' THEN 1 ELSE -1 END), 0)
+			 FROM votes v
+			 WHERE v.entity_type = 'joke' AND v.entity_id = j.id
+			   AND v.modified_at >= NOW() - make_interval(secs => $2))
+		FROM jokes j
+		WHERE j.id = $1
+	`, jokeID, ranking.VelocityWindow.Seconds()).Scan(&score, &reactions, &comments, &createdAt, &ageSeconds, &recentVotes)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		log.WarnContext(ctx, "Failed to load joke ranking inputs", sl.Err(err), slog.Int64("joke_id", jokeID))
+		return fmt.Errorf("failed to load joke ranking inputs: %w", err)
+	}
+
+	points := ranking.Points(score, reactions, comments)
+	age := time.Duration(ageSeconds * float64(time.Second))
+
+	_, err = ex.ExecContext(ctx,
+		"UPDATE jokes SET points = $1, hot_score = $2, rising_score = $3 WHERE id = $4",
+		points, ranking.Hot(points, createdAt), ranking.Rising(recentVotes, age), jokeID)
+	if err != nil {
+		log.WarnContext(ctx, "Failed to update joke ranking", sl.Err(err), slog.Int64("joke_id", jokeID))
+		return fmt.Errorf("failed to update joke ranking: %w", err)
+	}
+
+	log.DebugContext(ctx, "Joke ranking refreshed",
+		slog.Int64("joke_id", jokeID),
+		slog.Float64("points", points),
+		slog.Int("recent_votes", recentVotes))
+	return nil
+}
@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"badJokes/internal/lib/sl"
+	"badJokes/internal/models"
+	"badJokes/internal/storage/storeerr"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+type ReactionRepository struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func NewReactionRepository(db *sql.DB, log *slog.Logger) *ReactionRepository {
+	return &ReactionRepository{
+		db:  db,
+		log: log.With(slog.String("component", "reaction_repository")),
+	}
+}
+
+func (r *ReactionRepository) List(ctx context.Context) ([]models.Reaction, error) {
+	r.log.DebugContext(ctx, "Listing reaction catalog")
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT key, emoji, label, sort_order, enabled
+		FROM reaction_catalog
+		ORDER BY sort_order, key
+	`)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to list reaction catalog", sl.Err(err))
+		return nil, fmt.Errorf("failed to list reaction catalog: %w", err)
+	}
+	defer rows.Close()
+
+	reactions := []models.Reaction{}
+	for rows.Next() {
+		var reaction models.Reaction
+		if err := rows.Scan(&reaction.Key, &reaction.Emoji, &reaction.Label, &reaction.SortOrder, &reaction.Enabled); err != nil {
+			r.log.ErrorContext(ctx, "Failed to scan reaction", sl.Err(err))
+			return nil, fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		reactions = append(reactions, reaction)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.log.ErrorContext(ctx, "Error iterating reaction rows", sl.Err(err))
+		return nil, fmt.Errorf("error iterating reaction rows: %w", err)
+	}
+
+	return reactions, nil
+}
+
+func (r *ReactionRepository) Get(ctx context.Context, key string) (*models.Reaction, error) {
+	var reaction models.Reaction
+	err := r.db.QueryRowContext(ctx,
+		"SELECT key, emoji, label, sort_order, enabled FROM reaction_catalog WHERE key = $1",
+		key).Scan(&reaction.Key, &reaction.Emoji, &reaction.Label, &reaction.SortOrder, &reaction.Enabled)
+	if err == sql.ErrNoRows {
+		return nil, storeerr.ErrNotFound
+	}
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to fetch reaction", sl.Err(err), slog.String("key", key))
+		return nil, fmt.Errorf("failed to fetch reaction: %w", err)
+	}
+
+	return &reaction, nil
+}
+
+// Create adds a reaction to the catalog and reports false if the key is
+// already taken.
+func (r *ReactionRepository) Create(ctx context.Context, reaction models.Reaction) (bool, error) {
+	r.log.DebugContext(ctx, "Creating reaction", slog.String("key", reaction.Key))
+
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO reaction_catalog (key, emoji, label, sort_order, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		ON CONFLICT (key) DO NOTHING`,
+		reaction.Key, reaction.Emoji, reaction.Label, reaction.SortOrder, reaction.Enabled)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to create reaction", sl.Err(err), slog.String("key", reaction.Key))
+		return false, fmt.Errorf("failed to create reaction: %w", err)
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return false, nil
+	}
+
+	r.log.InfoContext(ctx, "Reaction created", slog.String("key", reaction.Key))
+	return true, nil
+}
+
+func (r *ReactionRepository) Update(ctx context.Context, reaction models.Reaction) error {
+	r.log.DebugContext(ctx, "Updating reaction", slog.String("key", reaction.Key))
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE reaction_catalog
+		SET emoji = $2, label = $3, sort_order = $4, enabled = $5, updated_at = NOW()
+		WHERE key = $1`,
+		reaction.Key, reaction.Emoji, reaction.Label, reaction.SortOrder, reaction.Enabled)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to update reaction", sl.Err(err), slog.String("key", reaction.Key))
+		return fmt.Errorf("failed to update reaction: %w", err)
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return storeerr.ErrNotFound
+	}
+
+	r.log.InfoContext(ctx, "Reaction updated",
+		slog.String("key", reaction.Key),
+		slog.Bool("enabled", reaction.Enabled))
+	return nil
+}
+
+// Retire disables a reaction. It stays in the catalog so reactions already
+// given keep their emoji.
+func (r *ReactionRepository) Retire(ctx context.Context, key string) error {
+	r.log.DebugContext(ctx, "Retiring reaction", slog.String("key", key))
+
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE reaction_catalog SET enabled = FALSE, updated_at = NOW() WHERE key = $1",
+		key)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to retire reaction", sl.Err(err), slog.String("key", key))
+		return fmt.Errorf("failed to retire reaction: %w", err)
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return storeerr.ErrNotFound
+	}
+
+	r.log.InfoContext(ctx, "Reaction retired", slog.String("key", key))
+	return nil
+}
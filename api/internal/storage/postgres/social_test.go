@@ -0,0 +1,177 @@
+package postgres_test
+
+import (
+	"badJokes/internal/lib/commenttree"
+	"badJokes/internal/models"
+	"badJokes/internal/storage"
+	"badJokes/internal/storage/postgres"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// These tests need a disposable database; they run the migrations against
+// TEST_POSTGRES_DSN and are skipped when it is unset.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := storage.Migrate(db, "../../../storage/migrations"); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// createUsers inserts n users with unique names and deletes them, along with
+// everything they created, when the test ends.
+func createUsers(t *testing.T, db *sql.DB, n int) []int64 {
+	t.Helper()
+
+	suffix := time.Now().UnixNano()
+	ids := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("social_test_%d_%d", suffix, i)
+		var id int64
+		err := db.QueryRow(`
+			INSERT INTO users (username, email, password)
+			VALUES ($1, $2, 'x')
+			RETURNING id
+		`, name, name+"@example.com").Scan(&id)
+		if err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	t.Cleanup(func() {
+		for _, id := range ids {
+			db.Exec("DELETE FROM votes WHERE user_id = $1", id)
+			db.Exec("DELETE FROM jokes WHERE author_id = $1", id)
+			db.Exec("DELETE FROM users WHERE id = $1", id)
+		}
+	})
+	return ids
+}
+
+func castVotes(t *testing.T, entities *postgres.EntityRepository, entityType string, entityID int64, votes map[int64]string) {
+	t.Helper()
+
+	for userID, voteType := range votes {
+		if err := entities.AddVote(context.Background(), entityType, entityID, userID, voteType); err != nil {
+			t.Fatalf("vote %s by user %d on %s %d: %v", voteType, userID, entityType, entityID, err)
+		}
+	}
+}
+
+func assertTallies(t *testing.T, name string, got models.SocialInteractions, pluses, minuses int) {
+	t.Helper()
+
+	if got.Pluses != pluses || got.Minuses != minuses || got.Score != pluses-minuses {
+		t.Errorf("%s: got pluses=%d minuses=%d score=%d, want pluses=%d minuses=%d score=%d",
+			name, got.Pluses, got.Minuses, got.Score, pluses, minuses, pluses-minuses)
+	}
+}
+
+// The scans must fill the real plus and minus tallies rather than deriving
+// both from the net score.
+func TestJokeScansFillVoteTallies(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users := createUsers(t, db, 4)
+
+	jokes := postgres.NewJokesRepository(db, log)
+	entities := postgres.NewEntityRepository(db, log)
+
+	jokeID, err := jokes.Insert(ctx, "knock knock", users[0])
+	if err != nil {
+		t.Fatalf("insert joke: %v", err)
+	}
+	castVotes(t, entities, "joke", jokeID, map[int64]string{users[1]: "plus", users[2]: "plus", users[3]: "minus"})
+
+	joke, err := jokes.GetJokeByID(ctx, jokeID, 0)
+	if err != nil {
+		t.Fatalf("get joke: %v", err)
+	}
+	assertTallies(t, "GetJokeByID", joke.Social, 2, 1)
+
+	listed, err := jokes.ListPage(ctx, 1, 10, "created_at", "desc", 0)
+	if err != nil {
+		t.Fatalf("list jokes: %v", err)
+	}
+	found := false
+	for _, j := range listed {
+		if j.ID == jokeID {
+			found = true
+			assertTallies(t, "ListPage", j.Social, 2, 1)
+		}
+	}
+	if !found {
+		t.Fatalf("ListPage did not return joke %d", jokeID)
+	}
+
+	social, err := entities.GetSocial(ctx, "joke", jokeID, 0)
+	if err != nil {
+		t.Fatalf("get social: %v", err)
+	}
+	assertTallies(t, "GetSocial", social, 2, 1)
+}
+
+func TestCommentScansFillVoteTallies(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users := createUsers(t, db, 4)
+
+	jokes := postgres.NewJokesRepository(db, log)
+	comments := postgres.NewCommentsRepository(db, log)
+	entities := postgres.NewEntityRepository(db, log)
+
+	jokeID, err := jokes.Insert(ctx, "knock knock", users[0])
+	if err != nil {
+		t.Fatalf("insert joke: %v", err)
+	}
+	commentID, err := comments.AddComment(ctx, jokeID, users[0], "who's there?", nil)
+	if err != nil {
+		t.Fatalf("add comment: %v", err)
+	}
+	castVotes(t, entities, "comment", commentID, map[int64]string{users[1]: "plus", users[2]: "minus", users[3]: "minus"})
+
+	comment, err := comments.GetCommentByID(ctx, commentID)
+	if err != nil {
+		t.Fatalf("get comment: %v", err)
+	}
+	assertTallies(t, "GetCommentByID", comment.Social, 1, 2)
+
+	page, err := comments.GetTopLevelComments(ctx, jokeID, 0, commenttree.Page{Limit: 10})
+	if err != nil {
+		t.Fatalf("list comments: %v", err)
+	}
+	if len(page.Comments) != 1 {
+		t.Fatalf("GetTopLevelComments returned %d comments, want 1", len(page.Comments))
+	}
+	assertTallies(t, "GetTopLevelComments", page.Comments[0].Social, 1, 2)
+
+	social, err := entities.GetSocial(ctx, "comment", commentID, 0)
+	if err != nil {
+		t.Fatalf("get social: %v", err)
+	}
+	assertTallies(t, "GetSocial", social, 1, 2)
+}
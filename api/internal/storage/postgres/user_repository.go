@@ -3,8 +3,11 @@ package postgres
 import (
 	"badJokes/internal/lib/sl"
 	"badJokes/internal/models"
+	"badJokes/internal/storage/storeerr"
+	"context"
 	"crypto/rand"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -24,14 +27,14 @@ func NewUserRepository(db *sql.DB, log *slog.Logger) *UserRepository {
 	}
 }
 
-func (r *UserRepository) Register(username, email, password string) (int64, error) {
-	r.log.Debug("Registering new user",
+func (r *UserRepository) Register(ctx context.Context, username, email, password string) (int64, error) {
+	r.log.DebugContext(ctx, "Registering new user",
 		slog.String("username", username),
 		slog.String("email", email))
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		r.log.Error("Failed to hash password", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to hash password", sl.Err(err))
 		return 0, fmt.Errorf("failed to hash password: %w", err)
 	}
 
@@ -41,42 +44,50 @@ func (r *UserRepository) Register(username, email, password string) (int64, erro
 		RETURNING id
 	`
 	var id int64
-	err = r.db.QueryRow(query, username, email, hashedPassword).Scan(&id)
+	err = r.db.QueryRowContext(ctx, query, username, email, hashedPassword).Scan(&id)
 	if err != nil {
-		r.log.Error("Failed to insert user",
-			sl.Err(err),
-			slog.String("username", username),
-			slog.String("email", email))
+		err = mapError(err)
+		if errors.Is(err, storeerr.ErrConflict) {
+			r.log.InfoContext(ctx, "User already exists",
+				sl.Err(err),
+				slog.String("username", username),
+				slog.String("email", email))
+		} else {
+			r.log.ErrorContext(ctx, "Failed to insert user",
+				sl.Err(err),
+				slog.String("username", username),
+				slog.String("email", email))
+		}
 		return 0, fmt.Errorf("failed to insert user: %w", err)
 	}
 
-	r.log.Info("User registered successfully",
+	r.log.InfoContext(ctx, "User registered successfully",
 		slog.Int64("user_id", id),
 		slog.String("username", username))
 	return id, nil
 }
 
-func (r *UserRepository) Authenticate(email, password string) (*models.User, error) {
-	r.log.Debug("Authenticating user",
+func (r *UserRepository) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	r.log.DebugContext(ctx, "Authenticating user",
 		slog.String("email", email))
 
 	var user models.User
 	var storedPassword string
 	var isPasswordHashed bool
 
-	err := r.db.QueryRow(`
-		SELECT id, username, email, password, is_password_hashed, is_admin, created_at, modified_at
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, username, email, password, is_password_hashed, is_admin, totp_enabled, created_at, modified_at
 		FROM users
 		WHERE email = $1
-	`, email).Scan(&user.ID, &user.Username, &user.Email, &storedPassword, &isPasswordHashed, &user.IsAdmin, &user.CreatedAt, &user.ModifiedAt)
+	`, email).Scan(&user.ID, &user.Username, &user.Email, &storedPassword, &isPasswordHashed, &user.IsAdmin, &user.TOTPEnabled, &user.CreatedAt, &user.ModifiedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			r.log.Info("Authentication failed: user not found",
+			r.log.InfoContext(ctx, "Authentication failed: user not found",
 				slog.String("email", email))
 			return nil, fmt.Errorf("user not found")
 		}
-		r.log.Error("Failed to query user",
+		r.log.ErrorContext(ctx, "Failed to query user",
 			sl.Err(err),
 			slog.String("email", email))
 		return nil, fmt.Errorf("failed to query user: %w", err)
@@ -84,70 +95,70 @@ func (r *UserRepository) Authenticate(email, password string) (*models.User, err
 
 	if isPasswordHashed {
 		if err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(password)); err != nil {
-			r.log.Info("Authentication failed: invalid password",
+			r.log.InfoContext(ctx, "Authentication failed: invalid password",
 				slog.String("email", email),
 				slog.Int64("user_id", user.ID))
 			return nil, fmt.Errorf("invalid password")
 		}
 	} else {
 		if storedPassword != password {
-			r.log.Info("Authentication failed: invalid password",
+			r.log.InfoContext(ctx, "Authentication failed: invalid password",
 				slog.String("email", email),
 				slog.Int64("user_id", user.ID))
 			return nil, fmt.Errorf("invalid password")
 		}
 
-		r.log.Debug("Upgrading plaintext password to hashed",
+		r.log.DebugContext(ctx, "Upgrading plaintext password to hashed",
 			slog.Int64("user_id", user.ID))
 
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 		if err != nil {
-			r.log.Error("Failed to hash password during upgrade",
+			r.log.ErrorContext(ctx, "Failed to hash password during upgrade",
 				sl.Err(err),
 				slog.Int64("user_id", user.ID))
 			return nil, fmt.Errorf("failed to hash password: %w", err)
 		}
 
-		_, err = r.db.Exec(`
+		_, err = r.db.ExecContext(ctx, `
 			UPDATE users
 			SET password = $1, is_password_hashed = 1, modified_at = NOW()
 			WHERE id = $2
 		`, hashedPassword, user.ID)
 
 		if err != nil {
-			r.log.Error("Failed to update password hash",
+			r.log.ErrorContext(ctx, "Failed to update password hash",
 				sl.Err(err),
 				slog.Int64("user_id", user.ID))
 			return nil, fmt.Errorf("failed to update password: %w", err)
 		}
 
-		r.log.Info("User password upgraded from plaintext to hash",
+		r.log.InfoContext(ctx, "User password upgraded from plaintext to hash",
 			slog.Int64("user_id", user.ID))
 	}
 
-	r.log.Info("User authenticated successfully",
+	r.log.InfoContext(ctx, "User authenticated successfully",
 		slog.Int64("user_id", user.ID),
 		slog.String("username", user.Username))
 	return &user, nil
 }
 
-func (r *UserRepository) GetUsers(page, pageSize int) ([]*models.User, error) {
-	r.log.Debug("Fetching users with pagination",
+func (r *UserRepository) GetUsers(ctx context.Context, page, pageSize int) ([]*models.User, error) {
+	r.log.DebugContext(ctx, "Fetching users with pagination",
 		slog.Int("page", page),
 		slog.Int("page_size", pageSize))
 
 	offset := (page - 1) * pageSize
 
 	query := `
-		SELECT id, username, email, is_admin, created_at, modified_at
+		SELECT id, username, email, is_admin, totp_enabled, created_at, modified_at
 		FROM users
 		ORDER BY id ASC
 		LIMIT $1 OFFSET $2
 	`
 
-	rows, err := r.db.Query(query, pageSize, offset)
+	rows, err := r.db.QueryContext(ctx, query, pageSize, offset)
 	if err != nil {
-		r.log.Error("Failed to fetch users", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to fetch users", sl.Err(err))
 		return nil, fmt.Errorf("failed to fetch users: %w", err)
 	}
 	defer rows.Close()
@@ -162,12 +173,13 @@ func (r *UserRepository) GetUsers(page, pageSize int) ([]*models.User, error) {
 			&user.Username,
 			&user.Email,
 			&user.IsAdmin,
+			&user.TOTPEnabled,
 			&createdAt,
 			&modifiedAt,
 		)
 
 		if err != nil {
-			r.log.Error("Failed to scan user row", sl.Err(err))
+			r.log.ErrorContext(ctx, "Failed to scan user row", sl.Err(err))
 			return nil, fmt.Errorf("failed to scan user row: %w", err)
 		}
 
@@ -177,11 +189,11 @@ func (r *UserRepository) GetUsers(page, pageSize int) ([]*models.User, error) {
 	}
 
 	if err := rows.Err(); err != nil {
-		r.log.Error("Error iterating user rows", sl.Err(err))
+		r.log.ErrorContext(ctx, "Error iterating user rows", sl.Err(err))
 		return nil, fmt.Errorf("error iterating user rows: %w", err)
 	}
 
-	r.log.Info("Successfully fetched users",
+	r.log.InfoContext(ctx, "Successfully fetched users",
 		slog.Int("page", page),
 		slog.Int("page_size", pageSize),
 		slog.Int("count", len(users)))
@@ -189,22 +201,22 @@ func (r *UserRepository) GetUsers(page, pageSize int) ([]*models.User, error) {
 	return users, nil
 }
 
-func (r *UserRepository) GetUserCount() (int, error) {
-	r.log.Debug("Getting total user count")
+func (r *UserRepository) GetUserCount(ctx context.Context) (int, error) {
+	r.log.DebugContext(ctx, "Getting total user count")
 
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
 	if err != nil {
-		r.log.Error("Failed to get user count", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to get user count", sl.Err(err))
 		return 0, fmt.Errorf("failed to get user count: %w", err)
 	}
 
-	r.log.Debug("User count retrieved", slog.Int("count", count))
+	r.log.DebugContext(ctx, "User count retrieved", slog.Int("count", count))
 	return count, nil
 }
 
-func (r *UserRepository) SetAdminStatus(userID int64, isAdmin bool) error {
-	r.log.Debug("Setting user admin status",
+func (r *UserRepository) SetAdminStatus(ctx context.Context, userID int64, isAdmin bool) error {
+	r.log.DebugContext(ctx, "Setting user admin status",
 		slog.Int64("user_id", userID),
 		slog.Bool("is_admin", isAdmin))
 
@@ -214,9 +226,9 @@ func (r *UserRepository) SetAdminStatus(userID int64, isAdmin bool) error {
 		WHERE id = $2
 	`
 
-	result, err := r.db.Exec(query, isAdmin, userID)
+	result, err := r.db.ExecContext(ctx, query, isAdmin, userID)
 	if err != nil {
-		r.log.Error("Failed to update user admin status",
+		r.log.ErrorContext(ctx, "Failed to update user admin status",
 			sl.Err(err),
 			slog.Int64("user_id", userID))
 		return fmt.Errorf("failed to update user admin status: %w", err)
@@ -224,12 +236,12 @@ func (r *UserRepository) SetAdminStatus(userID int64, isAdmin bool) error {
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		r.log.Error("Failed to get rows affected", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to get rows affected", sl.Err(err))
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		r.log.Warn("No user found with ID", slog.Int64("user_id", userID))
+		r.log.WarnContext(ctx, "No user found with ID", slog.Int64("user_id", userID))
 		return fmt.Errorf("no user found with ID %d", userID)
 	}
 
@@ -240,22 +252,22 @@ func (r *UserRepository) SetAdminStatus(userID int64, isAdmin bool) error {
 	`
 
 	details := fmt.Sprintf("Changed admin status to %v", isAdmin)
-	_, err = r.db.Exec(logQuery, "SET_ADMIN_STATUS", userID, "user", userID, details)
+	_, err = r.db.ExecContext(ctx, logQuery, "SET_ADMIN_STATUS", userID, "user", userID, details)
 	if err != nil {
-		r.log.Error("Failed to log admin status change",
+		r.log.ErrorContext(ctx, "Failed to log admin status change",
 			sl.Err(err),
 			slog.Int64("user_id", userID))
 	}
 
-	r.log.Info("User admin status updated successfully",
+	r.log.InfoContext(ctx, "User admin status updated successfully",
 		slog.Int64("user_id", userID),
 		slog.Bool("new_status", isAdmin))
 
 	return nil
 }
 
-func (r *UserRepository) GetModerationLogs(page, pageSize int) ([]*models.ModerationLog, error) {
-	r.log.Debug("Fetching moderation logs",
+func (r *UserRepository) GetModerationLogs(ctx context.Context, page, pageSize int) ([]*models.ModerationLog, error) {
+	r.log.DebugContext(ctx, "Fetching moderation logs",
 		slog.Int("page", page),
 		slog.Int("page_size", pageSize))
 
@@ -270,9 +282,9 @@ func (r *UserRepository) GetModerationLogs(page, pageSize int) ([]*models.Modera
 		LIMIT $1 OFFSET $2
 	`
 
-	rows, err := r.db.Query(query, pageSize, offset)
+	rows, err := r.db.QueryContext(ctx, query, pageSize, offset)
 	if err != nil {
-		r.log.Error("Failed to fetch moderation logs", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to fetch moderation logs", sl.Err(err))
 		return nil, fmt.Errorf("failed to fetch moderation logs: %w", err)
 	}
 	defer rows.Close()
@@ -294,7 +306,7 @@ func (r *UserRepository) GetModerationLogs(page, pageSize int) ([]*models.Modera
 		)
 
 		if err != nil {
-			r.log.Error("Failed to scan moderation log", sl.Err(err))
+			r.log.ErrorContext(ctx, "Failed to scan moderation log", sl.Err(err))
 			return nil, fmt.Errorf("failed to scan moderation log: %w", err)
 		}
 
@@ -303,11 +315,11 @@ func (r *UserRepository) GetModerationLogs(page, pageSize int) ([]*models.Modera
 	}
 
 	if err := rows.Err(); err != nil {
-		r.log.Error("Error iterating moderation logs", sl.Err(err))
+		r.log.ErrorContext(ctx, "Error iterating moderation logs", sl.Err(err))
 		return nil, fmt.Errorf("error iterating moderation logs: %w", err)
 	}
 
-	r.log.Info("Successfully fetched moderation logs",
+	r.log.InfoContext(ctx, "Successfully fetched moderation logs",
 		slog.Int("count", len(logs)),
 		slog.Int("page", page),
 		slog.Int("page_size", pageSize))
@@ -315,51 +327,51 @@ func (r *UserRepository) GetModerationLogs(page, pageSize int) ([]*models.Modera
 	return logs, nil
 }
 
-func (r *UserRepository) GetUserStats() (*models.UserStats, error) {
-	r.log.Debug("Getting user statistics")
+func (r *UserRepository) GetUserStats(ctx context.Context) (*models.UserStats, error) {
+	r.log.DebugContext(ctx, "Getting user statistics")
 
 	stats := &models.UserStats{}
 
-	err := r.db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&stats.TotalUsers)
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&stats.TotalUsers)
 	if err != nil {
-		r.log.Error("Failed to get total users count", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to get total users count", sl.Err(err))
 		return nil, fmt.Errorf("failed to get total users count: %w", err)
 	}
 
-	err = r.db.QueryRow(`SELECT COUNT(*) FROM users WHERE is_admin = true`).Scan(&stats.AdminCount)
+	err = r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE is_admin = true`).Scan(&stats.AdminCount)
 	if err != nil {
-		r.log.Error("Failed to get admin count", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to get admin count", sl.Err(err))
 		return nil, fmt.Errorf("failed to get admin count: %w", err)
 	}
 
-	err = r.db.QueryRow(`
+	err = r.db.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM users 
 		WHERE created_at >= NOW() - INTERVAL '24 hours'
 	`).Scan(&stats.NewUsersToday)
 	if err != nil {
-		r.log.Error("Failed to get new users count", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to get new users count", sl.Err(err))
 		return nil, fmt.Errorf("failed to get new users count: %w", err)
 	}
 
-	err = r.db.QueryRow(`
+	err = r.db.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM users 
 		WHERE created_at >= NOW() - INTERVAL '7 days'
 	`).Scan(&stats.NewUsersThisWeek)
 	if err != nil {
-		r.log.Error("Failed to get weekly new users count", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to get weekly new users count", sl.Err(err))
 		return nil, fmt.Errorf("failed to get weekly new users count: %w", err)
 	}
 
-	err = r.db.QueryRow(`
+	err = r.db.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM users 
 		WHERE created_at >= NOW() - INTERVAL '30 days'
 	`).Scan(&stats.NewUsersThisMonth)
 	if err != nil {
-		r.log.Error("Failed to get monthly new users count", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to get monthly new users count", sl.Err(err))
 		return nil, fmt.Errorf("failed to get monthly new users count: %w", err)
 	}
 
-	rows, err := r.db.Query(`
+	rows, err := r.db.QueryContext(ctx, `
 		SELECT u.id, u.username, 
 		       COUNT(DISTINCT j.id) as jokes_count, 
 		       COUNT(DISTINCT c.id) as comments_count
@@ -371,7 +383,7 @@ func (r *UserRepository) GetUserStats() (*models.UserStats, error) {
 		LIMIT 5
 	`)
 	if err != nil {
-		r.log.Error("Failed to get active users", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to get active users", sl.Err(err))
 		return nil, fmt.Errorf("failed to get active users: %w", err)
 	}
 	defer rows.Close()
@@ -388,7 +400,7 @@ func (r *UserRepository) GetUserStats() (*models.UserStats, error) {
 		)
 
 		if err != nil {
-			r.log.Error("Failed to scan active user", sl.Err(err))
+			r.log.ErrorContext(ctx, "Failed to scan active user", sl.Err(err))
 			return nil, fmt.Errorf("failed to scan active user: %w", err)
 		}
 
@@ -396,25 +408,30 @@ func (r *UserRepository) GetUserStats() (*models.UserStats, error) {
 	}
 
 	if err := rows.Err(); err != nil {
-		r.log.Error("Error iterating active users", sl.Err(err))
+		r.log.ErrorContext(ctx, "Error iterating active users", sl.Err(err))
 		return nil, fmt.Errorf("error iterating active users: %w", err)
 	}
 
 	stats.MostActiveUsers = activeUsers
 
-	r.log.Info("User statistics retrieved successfully")
+	r.log.InfoContext(ctx, "User statistics retrieved successfully")
 	return stats, nil
 }
 
-func (r *UserRepository) FindOrCreateOAuthUser(email, username, provider, providerID string) (*models.User, error) {
-	r.log.Debug("Finding or creating OAuth user",
+// FindOrCreateOAuthUser returns the user linked to the provider account,
+// creating one if needed. An existing account with the same email is only
+// linked when the provider verified that email; otherwise a *ConflictError on
+// email is returned, as anyone can claim an address they do not control.
+func (r *UserRepository) FindOrCreateOAuthUser(ctx context.Context, email string, emailVerified bool, username, provider, providerID string) (*models.User, error) {
+	r.log.DebugContext(ctx, "Finding or creating OAuth user",
 		slog.String("provider", provider),
 		slog.String("provider_id", providerID),
-		slog.String("email", email))
+		slog.String("email", email),
+		slog.Bool("email_verified", emailVerified))
 
-	tx, err := r.db.Begin()
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		r.log.Error("Failed to begin transaction", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to begin transaction", sl.Err(err))
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer func() {
@@ -426,8 +443,8 @@ func (r *UserRepository) FindOrCreateOAuthUser(email, username, provider, provid
 	var user models.User
 	var createdAt, modifiedAt time.Time
 
-	err = tx.QueryRow(`
-		SELECT id, username, email, is_admin, created_at, modified_at
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, username, email, is_admin, totp_enabled, created_at, modified_at
 		FROM users
 		WHERE provider = $1 AND provider_id = $2
 	`, provider, providerID).Scan(
@@ -435,6 +452,7 @@ func (r *UserRepository) FindOrCreateOAuthUser(email, username, provider, provid
 		&user.Username,
 		&user.Email,
 		&user.IsAdmin,
+		&user.TOTPEnabled,
 		&createdAt,
 		&modifiedAt,
 	)
@@ -443,10 +461,10 @@ func (r *UserRepository) FindOrCreateOAuthUser(email, username, provider, provid
 		user.CreatedAt = createdAt.Format(time.RFC3339)
 		user.ModifiedAt = modifiedAt.Format(time.RFC3339)
 
-		r.log.Info("Found existing OAuth user", slog.Int64("user_id", user.ID))
+		r.log.InfoContext(ctx, "Found existing OAuth user", slog.Int64("user_id", user.ID))
 
 		if err = tx.Commit(); err != nil {
-			r.log.Error("Failed to commit transaction", sl.Err(err))
+			r.log.ErrorContext(ctx, "Failed to commit transaction", sl.Err(err))
 			return nil, fmt.Errorf("failed to commit transaction: %w", err)
 		}
 
@@ -454,12 +472,12 @@ func (r *UserRepository) FindOrCreateOAuthUser(email, username, provider, provid
 	}
 
 	if err != sql.ErrNoRows {
-		r.log.Error("Database error when finding user", sl.Err(err))
+		r.log.ErrorContext(ctx, "Database error when finding user", sl.Err(err))
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
-	err = tx.QueryRow(`
-		SELECT id, username, email, is_admin, created_at, modified_at
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, username, email, is_admin, totp_enabled, created_at, modified_at
 		FROM users
 		WHERE email = $1
 	`, email).Scan(
@@ -467,31 +485,40 @@ func (r *UserRepository) FindOrCreateOAuthUser(email, username, provider, provid
 		&user.Username,
 		&user.Email,
 		&user.IsAdmin,
+		&user.TOTPEnabled,
 		&createdAt,
 		&modifiedAt,
 	)
 
+	if err == nil && !emailVerified {
+		r.log.WarnContext(ctx, "Refusing to link OAuth account by unverified email",
+			slog.Int64("user_id", user.ID),
+			slog.String("provider", provider))
+		err = &storeerr.ConflictError{Field: "email", Err: errors.New("email is not verified by the provider")}
+		return nil, err
+	}
+
 	if err == nil {
-		_, err = tx.Exec(`
+		_, err = tx.ExecContext(ctx, `
 			UPDATE users
 			SET provider = $1, provider_id = $2, modified_at = NOW()
 			WHERE id = $3
 		`, provider, providerID, user.ID)
 
 		if err != nil {
-			r.log.Error("Failed to update user with OAuth info", sl.Err(err))
+			r.log.ErrorContext(ctx, "Failed to update user with OAuth info", sl.Err(err))
 			return nil, fmt.Errorf("failed to update user: %w", err)
 		}
 
 		user.CreatedAt = createdAt.Format(time.RFC3339)
 		user.ModifiedAt = time.Now().Format(time.RFC3339)
 
-		r.log.Info("Linked existing user to OAuth account",
+		r.log.InfoContext(ctx, "Linked existing user to OAuth account",
 			slog.Int64("user_id", user.ID),
 			slog.String("provider", provider))
 
 		if err = tx.Commit(); err != nil {
-			r.log.Error("Failed to commit transaction", sl.Err(err))
+			r.log.ErrorContext(ctx, "Failed to commit transaction", sl.Err(err))
 			return nil, fmt.Errorf("failed to commit transaction: %w", err)
 		}
 
@@ -499,51 +526,557 @@ func (r *UserRepository) FindOrCreateOAuthUser(email, username, provider, provid
 	}
 
 	if err != sql.ErrNoRows {
-		r.log.Error("Database error when finding user by email", sl.Err(err))
+		r.log.ErrorContext(ctx, "Database error when finding user by email", sl.Err(err))
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
 	randomBytes := make([]byte, 32)
 	if _, err := rand.Read(randomBytes); err != nil {
-		r.log.Error("Failed to generate random password", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to generate random password", sl.Err(err))
 		return nil, fmt.Errorf("failed to generate random password: %w", err)
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword(randomBytes, bcrypt.DefaultCost)
 	if err != nil {
-		r.log.Error("Failed to hash random password", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to hash random password", sl.Err(err))
 		return nil, fmt.Errorf("failed to hash random password: %w", err)
 	}
 
-	err = tx.QueryRow(`
+	err = tx.QueryRowContext(ctx, `
 		INSERT INTO users (username, email, provider, provider_id, password, is_password_hashed, created_at, modified_at)
 		VALUES ($1, $2, $3, $4, $5, 1, NOW(), NOW())
-		RETURNING id, username, email, is_admin, created_at, modified_at
+		RETURNING id, username, email, is_admin, totp_enabled, created_at, modified_at
 	`, username, email, provider, providerID, hashedPassword).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.IsAdmin,
+		&user.TOTPEnabled,
 		&createdAt,
 		&modifiedAt,
 	)
 
 	if err != nil {
-		r.log.Error("Failed to create new OAuth user", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to create new OAuth user", sl.Err(err))
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
 	user.CreatedAt = createdAt.Format(time.RFC3339)
 	user.ModifiedAt = modifiedAt.Format(time.RFC3339)
 
-	r.log.Info("Created new user via OAuth",
+	r.log.InfoContext(ctx, "Created new user via OAuth",
 		slog.Int64("user_id", user.ID),
 		slog.String("provider", provider))
 
 	if err = tx.Commit(); err != nil {
-		r.log.Error("Failed to commit transaction", sl.Err(err))
+		r.log.ErrorContext(ctx, "Failed to commit transaction", sl.Err(err))
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	return &user, nil
 }
+
+func (r *UserRepository) GetUserByID(ctx context.Context, userID int64) (*models.User, error) {
+	r.log.DebugContext(ctx, "Fetching user by ID", slog.Int64("user_id", userID))
+
+	var user models.User
+	var createdAt, modifiedAt time.Time
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, username, email, is_admin, totp_enabled, created_at, modified_at
+		FROM users
+		WHERE id = $1
+	`, userID).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.IsAdmin,
+		&user.TOTPEnabled,
+		&createdAt,
+		&modifiedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.log.InfoContext(ctx, "User not found", slog.Int64("user_id", userID))
+			return nil, mapError(err)
+		}
+		r.log.ErrorContext(ctx, "Failed to fetch user by ID",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+
+	user.CreatedAt = createdAt.Format(time.RFC3339)
+	user.ModifiedAt = modifiedAt.Format(time.RFC3339)
+
+	return &user, nil
+}
+
+func (r *UserRepository) GetTOTPSecret(ctx context.Context, userID int64) (string, bool, error) {
+	r.log.DebugContext(ctx, "Fetching TOTP secret", slog.Int64("user_id", userID))
+
+	var secret sql.NullString
+	var enabled bool
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT totp_secret, totp_enabled
+		FROM users
+		WHERE id = $1
+	`, userID).Scan(&secret, &enabled)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.log.InfoContext(ctx, "User not found", slog.Int64("user_id", userID))
+			return "", false, mapError(err)
+		}
+		r.log.ErrorContext(ctx, "Failed to fetch TOTP secret",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return "", false, fmt.Errorf("failed to fetch totp secret: %w", err)
+	}
+
+	return secret.String, enabled, nil
+}
+
+func (r *UserRepository) SetPendingTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	r.log.DebugContext(ctx, "Storing pending TOTP secret", slog.Int64("user_id", userID))
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE users
+		SET totp_secret = $1, modified_at = NOW()
+		WHERE id = $2 AND totp_enabled = FALSE
+	`, secret, userID)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to store TOTP secret",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return fmt.Errorf("failed to store totp secret: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		r.log.WarnContext(ctx, "TOTP secret not stored: user missing or 2FA already enabled",
+			slog.Int64("user_id", userID))
+		return fmt.Errorf("cannot enroll user %d in two-factor authentication", userID)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) EnableTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	r.log.DebugContext(ctx, "Enabling TOTP",
+		slog.Int64("user_id", userID),
+		slog.Int("recovery_codes", len(recoveryCodeHashes)))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to begin transaction", sl.Err(err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET totp_enabled = TRUE, modified_at = NOW()
+		WHERE id = $1 AND totp_secret IS NOT NULL
+	`, userID); err != nil {
+		r.log.ErrorContext(ctx, "Failed to enable TOTP",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return fmt.Errorf("failed to enable totp: %w", err)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		r.log.ErrorContext(ctx, "Failed to store recovery codes",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.log.ErrorContext(ctx, "Failed to commit transaction", sl.Err(err))
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	r.log.InfoContext(ctx, "TOTP enabled", slog.Int64("user_id", userID))
+	return nil
+}
+
+func (r *UserRepository) DisableTOTP(ctx context.Context, userID int64) error {
+	r.log.DebugContext(ctx, "Disabling TOTP", slog.Int64("user_id", userID))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to begin transaction", sl.Err(err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled = FALSE,
+			totp_failed_attempts = 0, totp_locked_until = NULL, modified_at = NOW()
+		WHERE id = $1
+	`, userID); err != nil {
+		r.log.ErrorContext(ctx, "Failed to disable TOTP",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return fmt.Errorf("failed to disable totp: %w", err)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, nil); err != nil {
+		r.log.ErrorContext(ctx, "Failed to remove recovery codes",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.log.ErrorContext(ctx, "Failed to commit transaction", sl.Err(err))
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	r.log.InfoContext(ctx, "TOTP disabled", slog.Int64("user_id", userID))
+	return nil
+}
+
+func (r *UserRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	r.log.DebugContext(ctx, "Replacing recovery codes",
+		slog.Int64("user_id", userID),
+		slog.Int("recovery_codes", len(recoveryCodeHashes)))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to begin transaction", sl.Err(err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		r.log.ErrorContext(ctx, "Failed to replace recovery codes",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.log.ErrorContext(ctx, "Failed to commit transaction", sl.Err(err))
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	r.log.DebugContext(ctx, "Consuming recovery code", slog.Int64("user_id", userID))
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE user_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to consume recovery code",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return false, fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to get rows affected", sl.Err(err))
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected > 0 {
+		r.log.InfoContext(ctx, "Recovery code used", slog.Int64("user_id", userID))
+	}
+	return rowsAffected > 0, nil
+}
+
+// AcceptTOTPStep records step as the newest one a code was accepted for and
+// clears the failure counter. It reports false, changing nothing, when a code
+// for this or a later step was already accepted, i.e. the code is a replay.
+func (r *UserRepository) AcceptTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	r.log.DebugContext(ctx, "Accepting TOTP step",
+		slog.Int64("user_id", userID),
+		slog.Int64("step", step))
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE users
+		SET totp_last_step = $2, totp_failed_attempts = 0
+		WHERE id = $1 AND totp_last_step < $2
+	`, userID, step)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to accept TOTP step",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return false, fmt.Errorf("failed to accept totp step: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to get rows affected", sl.Err(err))
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		r.log.WarnContext(ctx, "TOTP code replayed",
+			slog.Int64("user_id", userID),
+			slog.Int64("step", step))
+	}
+	return rowsAffected > 0, nil
+}
+
+// RecordTOTPFailure counts a rejected second factor. Once maxAttempts
+// failures accumulate the counter restarts and the second factor is locked
+// for lockout; the result reports whether this failure triggered the lock.
+func (r *UserRepository) RecordTOTPFailure(ctx context.Context, userID int64, maxAttempts int, lockout time.Duration) (bool, error) {
+	r.log.DebugContext(ctx, "Recording TOTP failure", slog.Int64("user_id", userID))
+
+	var locked bool
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET totp_failed_attempts = CASE
+				WHEN totp_failed_attempts + 1 >= $2 THEN 0
+				ELSE totp_failed_attempts + 1
+			END,
+			totp_locked_until = CASE
+				WHEN totp_failed_attempts + 1 >= $2 THEN NOW() + make_interval(secs => $3)
+				ELSE totp_locked_until
+			END
+		WHERE id = $1
+		RETURNING totp_failed_attempts = 0
+	`, userID, maxAttempts, lockout.Seconds()).Scan(&locked)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, mapError(err)
+		}
+		r.log.ErrorContext(ctx, "Failed to record TOTP failure",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return false, fmt.Errorf("failed to record totp failure: %w", err)
+	}
+
+	if locked {
+		r.log.WarnContext(ctx, "Two-factor locked after repeated failures",
+			slog.Int64("user_id", userID),
+			slog.Duration("lockout", lockout))
+	}
+	return locked, nil
+}
+
+func (r *UserRepository) ResetTOTPFailures(ctx context.Context, userID int64) error {
+	r.log.DebugContext(ctx, "Resetting TOTP failures", slog.Int64("user_id", userID))
+
+	if _, err := r.db.ExecContext(ctx, `
+		UPDATE users
+		SET totp_failed_attempts = 0
+		WHERE id = $1
+	`, userID); err != nil {
+		r.log.ErrorContext(ctx, "Failed to reset TOTP failures",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return fmt.Errorf("failed to reset totp failures: %w", err)
+	}
+
+	return nil
+}
+
+// TOTPLockRemaining returns how long the user's second factor stays locked,
+// or zero when it is not locked.
+func (r *UserRepository) TOTPLockRemaining(ctx context.Context, userID int64) (time.Duration, error) {
+	var seconds float64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(GREATEST(EXTRACT(EPOCH FROM (totp_locked_until - NOW())), 0), 0)
+		FROM users
+		WHERE id = $1
+	`, userID).Scan(&seconds)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, mapError(err)
+		}
+		r.log.ErrorContext(ctx, "Failed to fetch TOTP lock",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return 0, fmt.Errorf("failed to fetch totp lock: %w", err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO user_recovery_codes (user_id, code_hash, created_at)
+			VALUES ($1, $2, NOW())
+		`, userID, hash); err != nil {
+			return fmt.Errorf("failed to insert recovery code: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *UserRepository) CreateLoginCode(ctx context.Context, userID int64, codeHash string, twoFactorPending bool, ttl time.Duration) error {
+	r.log.DebugContext(ctx, "Creating OAuth login code",
+		slog.Int64("user_id", userID),
+		slog.Bool("two_factor_pending", twoFactorPending))
+
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM oauth_login_codes WHERE expires_at < NOW()"); err != nil {
+		r.log.WarnContext(ctx, "Failed to purge expired login codes", sl.Err(err))
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO oauth_login_codes (code_hash, user_id, two_factor_pending, expires_at, created_at)
+		VALUES ($1, $2, $3, NOW() + make_interval(secs => $4), NOW())
+	`, codeHash, userID, twoFactorPending, ttl.Seconds())
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to create login code",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return fmt.Errorf("failed to create login code: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeLoginCode deletes the code as it reads it, so a code can be
+// exchanged at most once even under concurrent requests.
+func (r *UserRepository) ConsumeLoginCode(ctx context.Context, codeHash string) (int64, bool, error) {
+	r.log.DebugContext(ctx, "Consuming OAuth login code")
+
+	var userID int64
+	var twoFactorPending bool
+
+	err := r.db.QueryRowContext(ctx, `
+		DELETE FROM oauth_login_codes
+		WHERE code_hash = $1 AND expires_at > NOW()
+		RETURNING user_id, two_factor_pending
+	`, codeHash).Scan(&userID, &twoFactorPending)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.log.InfoContext(ctx, "Login code not found or expired")
+			return 0, false, mapError(err)
+		}
+		r.log.ErrorContext(ctx, "Failed to consume login code", sl.Err(err))
+		return 0, false, fmt.Errorf("failed to consume login code: %w", err)
+	}
+
+	r.log.InfoContext(ctx, "Login code consumed", slog.Int64("user_id", userID))
+	return userID, twoFactorPending, nil
+}
+
+func (r *UserRepository) Follow(ctx context.Context, followerID, followeeID int64) error {
+	r.log.DebugContext(ctx, "Following user",
+		slog.Int64("follower_id", followerID),
+		slog.Int64("followee_id", followeeID))
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO follows (follower_id, followee_id, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (follower_id, followee_id) DO NOTHING`,
+		followerID, followeeID)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to follow user",
+			sl.Err(err),
+			slog.Int64("follower_id", followerID),
+			slog.Int64("followee_id", followeeID))
+		return fmt.Errorf("failed to follow user: %w", mapError(err))
+	}
+
+	r.log.InfoContext(ctx, "User followed",
+		slog.Int64("follower_id", followerID),
+		slog.Int64("followee_id", followeeID))
+	return nil
+}
+
+func (r *UserRepository) Unfollow(ctx context.Context, followerID, followeeID int64) error {
+	r.log.DebugContext(ctx, "Unfollowing user",
+		slog.Int64("follower_id", followerID),
+		slog.Int64("followee_id", followeeID))
+
+	_, err := r.db.ExecContext(ctx,
+		"DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2",
+		followerID, followeeID)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to unfollow user",
+			sl.Err(err),
+			slog.Int64("follower_id", followerID),
+			slog.Int64("followee_id", followeeID))
+		return fmt.Errorf("failed to unfollow user: %w", err)
+	}
+
+	r.log.InfoContext(ctx, "User unfollowed",
+		slog.Int64("follower_id", followerID),
+		slog.Int64("followee_id", followeeID))
+	return nil
+}
+
+func (r *UserRepository) CountFollowing(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM follows WHERE follower_id = $1", userID).Scan(&count)
+	if err != nil {
+		r.log.ErrorContext(ctx, "Failed to count followed users", sl.Err(err), slog.Int64("user_id", userID))
+		return 0, fmt.Errorf("failed to count followed users: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetProfile returns the public profile of a user; IsFollowing is relative to
+// viewerID, which is 0 for anonymous viewers.
+func (r *UserRepository) GetProfile(ctx context.Context, userID, viewerID int64) (*models.UserProfile, error) {
+	r.log.DebugContext(ctx, "Fetching user profile",
+		slog.Int64("user_id", userID),
+		slog.Int64("viewer_id", viewerID))
+
+	var profile models.UserProfile
+	var createdAt time.Time
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			u.id,
+			u.username,
+			u.created_at,
+			(SELECT COUNT(*) FROM jokes WHERE author_id = u.id),
+			(SELECT COUNT(*) FROM follows WHERE followee_id = u.id),
+			(SELECT COUNT(*) FROM follows WHERE follower_id = u.id),
+			EXISTS (SELECT 1 FROM follows WHERE follower_id = $2 AND followee_id = u.id)
+		FROM users u
+		WHERE u.id = $1
+	`, userID, viewerID).Scan(
+		&profile.ID,
+		&profile.Username,
+		&createdAt,
+		&profile.JokesCount,
+		&profile.FollowersCount,
+		&profile.FollowingCount,
+		&profile.IsFollowing,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			r.log.InfoContext(ctx, "User not found", slog.Int64("user_id", userID))
+			return nil, mapError(err)
+		}
+		r.log.ErrorContext(ctx, "Failed to fetch user profile",
+			sl.Err(err),
+			slog.Int64("user_id", userID))
+		return nil, fmt.Errorf("failed to fetch user profile: %w", err)
+	}
+
+	profile.CreatedAt = createdAt.Format(time.RFC3339)
+
+	return &profile, nil
+}
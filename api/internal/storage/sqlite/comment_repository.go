@@ -1,7 +1,9 @@
 package sqlite
 
 import (
+	"badJokes/internal/lib/commenttree"
 	"badJokes/internal/models"
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
@@ -20,9 +22,9 @@ func NewCommentsRepository(db *sql.DB, log *slog.Logger) *CommentsRepository {
 	}
 }
 
-func (r *CommentsRepository) AddComment(jokeID, userID int64, body string, parentID *int64) (int64, error) {
+func (r *CommentsRepository) AddComment(ctx context.Context, jokeID, userID int64, body string, parentID *int64) (int64, error) {
 	var exists bool
-	err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM jokes WHERE id = ?)", jokeID).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM jokes WHERE id = ?)", jokeID).Scan(&exists)
 	if err != nil {
 		return 0, err
 	}
@@ -31,7 +33,7 @@ func (r *CommentsRepository) AddComment(jokeID, userID int64, body string, paren
 	}
 
 	if parentID != nil {
-		err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM comments WHERE id = ? AND joke_id = ?)",
+		err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM comments WHERE id = ? AND joke_id = ?)",
 			*parentID, jokeID).Scan(&exists)
 		if err != nil {
 			return 0, err
@@ -41,7 +43,13 @@ func (r *CommentsRepository) AddComment(jokeID, userID int64, body string, paren
 		}
 	}
 
-	result, err := r.db.Exec(`
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
 		INSERT INTO comments (joke_id, parent_id, body, user_id, created_at, modified_at)
 		VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))
 	`, jokeID, parentID, body, userID)
@@ -54,11 +62,21 @@ func (r *CommentsRepository) AddComment(jokeID, userID int64, body string, paren
 		return 0, err
 	}
 
-	return id, nil
+	if err := recordMentions(ctx, tx, "comment", id, jokeID, userID, body); err != nil {
+		return 0, err
+	}
+	if err := applyCommentDelta(ctx, tx, jokeID, 1); err != nil {
+		return 0, err
+	}
+	if err := refreshJokeRanking(ctx, tx, jokeID); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
 }
 
-func (r *CommentsRepository) GetComments(jokeID int64) ([]models.Comment, error) {
-	rows, err := r.db.Query(`
+func (r *CommentsRepository) GetComments(ctx context.Context, jokeID int64) ([]models.Comment, error) {
+	rows, err := r.db.QueryContext(ctx, `
 		SELECT id, joke_id, user_id, body, created_at, modified_at
 		FROM comments
 		WHERE joke_id = ?
@@ -86,8 +104,122 @@ func (r *CommentsRepository) GetComments(jokeID int64) ([]models.Comment, error)
 	return comments, nil
 }
 
-func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([]models.Comment, error) {
+func (r *CommentsRepository) GetTopLevelComments(ctx context.Context, jokeID, currentUserID int64, page commenttree.Page) (models.CommentPage, error) {
+	return r.commentPage(ctx, "c.joke_id = ? AND c.parent_id IS NULL", jokeID, 0, currentUserID, page)
+}
+
+func (r *CommentsRepository) GetReplies(ctx context.Context, parentID, currentUserID int64, page commenttree.Page) (models.CommentPage, error) {
+	var depth int
+	err := r.db.QueryRowContext(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM comments WHERE id = ?
+			UNION ALL
+			SELECT c.id, c.parent_id FROM comments c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT COUNT(*) FROM ancestors`, parentID).Scan(&depth)
+	if err != nil {
+		return models.CommentPage{}, err
+	}
+	if depth == 0 {
+		return models.CommentPage{}, ErrCommentNotFound
+	}
+
+	return r.commentPage(ctx, "c.parent_id = ?", parentID, depth, currentUserID, page)
+}
+
+func (r *CommentsRepository) GetCommentThread(ctx context.Context, commentID, currentUserID int64, page commenttree.Page) (models.CommentThread, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, 0 AS depth
+			FROM comments
+			WHERE id = ?
+			UNION ALL
+			SELECT c.id, c.parent_id, ch.depth + 1
+			FROM comments c
+			JOIN chain ch ON c.id = ch.parent_id
+		)
+		SELECT
+			c.id,
+			c.joke_id,
+			c.parent_id,
+			c.body,
+			c.user_id,
+			u.username AS author_username,
+			c.created_at,
+			c.is_deleted,
+			c.modified_at,
+			c.pluses,
+			c.minuses,
+			c.score,
+			c.reaction_counts,
+			c.mentions,
+			t.depth,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count,
+			COALESCE(uv.vote_type, '') AS user_vote,
+			COALESCE(
+				(SELECT group_concat(type, ',')
+				FROM interactions 
+				WHERE entity_id = c.id AND entity_type = 'comment' AND user_id = ?), 
+				''
+			) AS user_reactions
+		FROM chain t
+		JOIN comments c ON c.id = t.id
+		JOIN users u ON c.user_id = u.id
+		LEFT JOIN votes uv ON c.id = uv.entity_id AND uv.entity_type = 'comment' AND uv.user_id = ?
+		ORDER BY t.depth DESC
+	`, commentID, currentUserID, currentUserID)
+	if err != nil {
+		return models.CommentThread{}, err
+	}
+	defer rows.Close()
+
+	chain, err := scanThread(rows)
+	if err != nil {
+		return models.CommentThread{}, err
+	}
+	if len(chain) == 0 {
+		return models.CommentThread{}, ErrCommentNotFound
+	}
+
+	replies, err := r.GetReplies(ctx, commentID, currentUserID, page)
+	if err != nil {
+		return models.CommentThread{}, err
+	}
+
+	return buildCommentThread(chain, replies), nil
+}
+
+func (r *CommentsRepository) commentPage(ctx context.Context, seed string, seedID int64, depth int, currentUserID int64, page commenttree.Page) (models.CommentPage, error) {
+	args := []interface{}{seedID}
+
+	where := seed
+	if page.After != nil {
+		where += " AND " + cursorCondition(page.Sort, "?", "?")
+		if page.Sort == commenttree.SortBest {
+			args = append(args, page.After.Score, page.After.Score, page.After.ID)
+		} else {
+			args = append(args, page.After.ID)
+		}
+	}
+	args = append(args, page.Limit+1, depth, depth+page.MaxDepth, currentUserID, currentUserID)
+
 	query := `
+		WITH RECURSIVE page AS (
+			SELECT c.id, c.score
+			FROM comments c
+			WHERE ` + where + `
+			ORDER BY ` + commentOrder(page.Sort) + `
+			LIMIT ?
+		),
+		thread AS (
+			SELECT id, ? AS depth
+			FROM page
+			UNION ALL
+			SELECT c.id, t.depth + 1
+			FROM comments c
+			JOIN thread t ON c.parent_id = t.id
+			WHERE t.depth < ?
+		)
 		SELECT
 			c.id,
 			c.joke_id,
@@ -98,19 +230,13 @@ func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([
 			c.created_at,
 			c.is_deleted,
 			c.modified_at,
-			(
-				SELECT COALESCE(SUM(CASE WHEN vote_type = 'plus' THEN 1 WHEN vote_type = 'minus' THEN -1 ELSE 0 END), 0)
-				FROM votes WHERE entity_id = c.id AND entity_type = 'comment'
-			) AS vote_count,
-			(
-				SELECT json_object_agg(type, count) 
-				FROM (
-					SELECT type, COUNT(*) as count 
-					FROM interactions 
-					WHERE entity_id = c.id AND entity_type = 'comment' 
-					GROUP BY type
-				) reaction_counts
-			) AS reactions_json,
+			c.pluses,
+			c.minuses,
+			c.score,
+			c.reaction_counts,
+			c.mentions,
+			t.depth,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count,
 			COALESCE(uv.vote_type, '') AS user_vote,
 			COALESCE(
 				(SELECT group_concat(type, ',')
@@ -118,27 +244,134 @@ func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([
 				WHERE entity_id = c.id AND entity_type = 'comment' AND user_id = ?), 
 				''
 			) AS user_reactions
-		FROM comments c
+		FROM thread t
+		JOIN comments c ON c.id = t.id
 		JOIN users u ON c.user_id = u.id
 		LEFT JOIN votes uv ON c.id = uv.entity_id AND uv.entity_type = 'comment' AND uv.user_id = ?
-		WHERE c.joke_id = ?
-		ORDER BY 
-			CASE WHEN c.parent_id IS NULL THEN c.id ELSE c.parent_id END ASC,
-			c.parent_id IS NOT NULL ASC,
-			c.created_at ASC
+		ORDER BY t.depth, ` + commentOrder(page.Sort) + `
 	`
 
-	rows, err := r.db.Query(query, currentUserID, currentUserID, jokeID)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return models.CommentPage{}, err
 	}
 	defer rows.Close()
 
+	comments, err := scanThread(rows)
+	if err != nil {
+		return models.CommentPage{}, err
+	}
+
+	return paginate(comments, page), nil
+}
+
+func (r *CommentsRepository) DeleteComment(ctx context.Context, commentID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var jokeID int64
+	err = tx.QueryRowContext(ctx, "UPDATE comments SET is_deleted = TRUE WHERE id = ? AND is_deleted = FALSE RETURNING joke_id",
+		commentID).Scan(&jokeID)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM comments WHERE id = ?)", commentID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrCommentNotFound
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := applyCommentDelta(ctx, tx, jokeID, -1); err != nil {
+		return err
+	}
+	if err := clearCommentSocial(ctx, tx, commentID); err != nil {
+		return err
+	}
+	if err := refreshJokeRanking(ctx, tx, jokeID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *CommentsRepository) GetCommentByID(ctx context.Context, commentID int64) (models.Comment, error) {
+	query := `
+		SELECT 
+			c.id, 
+			c.joke_id, 
+			c.parent_id, 
+			c.body, 
+			c.user_id,
+			u.username AS author_username,
+			c.created_at, 
+			c.modified_at,
+			c.is_deleted,
+			c.pluses,
+			c.minuses,
+			c.score,
+			c.reaction_counts,
+			c.mentions
+		FROM comments c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.id = ?
+	`
+
+	var comment models.Comment
+	var parentID sql.NullInt64
+	var reactionsJSON sql.NullString
+	var mentionsJSON sql.NullString
+
+	err := r.db.QueryRowContext(ctx, query, commentID).Scan(
+		&comment.ID,
+		&comment.JokeID,
+		&parentID,
+		&comment.Body,
+		&comment.AuthorID,
+		&comment.AuthorUsername,
+		&comment.CreatedAt,
+		&comment.ModifiedAt,
+		&comment.IsDeleted,
+		&comment.Social.Pluses,
+		&comment.Social.Minuses,
+		&comment.Social.Score,
+		&reactionsJSON,
+		&mentionsJSON,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return comment, ErrCommentNotFound
+		}
+		return comment, err
+	}
+
+	if parentID.Valid {
+		comment.ParentID = parentID.Int64
+	}
+	comment.Social.Reactions = decodeReactionCounts(reactionsJSON)
+	comment.Mentions = decodeMentions(mentionsJSON)
+
+	return comment, nil
+}
+
+// scanThread reads the rows of a thread query, which select the comment
+// columns followed by depth, reply count and the current user's vote and
+// reactions.
+func scanThread(rows *sql.Rows) ([]models.Comment, error) {
 	var comments []models.Comment
 	for rows.Next() {
 		var comment models.Comment
 		var parentID sql.NullInt64
 		var reactionsJSON sql.NullString
+		var mentionsJSON sql.NullString
 		var userVote sql.NullString
 		var userReactions sql.NullString
 
@@ -153,7 +386,12 @@ func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([
 			&comment.IsDeleted,
 			&comment.ModifiedAt,
 			&comment.Social.Pluses,
+			&comment.Social.Minuses,
+			&comment.Social.Score,
 			&reactionsJSON,
+			&mentionsJSON,
+			&comment.Depth,
+			&comment.ReplyCount,
 			&userVote,
 			&userReactions,
 		); err != nil {
@@ -164,25 +402,8 @@ func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([
 			comment.ParentID = parentID.Int64
 		}
 
-		// Process reaction data
-		reactionMap := map[string]int{}
-		if reactionsJSON.Valid && reactionsJSON.String != "" && reactionsJSON.String != "null" {
-			jsonStr := strings.Trim(reactionsJSON.String, "{}")
-			if jsonStr != "" {
-				pairs := strings.Split(jsonStr, ",")
-				for _, pair := range pairs {
-					kv := strings.Split(pair, ":")
-					if len(kv) == 2 {
-						key := strings.Trim(kv[0], "\" ")
-						val := strings.Trim(kv[1], " ")
-						count := 0
-						fmt.Sscanf(val, "%d", &count)
-						reactionMap[key] = count
-					}
-				}
-			}
-		}
-		comment.Social.Reactions = reactionMap
+		comment.Social.Reactions = decodeReactionCounts(reactionsJSON)
+		comment.Mentions = decodeMentions(mentionsJSON)
 
 		if userVote.Valid && userVote.String != "" {
 			comment.Social.User = &models.UserInteraction{VoteType: userVote.String}
@@ -201,72 +422,65 @@ func (r *CommentsRepository) GetCommentsByJokeID(jokeID, currentUserID int64) ([
 
 		if comment.IsDeleted {
 			comment.Body = ""
+			comment.Mentions = []models.Mention{}
 		}
 
 		comments = append(comments, comment)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return comments, nil
 }
 
-func (r *CommentsRepository) DeleteComment(commentID int64) error {
-	result, err := r.db.Exec("UPDATE comments SET is_deleted = TRUE WHERE id = ?", commentID)
-	if err != nil {
-		return err
+func buildCommentThread(chain []models.Comment, replies models.CommentPage) models.CommentThread {
+	top := chain[0].Depth
+	for i := range chain {
+		chain[i].Depth = top - chain[i].Depth
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
+	comment := chain[len(chain)-1]
+	comment.Children = replies.Comments
 
-	if rowsAffected == 0 {
-		return ErrCommentNotFound
+	return models.CommentThread{
+		Ancestors:  chain[:len(chain)-1],
+		Comment:    comment,
+		NextCursor: replies.NextCursor,
 	}
-
-	return nil
 }
 
-func (r *CommentsRepository) GetCommentByID(commentID int64) (models.Comment, error) {
-	query := `
-		SELECT 
-			c.id, 
-			c.joke_id, 
-			c.parent_id, 
-			c.body, 
-			c.user_id,
-			u.username AS author_username,
-			c.created_at, 
-			c.modified_at
-		FROM comments c
-		JOIN users u ON c.user_id = u.id
-		WHERE c.id = ?
-	`
-
-	var comment models.Comment
-	var parentID sql.NullInt64
-
-	err := r.db.QueryRow(query, commentID).Scan(
-		&comment.ID,
-		&comment.JokeID,
-		&parentID,
-		&comment.Body,
-		&comment.AuthorID,
-		&comment.AuthorUsername,
-		&comment.CreatedAt,
-		&comment.ModifiedAt,
-	)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return comment, ErrCommentNotFound
-		}
-		return comment, err
+// commentOrder is the ORDER BY applied among sibling comments. Comment ids
+// increase with creation time, so they give the chronological orders and a
+// tie-break that cursors can resume from.
+func commentOrder(sort string) string {
+	switch sort {
+	case commenttree.SortBest:
+		return "c.score DESC, c.id ASC"
+	case commenttree.SortNew:
+		return "c.id DESC"
+	default:
+		return "c.id ASC"
 	}
+}
 
-	if parentID.Valid {
-		comment.ParentID = parentID.Int64
+func cursorCondition(sort, score, id string) string {
+	switch sort {
+	case commenttree.SortBest:
+		return "(c.score < " + score + " OR (c.score = " + score + " AND c.id > " + id + "))"
+	case commenttree.SortNew:
+		return "c.id < " + id
+	default:
+		return "c.id > " + id
 	}
+}
 
-	return comment, nil
+func paginate(comments []models.Comment, page commenttree.Page) models.CommentPage {
+	result := models.CommentPage{Comments: commenttree.Build(comments)}
+	if len(result.Comments) > page.Limit {
+		result.Comments = result.Comments[:page.Limit]
+		result.NextCursor = commenttree.EncodeCursor(page.Sort, result.Comments[page.Limit-1])
+	}
+	return result
 }
@@ -0,0 +1,226 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func counterTable(entityType string) (string, error) {
+	switch entityType {
+	case "joke":
+		return "jokes", nil
+	case "comment":
+		return "comments", nil
+	default:
+		return "", fmt.Errorf("unknown entity type %q", entityType)
+	}
+}
+
+// requireLive reports storeerr.ErrNotFound for a missing joke or a missing
+// or soft-deleted comment.
+func requireLive(ctx context.Context, ex execer, table string, entityID int64) error {
+	query := "SELECT id FROM " + table + " WHERE id = ?"
+	if table == "comments" {
+		query += " AND is_deleted = FALSE"
+	}
+
+	var id int64
+	return mapError(ex.QueryRowContext(ctx, query, entityID).Scan(&id))
+}
+
+func clearCommentSocial(ctx context.Context, ex execer, commentID int64) error {
+	if _, err := ex.ExecContext(ctx, "DELETE FROM votes WHERE entity_type = 'comment' AND entity_id = ?", commentID); err != nil {
+		return err
+	}
+	if _, err := ex.ExecContext(ctx, "DELETE FROM interactions WHERE entity_type = 'comment' AND entity_id = ?", commentID); err != nil {
+		return err
+	}
+	if _, err := ex.ExecContext(ctx, "DELETE FROM mentions WHERE entity_type = 'comment' AND entity_id = ?", commentID); err != nil {
+		return err
+	}
+	_, err := ex.ExecContext(ctx, "UPDATE comments SET pluses = 0, minuses = 0, score = 0, reaction_count = 0, reaction_counts = '{}', mentions = '[]' WHERE id = ?",
+		commentID)
+	return err
+}
+
+func applyVoteDelta(ctx context.Context, ex execer, table string, entityID int64, voteType string, delta int) error {
+	var pluses, minuses int
+	switch voteType {
+	case "plus":
+		pluses = delta
+	case "minus":
+		minuses = delta
+	default:
+		return nil
+	}
+
+	_, err := ex.ExecContext(ctx, "UPDATE "+table+" SET pluses = pluses + ?, minuses = minuses + ?, score = score + ? WHERE id = ?",
+		pluses, minuses, pluses-minuses, entityID)
+	return err
+}
+
+func applyReactionDelta(ctx context.Context, ex execer, table string, entityID int64, reactionType string, delta int) error {
+	path := `$."` + reactionType + `"`
+	_, err := ex.ExecContext(ctx, `
+		UPDATE `+table+` SET
+			reaction_count = reaction_count + ?,
+			reaction_counts = CASE
+				WHEN COALESCE(json_extract(reaction_counts, ?), 0) + ? <= 0 THEN json_remove(reaction_counts, ?)
+				ELSE json_set(reaction_counts, ?, COALESCE(json_extract(reaction_counts, ?), 0) + ?)
+			END
+		WHERE id = ?`,
+		delta, path, delta, path, path, path, delta, entityID)
+	return err
+}
+
+func applyCommentDelta(ctx context.Context, ex execer, jokeID int64, delta int) error {
+	_, err := ex.ExecContext(ctx, "UPDATE jokes SET comment_count = comment_count + ? WHERE id = ?", delta, jokeID)
+	return err
+}
+
+func decodeReactionCounts(raw sql.NullString) map[string]int {
+	reactions := map[string]int{}
+	if raw.Valid && raw.String != "" {
+		json.Unmarshal([]byte(raw.String), &reactions)
+	}
+	return reactions
+}
+
+type CountersRepository struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func NewCountersRepository(db *sql.DB, log *slog.Logger) *CountersRepository {
+	return &CountersRepository{
+		db:  db,
+		log: log.With(slog.String("component", "counters_repository")),
+	}
+}
+
+func (r *CountersRepository) Reconcile(ctx context.Context) (int64, int64, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		WITH fresh AS (
+			SELECT j.id,
+				(SELECT COUNT(*) FROM votes WHERE entity_type = 'joke' AND entity_id = j.id AND vote_type = 'plus') AS pluses,
+				(SELECT COUNT(*) FROM votes WHERE entity_type = 'joke' AND entity_id = j.id AND vote_type = 'minus') AS minuses,
+				(SELECT COUNT(*) FROM comments WHERE joke_id = j.id AND is_deleted = FALSE) AS comment_count,
+				(SELECT COUNT(*) FROM interactions WHERE entity_type = 'joke' AND entity_id = j.id) AS reaction_count,
+				COALESCE((
+					SELECT json_group_object(type, n)
+					FROM (SELECT type, COUNT(*) AS n FROM interactions WHERE entity_type = 'joke' AND entity_id = j.id GROUP BY type)
+				), '{}') AS reaction_counts
+			FROM jokes j
+		)
+		UPDATE jokes SET
+			pluses = f.pluses,
+			minuses = f.minuses,
+			score = f.pluses - f.minuses,
+			comment_count = f.comment_count,
+			reaction_count = f.reaction_count,
+			reaction_counts = f.reaction_counts
+		FROM fresh f
+		WHERE jokes.id = f.id
+		  AND (jokes.pluses, jokes.minuses, jokes.score, jokes.comment_count, jokes.reaction_count, json(jokes.reaction_counts))
+		      IS NOT (f.pluses, f.minuses, f.pluses - f.minuses, f.comment_count, f.reaction_count, json(f.reaction_counts))
+		RETURNING jokes.id
+	`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to reconcile joke counters: %w", err)
+	}
+
+	var jokeIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan reconciled joke: %w", err)
+		}
+		jokeIDs = append(jokeIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error iterating reconciled jokes: %w", err)
+	}
+
+	if _, err := r.RefreshRankings(ctx, 0); err != nil {
+		return 0, 0, err
+	}
+
+	result, err := r.db.ExecContext(ctx, `
+		WITH fresh AS (
+			SELECT c.id,
+				(SELECT COUNT(*) FROM votes WHERE entity_type = 'comment' AND entity_id = c.id AND vote_type = 'plus') AS pluses,
+				(SELECT COUNT(*) FROM votes WHERE entity_type = 'comment' AND entity_id = c.id AND vote_type = 'minus') AS minuses,
+				(SELECT COUNT(*) FROM interactions WHERE entity_type = 'comment' AND entity_id = c.id) AS reaction_count,
+				COALESCE((
+					SELECT json_group_object(type, n)
+					FROM (SELECT type, COUNT(*) AS n FROM interactions WHERE entity_type = 'comment' AND entity_id = c.id GROUP BY type)
+				), '{}') AS reaction_counts
+			FROM comments c
+		)
+		UPDATE comments SET
+			pluses = f.pluses,
+			minuses = f.minuses,
+			score = f.pluses - f.minuses,
+			reaction_count = f.reaction_count,
+			reaction_counts = f.reaction_counts
+		FROM fresh f
+		WHERE comments.id = f.id
+		  AND (comments.pluses, comments.minuses, comments.score, comments.reaction_count, json(comments.reaction_counts))
+		      IS NOT (f.pluses, f.minuses, f.pluses - f.minuses, f.reaction_count, json(f.reaction_counts))
+	`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to reconcile comment counters: %w", err)
+	}
+	comments, _ := result.RowsAffected()
+
+	return int64(len(jokeIDs)), comments, nil
+}
+
+// RefreshRankings recomputes the ranking of every joke posted within window,
+// or of all jokes when window is zero. Jokes that were never ranked, such as
+// rows inserted by the seed migrations, are always included.
+func (r *CountersRepository) RefreshRankings(ctx context.Context, window time.Duration) (int64, error) {
+	seconds := int64(window.Seconds())
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM jokes
+		WHERE ?1 = 0
+		   OR created_at >= datetime('now', '-' || ?1 || ' seconds')
+		   OR hot_score = 0
+	`, seconds)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list jokes to rank: %w", err)
+	}
+
+	var jokeIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan joke to rank: %w", err)
+		}
+		jokeIDs = append(jokeIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating jokes to rank: %w", err)
+	}
+
+	for _, id := range jokeIDs {
+		if err := refreshJokeRanking(ctx, r.db, id); err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(jokeIDs)), nil
+}
@@ -1,7 +1,10 @@
 package sqlite
 
 import (
+	"badJokes/internal/models"
+	"context"
 	"database/sql"
+	"fmt"
 	"log/slog"
 )
 
@@ -17,45 +20,193 @@ func NewEntityRepository(db *sql.DB, log *slog.Logger) *EntityRepository {
 	}
 }
 
-func (r *EntityRepository) AddVote(entityType string, entityID, userID int64, voteType string) error {
-	_, err := r.db.Exec(`
-		INSERT INTO votes (entity_type, entity_id, user_id, vote_type, created_at, modified_at)
-		VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))
-		ON CONFLICT(entity_type, entity_id, user_id) DO UPDATE SET vote_type = ?, modified_at = datetime('now')`,
-		entityType, entityID, userID, voteType, voteType)
-	return err
+func (r *EntityRepository) AddVote(ctx context.Context, entityType string, entityID, userID int64, voteType string) error {
+	return r.mutate(ctx, entityType, entityID, true, func(tx *sql.Tx, table string) error {
+		var previous sql.NullString
+		err := tx.QueryRowContext(ctx, "SELECT vote_type FROM votes WHERE entity_type = ? AND entity_id = ? AND user_id = ?",
+			entityType, entityID, userID).Scan(&previous)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if previous.String == voteType {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO votes (entity_type, entity_id, user_id, vote_type, created_at, modified_at)
+			VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))
+			ON CONFLICT(entity_type, entity_id, user_id) DO UPDATE SET vote_type = ?, modified_at = datetime('now')`,
+			entityType, entityID, userID, voteType, voteType)
+		if err != nil {
+			return err
+		}
+
+		if err := applyVoteDelta(ctx, tx, table, entityID, previous.String, -1); err != nil {
+			return err
+		}
+		return applyVoteDelta(ctx, tx, table, entityID, voteType, 1)
+	})
 }
 
-func (r *EntityRepository) RemoveVote(entityType string, entityID, userID int64) error {
-	_, err := r.db.Exec("DELETE FROM votes WHERE entity_type = ? AND entity_id = ? AND user_id = ?", entityType, entityID, userID)
-	return err
+func (r *EntityRepository) RemoveVote(ctx context.Context, entityType string, entityID, userID int64) error {
+	return r.mutate(ctx, entityType, entityID, false, func(tx *sql.Tx, table string) error {
+		var previous string
+		err := tx.QueryRowContext(ctx, "DELETE FROM votes WHERE entity_type = ? AND entity_id = ? AND user_id = ? RETURNING vote_type",
+			entityType, entityID, userID).Scan(&previous)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return applyVoteDelta(ctx, tx, table, entityID, previous, -1)
+	})
 }
 
-func (r *EntityRepository) GetVote(entityType string, entityID, userID int64) (string, error) {
+func (r *EntityRepository) GetVote(ctx context.Context, entityType string, entityID, userID int64) (string, error) {
 	var voteType sql.NullString
-	err := r.db.QueryRow("SELECT vote_type FROM votes WHERE entity_type = ? AND entity_id = ? AND user_id = ?", entityType, entityID, userID).Scan(&voteType)
+	err := r.db.QueryRowContext(ctx, "SELECT vote_type FROM votes WHERE entity_type = ? AND entity_id = ? AND user_id = ?", entityType, entityID, userID).Scan(&voteType)
 	if err == sql.ErrNoRows {
 		return "", nil
 	}
 	return voteType.String, err
 }
 
-func (r *EntityRepository) AddReaction(entityType string, entityID, userID int64, reactionType string) error {
-	_, err := r.db.Exec(`
-		INSERT INTO interactions (entity_type, entity_id, user_id, type, created_at, modified_at)
-		VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))
-		ON CONFLICT(entity_type, entity_id, user_id, type) DO NOTHING`,
-		entityType, entityID, userID, reactionType)
-	return err
+func (r *EntityRepository) AddReaction(ctx context.Context, entityType string, entityID, userID int64, reactionType string) error {
+	return r.mutate(ctx, entityType, entityID, true, func(tx *sql.Tx, table string) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO interactions (entity_type, entity_id, user_id, type, created_at, modified_at)
+			VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))
+			ON CONFLICT(entity_type, entity_id, user_id, type) DO NOTHING
+			RETURNING id`,
+			entityType, entityID, userID, reactionType).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return applyReactionDelta(ctx, tx, table, entityID, reactionType, 1)
+	})
 }
 
-func (r *EntityRepository) RemoveReaction(entityType string, entityID, userID int64, reactionType string) error {
-	_, err := r.db.Exec("DELETE FROM interactions WHERE entity_type = ? AND entity_id = ? AND user_id = ? AND type = ?", entityType, entityID, userID, reactionType)
-	return err
+func (r *EntityRepository) RemoveReaction(ctx context.Context, entityType string, entityID, userID int64, reactionType string) error {
+	return r.mutate(ctx, entityType, entityID, false, func(tx *sql.Tx, table string) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, "DELETE FROM interactions WHERE entity_type = ? AND entity_id = ? AND user_id = ? AND type = ? RETURNING id",
+			entityType, entityID, userID, reactionType).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return applyReactionDelta(ctx, tx, table, entityID, reactionType, -1)
+	})
 }
 
-func (r *EntityRepository) GetReaction(entityType string, entityID, userID int64, reactionType string) (bool, error) {
+func (r *EntityRepository) GetReaction(ctx context.Context, entityType string, entityID, userID int64, reactionType string) (bool, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM interactions WHERE entity_type = ? AND entity_id = ? AND user_id = ? AND type = ?", entityType, entityID, userID, reactionType).Scan(&count)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM interactions WHERE entity_type = ? AND entity_id = ? AND user_id = ? AND type = ?", entityType, entityID, userID, reactionType).Scan(&count)
 	return count > 0, err
 }
+
+func (r *EntityRepository) GetSocial(ctx context.Context, entityType string, entityID, userID int64) (models.SocialInteractions, error) {
+	social := models.SocialInteractions{User: &models.UserInteraction{}}
+
+	table, err := counterTable(entityType)
+	if err != nil {
+		return social, err
+	}
+
+	var reactionCounts sql.NullString
+	err = r.db.QueryRowContext(ctx, "SELECT pluses, minuses, score, reaction_counts FROM "+table+" WHERE id = ?", entityID).
+		Scan(&social.Pluses, &social.Minuses, &social.Score, &reactionCounts)
+	if err != nil {
+		return social, mapError(err)
+	}
+	social.Reactions = decodeReactionCounts(reactionCounts)
+
+	social.User.VoteType, err = r.GetVote(ctx, entityType, entityID, userID)
+	if err != nil {
+		return social, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT type FROM interactions WHERE entity_type = ? AND entity_id = ? AND user_id = ? ORDER BY type",
+		entityType, entityID, userID)
+	if err != nil {
+		return social, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reactionType string
+		if err := rows.Scan(&reactionType); err != nil {
+			return social, err
+		}
+		social.User.Reactions = append(social.User.Reactions, reactionType)
+	}
+
+	return social, rows.Err()
+}
+
+func (r *EntityRepository) GetJokeID(ctx context.Context, entityType string, entityID int64) (int64, error) {
+	if entityType == "joke" {
+		return entityID, nil
+	}
+
+	var jokeID int64
+	err := r.db.QueryRowContext(ctx, "SELECT joke_id FROM comments WHERE id = ?", entityID).Scan(&jokeID)
+	return jokeID, mapError(err)
+}
+
+func (r *EntityRepository) GetAuthorID(ctx context.Context, entityType string, entityID int64) (int64, error) {
+	var query string
+	switch entityType {
+	case "joke":
+		query = "SELECT author_id FROM jokes WHERE id = ?"
+	case "comment":
+		query = "SELECT user_id FROM comments WHERE id = ? AND is_deleted = FALSE"
+	default:
+		return 0, fmt.Errorf("unknown entity type %q", entityType)
+	}
+
+	var authorID int64
+	err := r.db.QueryRowContext(ctx, query, entityID).Scan(&authorID)
+	return authorID, mapError(err)
+}
+
+// mutate applies a vote or reaction change together with the counter and
+// ranking updates it implies in one transaction. With live the entity must
+// exist and not be deleted.
+func (r *EntityRepository) mutate(ctx context.Context, entityType string, entityID int64, live bool, change func(tx *sql.Tx, table string) error) error {
+	table, err := counterTable(entityType)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if live {
+		if err := requireLive(ctx, tx, table, entityID); err != nil {
+			return err
+		}
+	}
+
+	if err := change(tx, table); err != nil {
+		return err
+	}
+
+	if entityType == "joke" {
+		if err := refreshJokeRanking(ctx, tx, entityID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
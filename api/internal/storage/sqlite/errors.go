@@ -1,6 +1,49 @@
 package sqlite
 
-import "fmt"
+import (
+	"badJokes/internal/storage/storeerr"
+	"database/sql"
+	"errors"
+	"strings"
 
-var ErrJokeNotFound = fmt.Errorf("joke not found")
-var ErrCommentNotFound = fmt.Errorf("comment not found")
\ No newline at end of file
+	"github.com/mattn/go-sqlite3"
+)
+
+var ErrJokeNotFound = storeerr.ErrJokeNotFound
+var ErrCommentNotFound = storeerr.ErrCommentNotFound
+
+// mapError translates sql.ErrNoRows and constraint violations into the
+// storeerr sentinels. Other errors are returned unchanged.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return storeerr.NotFound(err)
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return &storeerr.ConflictError{Field: conflictField(sqliteErr.Error()), Err: err}
+		case sqlite3.ErrConstraintForeignKey:
+			return storeerr.ForeignKey(err)
+		}
+	}
+	return err
+}
+
+// conflictField extracts the column from a message such as
+// `UNIQUE constraint failed: users.email`. Composite keys yield "".
+func conflictField(message string) string {
+	_, columns, ok := strings.Cut(message, "constraint failed: ")
+	if !ok || strings.Contains(columns, ",") {
+		return ""
+	}
+	_, field, ok := strings.Cut(columns, ".")
+	if !ok {
+		return ""
+	}
+	return field
+}
@@ -1,11 +1,14 @@
 package sqlite
 
 import (
+	"badJokes/internal/lib/ranking"
 	"badJokes/internal/models"
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -21,14 +24,14 @@ func NewJokesRepository(db *sql.DB, log *slog.Logger) *JokesRepository {
 		log: log.With(slog.String("component", "jokes_repository")),
 	}
 }
-func (r *JokesRepository) Insert(body string, authorID int64) (int64, error) {
-	stmt, err := r.db.Prepare("INSERT INTO jokes(body, author_id, created_at, modified_at) VALUES(?, ?, datetime('now'), datetime('now'))")
+func (r *JokesRepository) Insert(ctx context.Context, body string, authorID int64) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	res, err := stmt.Exec(body, authorID)
+	res, err := tx.ExecContext(ctx, "INSERT INTO jokes(body, author_id, created_at, modified_at) VALUES(?, ?, datetime('now'), datetime('now'))", body, authorID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to execute statement: %w", err)
 	}
@@ -38,29 +41,139 @@ func (r *JokesRepository) Insert(body string, authorID int64) (int64, error) {
 		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
 	}
 
+	if err := recordMentions(ctx, tx, "joke", id, id, authorID, body); err != nil {
+		return 0, err
+	}
+
+	if err := refreshJokeRanking(ctx, tx, id); err != nil {
+		return 0, fmt.Errorf("failed to refresh joke ranking: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return id, nil
 }
 
-func (r *JokesRepository) ListPage(page, pageSize int, sortField, order string, currentUserID int64) ([]models.Joke, error) {
+func (r *JokesRepository) ListPage(ctx context.Context, page, pageSize int, sortField, order string, currentUserID int64) ([]models.Joke, error) {
+	return r.listPage(ctx, page, pageSize, sortField, order, currentUserID, "")
+}
+
+func (r *JokesRepository) ListFeed(ctx context.Context, userID int64, page, pageSize int, sortField, order string) ([]models.Joke, error) {
+	return r.listPage(ctx, page, pageSize, sortField, order, userID,
+		"j.author_id IN (SELECT followee_id FROM follows WHERE follower_id = ?)", userID)
+}
+
+func (r *JokesRepository) ListBookmarks(ctx context.Context, userID int64, collection *string, page, pageSize int, sortField, order string) ([]models.Joke, error) {
+	if collection != nil {
+		return r.listPage(ctx, page, pageSize, sortField, order, userID,
+			"j.id IN (SELECT joke_id FROM bookmarks WHERE user_id = ? AND collection = ?)", userID, *collection)
+	}
+	return r.listPage(ctx, page, pageSize, sortField, order, userID,
+		"j.id IN (SELECT joke_id FROM bookmarks WHERE user_id = ?)", userID)
+}
+
+func (r *JokesRepository) AddBookmark(ctx context.Context, userID, jokeID int64, collection string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO bookmarks (user_id, joke_id, collection, created_at)
+		VALUES (?, ?, ?, datetime('now'))
+		ON CONFLICT (user_id, joke_id) DO UPDATE SET collection = excluded.collection`,
+		userID, jokeID, collection)
+	if err != nil {
+		return fmt.Errorf("failed to add bookmark: %w", mapError(err))
+	}
+	return nil
+}
+
+func (r *JokesRepository) RemoveBookmark(ctx context.Context, userID, jokeID int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM bookmarks WHERE user_id = ? AND joke_id = ?", userID, jokeID)
+	if err != nil {
+		return fmt.Errorf("failed to remove bookmark: %w", err)
+	}
+	return nil
+}
+
+func (r *JokesRepository) ListBookmarkCollections(ctx context.Context, userID int64) ([]models.BookmarkCollection, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT collection, COUNT(*)
+		FROM bookmarks
+		WHERE user_id = ?
+		GROUP BY collection
+		ORDER BY collection`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bookmark collections: %w", err)
+	}
+	defer rows.Close()
+
+	collections := []models.BookmarkCollection{}
+	for rows.Next() {
+		var collection models.BookmarkCollection
+		if err := rows.Scan(&collection.Name, &collection.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan bookmark collection: %w", err)
+		}
+		collections = append(collections, collection)
+	}
+	return collections, rows.Err()
+}
+
+func (r *JokesRepository) listPage(ctx context.Context, page, pageSize int, sortField, order string, currentUserID int64, filter string, filterArgs ...interface{}) ([]models.Joke, error) {
 	offset := (page - 1) * pageSize
+
+	var conditions []string
+	if filter != "" {
+		conditions = append(conditions, filter)
+	}
+	if sortField == "rising" {
+		conditions = append(conditions, rankingWindow(ranking.RisingWindow))
+	}
+	if period, ok := ranking.TopPeriods[sortField]; ok && period > 0 {
+		conditions = append(conditions, rankingWindow(period))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	orderBy := "j." + sortField + " " + order
+	switch sortField {
+	case "score":
+		orderBy = "j.score " + order
+	case "comments_count":
+		orderBy = "j.comment_count " + order
+	case "reactions_count":
+		orderBy = "j.reaction_count " + order
+	case "hot":
+		orderBy = "j.hot_score " + order + ", j.id " + order
+	case "rising":
+		orderBy = "j.rising_score " + order + ", j.id " + order
+	case "top_day", "top_week", "top_month", "top_all":
+		orderBy = "j.points " + order + ", j.created_at " + order
+	}
 	query := `
-        SELECT j.id, j.body, j.author_id, j.created_at, j.modified_at, 
-               COUNT(DISTINCT v.id) as vote_count,
-               COUNT(DISTINCT c.id) as comment_count,
-               GROUP_CONCAT(DISTINCT i.type) as reactions,
+        SELECT j.id, j.body, j.author_id, j.created_at, j.modified_at,
+               j.pluses,
+               j.minuses,
+               j.score,
+               j.comment_count,
+               j.reaction_counts,
+               j.mentions,
                COALESCE(uv.vote_type, '') as user_vote,
-               GROUP_CONCAT(DISTINCT uiv.type) as user_reactions
+               (SELECT group_concat(type, ',') FROM interactions
+                WHERE entity_id = j.id AND entity_type = 'joke' AND user_id = ?) as user_reactions,
+               EXISTS(SELECT 1 FROM bookmarks b WHERE b.joke_id = j.id AND b.user_id = ?) as bookmarked
         FROM jokes j
-        LEFT JOIN votes v ON j.id = v.entity_id AND v.entity_type = 'joke'
-        LEFT JOIN comments c ON j.id = c.joke_id
-        LEFT JOIN interactions i ON j.id = i.entity_id AND i.entity_type = 'joke'
         LEFT JOIN votes uv ON j.id = uv.entity_id AND uv.entity_type = 'joke' AND uv.user_id = ?
-        LEFT JOIN interactions uiv ON j.id = uiv.entity_id AND uiv.entity_type = 'joke' AND uiv.user_id = ?
-        GROUP BY j.id, j.body, j.author_id, j.created_at, j.modified_at, uv.vote_type
-        ORDER BY j.` + sortField + ` ` + order + `
+        ` + where + `
+        ORDER BY ` + orderBy + `
         LIMIT ? OFFSET ?`
 
-	rows, err := r.db.Query(query, currentUserID, currentUserID, pageSize, offset)
+	args := []interface{}{currentUserID, currentUserID, currentUserID}
+	args = append(args, filterArgs...)
+	args = append(args, pageSize, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list jokes: %w", err)
 	}
@@ -70,29 +183,25 @@ func (r *JokesRepository) ListPage(page, pageSize int, sortField, order string,
 	for rows.Next() {
 		var joke models.Joke
 		var reactions sql.NullString
+		var mentions sql.NullString
 		var userVote sql.NullString
 		var userReactions sql.NullString
+		var bookmarked bool
 
 		if err := rows.Scan(&joke.ID, &joke.Body, &joke.AuthorID, &joke.CreatedAt, &joke.ModifiedAt,
-			&joke.Social.Pluses, &joke.CommentCount, &reactions, &userVote, &userReactions); err != nil {
+			&joke.Social.Pluses, &joke.Social.Minuses, &joke.Social.Score, &joke.CommentCount, &reactions, &mentions, &userVote, &userReactions, &bookmarked); err != nil {
 			return nil, fmt.Errorf("failed to scan joke: %w", err)
 		}
 
-		reactionMap := map[string]int{}
-		if reactions.Valid && reactions.String != "[]" {
-			for _, reaction := range strings.Split(strings.Trim(reactions.String, "[]"), ",") {
-				reaction = strings.TrimSpace(reaction)
-				reactionMap[reaction]++
-			}
-		}
-		joke.Social.Reactions = reactionMap
+		joke.Social.Reactions = decodeReactionCounts(reactions)
+		joke.Mentions = decodeMentions(mentions)
 
 		if userVote.Valid && userVote.String != "" {
 			joke.Social.User = &models.UserInteraction{VoteType: userVote.String}
 		}
 
-		if userReactions.Valid && userReactions.String != "[]" {
-			userReactionsArray := strings.Split(strings.Trim(userReactions.String, "[]"), ",")
+		if userReactions.Valid && userReactions.String != "" {
+			userReactionsArray := strings.Split(userReactions.String, ",")
 			for i, r := range userReactionsArray {
 				userReactionsArray[i] = strings.TrimSpace(r)
 			}
@@ -102,13 +211,20 @@ func (r *JokesRepository) ListPage(page, pageSize int, sortField, order string,
 			joke.Social.User.Reactions = userReactionsArray
 		}
 
+		if bookmarked {
+			if joke.Social.User == nil {
+				joke.Social.User = &models.UserInteraction{}
+			}
+			joke.Social.User.Bookmarked = true
+		}
+
 		jokes = append(jokes, joke)
 	}
 
 	return jokes, nil
 }
 
-func (r *JokesRepository) GetJokeByID(jokeID, currentUserID int64) (models.Joke, error) {
+func (r *JokesRepository) GetJokeByID(ctx context.Context, jokeID, currentUserID int64) (models.Joke, error) {
 	query := `
         SELECT 
             j.id,
@@ -116,57 +232,57 @@ func (r *JokesRepository) GetJokeByID(jokeID, currentUserID int64) (models.Joke,
             j.author_id,
             j.created_at,
             j.modified_at,
-            (
-                SELECT COALESCE(SUM(CASE WHEN vote_type = 'plus' THEN 1 WHEN vote_type = 'minus' THEN -1 ELSE 0 END), 0)
-                FROM votes WHERE entity_id = j.id AND entity_type = 'joke'
-            ) AS vote_count,
-            COUNT(DISTINCT c.id) AS comment_count,
-            GROUP_CONCAT(DISTINCT i.type) as reactions,
+            j.pluses,
+            j.minuses,
+            j.score,
+            j.comment_count,
+            j.reaction_counts,
+            j.mentions,
             COALESCE(uv.vote_type, '') AS user_vote,
-            GROUP_CONCAT(DISTINCT uiv.type) as user_reactions,
+            (SELECT group_concat(type, ',') FROM interactions
+             WHERE entity_id = j.id AND entity_type = 'joke' AND user_id = ?) AS user_reactions,
+            EXISTS(SELECT 1 FROM bookmarks b WHERE b.joke_id = j.id AND b.user_id = ?) AS bookmarked,
             u.username AS author_username
         FROM jokes j
-        LEFT JOIN comments c ON j.id = c.joke_id
         LEFT JOIN votes uv ON j.id = uv.entity_id AND uv.entity_type = 'joke' AND uv.user_id = ?
-        LEFT JOIN interactions i ON j.id = i.entity_id AND i.entity_type = 'joke'
-        LEFT JOIN interactions uiv ON j.id = uiv.entity_id AND uiv.entity_type = 'joke' AND uiv.user_id = ?
         JOIN users u ON j.author_id = u.id
         WHERE j.id = ?
-        GROUP BY j.id, j.body, j.author_id, j.created_at, j.modified_at, uv.vote_type, u.username
     `
 
 	var joke models.Joke
 	var reactions sql.NullString
+	var mentions sql.NullString
 	var userVote sql.NullString
 	var userReactions sql.NullString
+	var bookmarked bool
 	var authorUsername string
 
-	err := r.db.QueryRow(query, currentUserID, currentUserID, jokeID).Scan(
+	err := r.db.QueryRowContext(ctx, query, currentUserID, currentUserID, currentUserID, jokeID).Scan(
 		&joke.ID,
 		&joke.Body,
 		&joke.AuthorID,
 		&joke.CreatedAt,
 		&joke.ModifiedAt,
 		&joke.Social.Pluses,
+		&joke.Social.Minuses,
+		&joke.Social.Score,
 		&joke.CommentCount,
 		&reactions,
+		&mentions,
 		&userVote,
 		&userReactions,
+		&bookmarked,
 		&authorUsername,
 	)
+	if err == sql.ErrNoRows {
+		return joke, ErrJokeNotFound
+	}
 	if err != nil {
 		return joke, err
 	}
 
-	reactionMap := map[string]int{}
-	if reactions.Valid && reactions.String != "" {
-		for _, reaction := range strings.Split(strings.TrimSpace(reactions.String), ",") {
-			if reaction != "" {
-				reactionMap[reaction]++
-			}
-		}
-	}
-	joke.Social.Reactions = reactionMap
+	joke.Social.Reactions = decodeReactionCounts(reactions)
+	joke.Mentions = decodeMentions(mentions)
 
 	if userVote.Valid && userVote.String != "" {
 		joke.Social.User = &models.UserInteraction{VoteType: userVote.String}
@@ -183,11 +299,51 @@ func (r *JokesRepository) GetJokeByID(jokeID, currentUserID int64) (models.Joke,
 		joke.Social.User.Reactions = userReactionsArray
 	}
 
+	if bookmarked {
+		if joke.Social.User == nil {
+			joke.Social.User = &models.UserInteraction{}
+		}
+		joke.Social.User.Bookmarked = true
+	}
+
 	joke.AuthorUsername = authorUsername
 	return joke, nil
 }
 
-func (r *JokesRepository) DeleteJoke(jokeID int64) error {
-	_, err := r.db.Exec("DELETE FROM jokes WHERE id = ?", jokeID)
-	return err
+// DeleteJoke removes a joke together with its bookmarks and the votes,
+// reactions and mentions on it and on its comments.
+func (r *JokesRepository) DeleteJoke(ctx context.Context, jokeID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"votes", "interactions"} {
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM `+table+`
+			WHERE (entity_type = 'joke' AND entity_id = ?)
+			   OR (entity_type = 'comment' AND entity_id IN (SELECT id FROM comments WHERE joke_id = ?))`,
+			jokeID, jokeID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mentions WHERE joke_id = ?", jokeID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM bookmarks WHERE joke_id = ?", jokeID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM jokes WHERE id = ?", jokeID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func rankingWindow(period time.Duration) string {
+	return fmt.Sprintf("j.created_at >= datetime('now', '-%d seconds')", int64(period.Seconds()))
 }
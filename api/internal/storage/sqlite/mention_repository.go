@@ -0,0 +1,144 @@
+package sqlite
+
+import (
+	"badJokes/internal/lib/mentions"
+	"badJokes/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+// recordMentions resolves the @usernames in body, stores a mention record for
+// every user other than the author and saves the resolved spans on the
+// entity's row. Names that match no user are left as plain text.
+func recordMentions(ctx context.Context, ex execer, entityType string, entityID, jokeID, authorID int64, body string) error {
+	spans := mentions.Find(body)
+	if len(spans) == 0 {
+		return nil
+	}
+
+	table, err := counterTable(entityType)
+	if err != nil {
+		return err
+	}
+
+	userIDs := make(map[string]int64)
+	resolved := []models.Mention{}
+	for _, span := range spans {
+		userID, known := userIDs[span.Username]
+		if !known {
+			err := ex.QueryRowContext(ctx, "SELECT id FROM users WHERE username = ?", span.Username).Scan(&userID)
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("failed to resolve mention: %w", err)
+			}
+			userIDs[span.Username] = userID
+		}
+		if userID == 0 {
+			continue
+		}
+
+		resolved = append(resolved, models.Mention{
+			UserID:   userID,
+			Username: span.Username,
+			Start:    span.Start,
+			End:      span.End,
+		})
+	}
+
+	if len(resolved) == 0 {
+		return nil
+	}
+
+	for _, mention := range resolved {
+		if mention.UserID == authorID {
+			continue
+		}
+		_, err := ex.ExecContext(ctx, `
+			INSERT INTO mentions (entity_type, entity_id, joke_id, mentioned_user_id, author_id, created_at)
+			VALUES (?, ?, ?, ?, ?, datetime('now'))
+			ON CONFLICT (entity_type, entity_id, mentioned_user_id) DO NOTHING`,
+			entityType, entityID, jokeID, mention.UserID, authorID)
+		if err != nil {
+			return fmt.Errorf("failed to record mention: %w", err)
+		}
+	}
+
+	encoded, err := json.Marshal(resolved)
+	if err != nil {
+		return err
+	}
+	_, err = ex.ExecContext(ctx, "UPDATE "+table+" SET mentions = ? WHERE id = ?", string(encoded), entityID)
+	return err
+}
+
+func decodeMentions(raw sql.NullString) []models.Mention {
+	decoded := []models.Mention{}
+	if raw.Valid && raw.String != "" {
+		json.Unmarshal([]byte(raw.String), &decoded)
+	}
+	return decoded
+}
+
+type MentionRepository struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func NewMentionRepository(db *sql.DB, log *slog.Logger) *MentionRepository {
+	return &MentionRepository{
+		db:  db,
+		log: log.With(slog.String("component", "mention_repository")),
+	}
+}
+
+// ListForUser returns the jokes and comments mentioning userID, newest first.
+func (r *MentionRepository) ListForUser(ctx context.Context, userID int64, page, pageSize int) ([]models.UserMention, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT
+			m.id,
+			m.entity_type,
+			m.entity_id,
+			m.joke_id,
+			m.author_id,
+			u.username,
+			COALESCE(c.body, j.body, ''),
+			m.created_at
+		FROM mentions m
+		JOIN users u ON u.id = m.author_id
+		LEFT JOIN comments c ON m.entity_type = 'comment' AND c.id = m.entity_id
+		LEFT JOIN jokes j ON m.entity_type = 'joke' AND j.id = m.entity_id
+		WHERE m.mentioned_user_id = ?
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ? OFFSET ?
+	`, userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mentions: %w", err)
+	}
+	defer rows.Close()
+
+	found := []models.UserMention{}
+	for rows.Next() {
+		var mention models.UserMention
+		if err := rows.Scan(
+			&mention.ID,
+			&mention.EntityType,
+			&mention.EntityID,
+			&mention.JokeID,
+			&mention.AuthorID,
+			&mention.AuthorUsername,
+			&mention.Body,
+			&mention.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan mention: %w", err)
+		}
+		found = append(found, mention)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating mention rows: %w", err)
+	}
+
+	return found, nil
+}
@@ -0,0 +1,187 @@
+package sqlite
+
+import (
+	"badJokes/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+type NotificationRepository struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func NewNotificationRepository(db *sql.DB, log *slog.Logger) *NotificationRepository {
+	return &NotificationRepository{
+		db:  db,
+		log: log.With(slog.String("component", "notification_repository")),
+	}
+}
+
+// Notify records an event for the author of the joke or comment. Self-events
+// and muted types are dropped, and while the recipient has an unread
+// notification for the same target the event is folded into it.
+func (r *NotificationRepository) Notify(ctx context.Context, eventType, entityType string, entityID, actorID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		WITH target AS (
+			SELECT author_id AS user_id, id AS joke_id
+			FROM jokes
+			WHERE ?2 = 'joke' AND id = ?3
+			UNION ALL
+			SELECT user_id, joke_id
+			FROM comments
+			WHERE ?2 = 'comment' AND id = ?3 AND is_deleted = 0
+		)
+		INSERT INTO notifications (user_id, type, entity_type, entity_id, joke_id, last_actor_id, event_count, created_at, updated_at)
+		SELECT t.user_id, ?1, ?2, ?3, t.joke_id, ?4, 1, datetime('now'), datetime('now')
+		FROM target t
+		WHERE t.user_id <> ?4
+		  AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences p
+			WHERE p.user_id = t.user_id AND p.type = ?1 AND p.enabled = 0
+		  )
+		ON CONFLICT (user_id, type, entity_type, entity_id) WHERE read_at IS NULL
+		DO UPDATE SET
+			event_count = notifications.event_count + 1,
+			last_actor_id = excluded.last_actor_id,
+			updated_at = datetime('now')
+	`, eventType, entityType, entityID, actorID)
+	if err != nil {
+		return fmt.Errorf("failed to record notification: %w", err)
+	}
+
+	return nil
+}
+
+func (r *NotificationRepository) List(ctx context.Context, userID int64, page, pageSize int, unreadOnly bool) ([]models.Notification, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT n.id, n.type, n.entity_type, n.entity_id, n.joke_id,
+		       COALESCE(n.last_actor_id, 0), COALESCE(u.username, ''),
+		       n.event_count, n.read_at IS NOT NULL, n.created_at, n.updated_at
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.last_actor_id
+		WHERE n.user_id = ? AND (NOT ? OR n.read_at IS NULL)
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT ? OFFSET ?
+	`, userID, unreadOnly, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(
+			&n.ID,
+			&n.Type,
+			&n.EntityType,
+			&n.EntityID,
+			&n.JokeID,
+			&n.LastActorID,
+			&n.LastActorUsername,
+			&n.EventCount,
+			&n.Read,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan notification row: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notification rows: %w", err)
+	}
+
+	return notifications, nil
+}
+
+func (r *NotificationRepository) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL",
+		userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkRead marks the given notifications of the user as read, or all of them
+// when ids is empty.
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID int64, ids []int64) error {
+	query := "UPDATE notifications SET read_at = datetime('now') WHERE user_id = ? AND read_at IS NULL"
+	args := []interface{}{userID}
+	if len(ids) > 0 {
+		query += " AND id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+
+	return nil
+}
+
+func (r *NotificationRepository) GetPreferences(ctx context.Context, userID int64) (map[string]bool, error) {
+	preferences := make(map[string]bool, len(models.NotificationTypes))
+	for _, t := range models.NotificationTypes {
+		preferences[t] = true
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT type, enabled FROM notification_preferences WHERE user_id = ?",
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventType string
+		var enabled bool
+		if err := rows.Scan(&eventType, &enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan notification preference: %w", err)
+		}
+		preferences[eventType] = enabled
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notification preferences: %w", err)
+	}
+
+	return preferences, nil
+}
+
+func (r *NotificationRepository) SetPreferences(ctx context.Context, userID int64, preferences map[string]bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for eventType, enabled := range preferences {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO notification_preferences (user_id, type, enabled)
+			VALUES (?, ?, ?)
+			ON CONFLICT (user_id, type) DO UPDATE SET enabled = excluded.enabled`,
+			userID, eventType, enabled)
+		if err != nil {
+			return fmt.Errorf("failed to store notification preference: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit notification preferences: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"badJokes/internal/lib/ranking"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// refreshJokeRanking recomputes the stored points, hot and rising scores of
+// a joke after one of its votes, reactions or comments changed.
+func refreshJokeRanking(ctx context.Context, ex execer, jokeID int64) error {
+	var score, reactions, comments, recentVotes int
+	var createdAt time.Time
+	var ageSeconds float64
+
+	err := ex.QueryRowContext(ctx, `
+		SELECT j.score, j.reaction_count, j.comment_count, j.created_at,
+			(julianday('now') - julianday(j.created_at)) * 86400,
+			(SELECT COALESCE(SUM(CASE WHEN v.vote_type = 'plus' THEN 1 ELSE -1 END), 0)
+			 FROM votes v
+			 WHERE v.entity_type = 'joke' AND v.entity_id = j.id
+			   AND v.modified_at >= datetime('now', '-' || ?2 || ' seconds'))
+		FROM jokes j
+		WHERE j.id = ?1
+	`, jokeID, int64(ranking.VelocityWindow.Seconds())).Scan(&score, &reactions, &comments, &createdAt, &ageSeconds, &recentVotes)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	points := ranking.Points(score, reactions, comments)
+	age := time.Duration(ageSeconds * float64(time.Second))
+
+	_, err = ex.ExecContext(ctx, "UPDATE jokes SET points = ?, hot_score = ?, rising_score = ? WHERE id = ?",
+		points, ranking.Hot(points, createdAt), ranking.Rising(recentVotes, age), jokeID)
+	return err
+}
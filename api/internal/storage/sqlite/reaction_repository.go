@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"badJokes/internal/models"
+	"badJokes/internal/storage/storeerr"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+type ReactionRepository struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func NewReactionRepository(db *sql.DB, log *slog.Logger) *ReactionRepository {
+	return &ReactionRepository{
+		db:  db,
+		log: log.With(slog.String("component", "reaction_repository")),
+	}
+}
+
+func (r *ReactionRepository) List(ctx context.Context) ([]models.Reaction, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT key, emoji, label, sort_order, enabled FROM reaction_catalog ORDER BY sort_order, key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reaction catalog: %w", err)
+	}
+	defer rows.Close()
+
+	reactions := []models.Reaction{}
+	for rows.Next() {
+		var reaction models.Reaction
+		if err := rows.Scan(&reaction.Key, &reaction.Emoji, &reaction.Label, &reaction.SortOrder, &reaction.Enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		reactions = append(reactions, reaction)
+	}
+
+	return reactions, rows.Err()
+}
+
+func (r *ReactionRepository) Get(ctx context.Context, key string) (*models.Reaction, error) {
+	var reaction models.Reaction
+	err := r.db.QueryRowContext(ctx, "SELECT key, emoji, label, sort_order, enabled FROM reaction_catalog WHERE key = ?", key).
+		Scan(&reaction.Key, &reaction.Emoji, &reaction.Label, &reaction.SortOrder, &reaction.Enabled)
+	if err == sql.ErrNoRows {
+		return nil, storeerr.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reaction, nil
+}
+
+func (r *ReactionRepository) Create(ctx context.Context, reaction models.Reaction) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO reaction_catalog (key, emoji, label, sort_order, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, datetime('now'), datetime('now'))
+		ON CONFLICT (key) DO NOTHING`,
+		reaction.Key, reaction.Emoji, reaction.Label, reaction.SortOrder, reaction.Enabled)
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (r *ReactionRepository) Update(ctx context.Context, reaction models.Reaction) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE reaction_catalog
+		SET emoji = ?, label = ?, sort_order = ?, enabled = ?, updated_at = datetime('now')
+		WHERE key = ?`,
+		reaction.Emoji, reaction.Label, reaction.SortOrder, reaction.Enabled, reaction.Key)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return storeerr.ErrNotFound
+	}
+	return nil
+}
+
+func (r *ReactionRepository) Retire(ctx context.Context, key string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE reaction_catalog SET enabled = FALSE, updated_at = datetime('now') WHERE key = ?", key)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return storeerr.ErrNotFound
+	}
+	return nil
+}
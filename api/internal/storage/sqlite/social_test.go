@@ -0,0 +1,211 @@
+package sqlite
+
+import (
+	"badJokes/internal/lib/commenttree"
+	"badJokes/internal/models"
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const testSchema = `
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE
+);
+CREATE TABLE jokes (
+	id INTEGER PRIMARY KEY,
+	body TEXT NOT NULL,
+	author_id INTEGER NOT NULL REFERENCES users(id),
+	created_at TIMESTAMP,
+	modified_at TIMESTAMP,
+	pluses INTEGER NOT NULL DEFAULT 0,
+	minuses INTEGER NOT NULL DEFAULT 0,
+	score INTEGER NOT NULL DEFAULT 0,
+	comment_count INTEGER NOT NULL DEFAULT 0,
+	reaction_count INTEGER NOT NULL DEFAULT 0,
+	reaction_counts TEXT NOT NULL DEFAULT '{}',
+	points REAL NOT NULL DEFAULT 0,
+	hot_score REAL NOT NULL DEFAULT 0,
+	rising_score REAL NOT NULL DEFAULT 0,
+	mentions TEXT NOT NULL DEFAULT '[]'
+);
+CREATE TABLE comments (
+	id INTEGER PRIMARY KEY,
+	joke_id INTEGER NOT NULL REFERENCES jokes(id),
+	parent_id INTEGER NULL,
+	body TEXT NOT NULL,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	created_at TIMESTAMP,
+	modified_at TIMESTAMP,
+	is_deleted BOOLEAN NOT NULL DEFAULT 0,
+	pluses INTEGER NOT NULL DEFAULT 0,
+	minuses INTEGER NOT NULL DEFAULT 0,
+	score INTEGER NOT NULL DEFAULT 0,
+	reaction_count INTEGER NOT NULL DEFAULT 0,
+	reaction_counts TEXT NOT NULL DEFAULT '{}',
+	mentions TEXT NOT NULL DEFAULT '[]'
+);
+CREATE TABLE votes (
+	id INTEGER PRIMARY KEY,
+	entity_type TEXT NOT NULL,
+	entity_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	vote_type TEXT NOT NULL,
+	created_at TIMESTAMP,
+	modified_at TIMESTAMP,
+	UNIQUE(entity_type, entity_id, user_id)
+);
+CREATE TABLE interactions (
+	id INTEGER PRIMARY KEY,
+	entity_type TEXT NOT NULL,
+	entity_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	created_at TIMESTAMP,
+	modified_at TIMESTAMP,
+	UNIQUE(entity_type, entity_id, user_id, type)
+);
+CREATE TABLE mentions (
+	id INTEGER PRIMARY KEY,
+	entity_type TEXT NOT NULL,
+	entity_id INTEGER NOT NULL,
+	joke_id INTEGER NOT NULL,
+	mentioned_user_id INTEGER NOT NULL,
+	author_id INTEGER NOT NULL,
+	created_at TIMESTAMP,
+	UNIQUE(entity_type, entity_id, mentioned_user_id)
+);
+CREATE TABLE follows (
+	follower_id INTEGER NOT NULL,
+	followee_id INTEGER NOT NULL,
+	created_at TIMESTAMP,
+	PRIMARY KEY (follower_id, followee_id)
+);
+CREATE TABLE bookmarks (
+	user_id INTEGER NOT NULL,
+	joke_id INTEGER NOT NULL,
+	collection TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP,
+	PRIMARY KEY (user_id, joke_id)
+);
+INSERT INTO users (id, username) VALUES (1, 'alice'), (2, 'bob'), (3, 'carol'), (4, 'dave');
+`
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(testSchema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	return db
+}
+
+func castVotes(t *testing.T, entities *EntityRepository, entityType string, entityID int64, votes map[int64]string) {
+	t.Helper()
+
+	for userID, voteType := range votes {
+		if err := entities.AddVote(context.Background(), entityType, entityID, userID, voteType); err != nil {
+			t.Fatalf("vote %s by user %d on %s %d: %v", voteType, userID, entityType, entityID, err)
+		}
+	}
+}
+
+func assertTallies(t *testing.T, name string, got models.SocialInteractions, pluses, minuses int) {
+	t.Helper()
+
+	if got.Pluses != pluses || got.Minuses != minuses || got.Score != pluses-minuses {
+		t.Errorf("%s: got pluses=%d minuses=%d score=%d, want pluses=%d minuses=%d score=%d",
+			name, got.Pluses, got.Minuses, got.Score, pluses, minuses, pluses-minuses)
+	}
+}
+
+// The scans must fill the real plus and minus tallies rather than deriving
+// both from the net score.
+func TestJokeScansFillVoteTallies(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	jokes := NewJokesRepository(db, log)
+	entities := NewEntityRepository(db, log)
+
+	jokeID, err := jokes.Insert(ctx, "knock knock", 1)
+	if err != nil {
+		t.Fatalf("insert joke: %v", err)
+	}
+	castVotes(t, entities, "joke", jokeID, map[int64]string{2: "plus", 3: "plus", 4: "minus"})
+
+	joke, err := jokes.GetJokeByID(ctx, jokeID, 0)
+	if err != nil {
+		t.Fatalf("get joke: %v", err)
+	}
+	assertTallies(t, "GetJokeByID", joke.Social, 2, 1)
+
+	listed, err := jokes.ListPage(ctx, 1, 10, "created_at", "desc", 0)
+	if err != nil {
+		t.Fatalf("list jokes: %v", err)
+	}
+	if len(listed) != 1 {
+		t.Fatalf("ListPage returned %d jokes, want 1", len(listed))
+	}
+	assertTallies(t, "ListPage", listed[0].Social, 2, 1)
+
+	social, err := entities.GetSocial(ctx, "joke", jokeID, 0)
+	if err != nil {
+		t.Fatalf("get social: %v", err)
+	}
+	assertTallies(t, "GetSocial", social, 2, 1)
+}
+
+func TestCommentScansFillVoteTallies(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	jokes := NewJokesRepository(db, log)
+	comments := NewCommentsRepository(db, log)
+	entities := NewEntityRepository(db, log)
+
+	jokeID, err := jokes.Insert(ctx, "knock knock", 1)
+	if err != nil {
+		t.Fatalf("insert joke: %v", err)
+	}
+	commentID, err := comments.AddComment(ctx, jokeID, 1, "who's there?", nil)
+	if err != nil {
+		t.Fatalf("add comment: %v", err)
+	}
+	castVotes(t, entities, "comment", commentID, map[int64]string{2: "plus", 3: "minus", 4: "minus"})
+
+	comment, err := comments.GetCommentByID(ctx, commentID)
+	if err != nil {
+		t.Fatalf("get comment: %v", err)
+	}
+	assertTallies(t, "GetCommentByID", comment.Social, 1, 2)
+
+	page, err := comments.GetTopLevelComments(ctx, jokeID, 0, commenttree.Page{Limit: 10})
+	if err != nil {
+		t.Fatalf("list comments: %v", err)
+	}
+	if len(page.Comments) != 1 {
+		t.Fatalf("GetTopLevelComments returned %d comments, want 1", len(page.Comments))
+	}
+	assertTallies(t, "GetTopLevelComments", page.Comments[0].Social, 1, 2)
+
+	social, err := entities.GetSocial(ctx, "comment", commentID, 0)
+	if err != nil {
+		t.Fatalf("get social: %v", err)
+	}
+	assertTallies(t, "GetSocial", social, 1, 2)
+}
@@ -2,6 +2,7 @@ package sqlite
 
 import (
 	"badJokes/internal/models"
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
@@ -21,21 +22,21 @@ func NewUserRepository(db *sql.DB, log *slog.Logger) *UserRepository {
 	}
 }
 
-func (r *UserRepository) Register(username, email, password string) (int64, error) {
+func (r *UserRepository) Register(ctx context.Context, username, email, password string) (int64, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return 0, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	stmt, err := r.db.Prepare("INSERT INTO users (username, email, password) VALUES (?, ?, ?)")
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO users (username, email, password) VALUES (?, ?, ?)")
 	if err != nil {
 		return 0, fmt.Errorf("failed to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(username, email, hashedPassword)
+	res, err := stmt.ExecContext(ctx, username, email, hashedPassword)
 	if err != nil {
-		return 0, fmt.Errorf("failed to execute statement: %w", err)
+		return 0, fmt.Errorf("failed to insert user: %w", mapError(err))
 	}
 
 	id, err := res.LastInsertId()
@@ -46,12 +47,12 @@ func (r *UserRepository) Register(username, email, password string) (int64, erro
 	return id, nil
 }
 
-func (r *UserRepository) Authenticate(email, password string) (*models.User, error) {
+func (r *UserRepository) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
 	var user models.User
 	var storedPassword string
 	var isPasswordHashed int
 
-	err := r.db.QueryRow(`
+	err := r.db.QueryRowContext(ctx, `
 		SELECT id, username, email, password, is_password_hashed
 		FROM users
 		WHERE email = ?
@@ -78,7 +79,7 @@ func (r *UserRepository) Authenticate(email, password string) (*models.User, err
 			return nil, fmt.Errorf("failed to hash password: %w", err)
 		}
 
-		_, err = r.db.Exec(`
+		_, err = r.db.ExecContext(ctx, `
 			UPDATE users
 			SET password = ?, is_password_hashed = 1, modified_at = CURRENT_TIMESTAMP
 			WHERE id = ?
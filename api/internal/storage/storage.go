@@ -1,46 +1,118 @@
 package storage
 
 import (
+	"badJokes/internal/lib/commenttree"
 	"badJokes/internal/models"
 	"badJokes/internal/storage/postgres"
 	"badJokes/internal/storage/sqlite"
+	"badJokes/internal/storage/storeerr"
+	"context"
 	"database/sql"
 	"log/slog"
+	"time"
 )
 
+// Errors returned by every repository regardless of driver. Match them with
+// errors.Is; use errors.As with *ConflictError to learn which field clashed.
+var (
+	ErrNotFound        = storeerr.ErrNotFound
+	ErrConflict        = storeerr.ErrConflict
+	ErrForeignKey      = storeerr.ErrForeignKey
+	ErrJokeNotFound    = storeerr.ErrJokeNotFound
+	ErrCommentNotFound = storeerr.ErrCommentNotFound
+)
+
+type ConflictError = storeerr.ConflictError
+
 type UserRepository interface {
-	Register(username, email, password string) (int64, error)
-	Authenticate(email, password string) (*models.User, error)
-	GetUsers(page, pageSize int) ([]*models.User, error)
-	GetUserCount() (int, error)
-	SetAdminStatus(userID int64, isAdmin bool) error
-	GetModerationLogs(page, pageSize int) ([]*models.ModerationLog, error)
-	GetUserStats() (*models.UserStats, error)
-	FindOrCreateOAuthUser(email, username, provider, providerID string) (*models.User, error)
+	Register(ctx context.Context, username, email, password string) (int64, error)
+	Authenticate(ctx context.Context, email, password string) (*models.User, error)
+	GetUsers(ctx context.Context, page, pageSize int) ([]*models.User, error)
+	GetUserCount(ctx context.Context) (int, error)
+	SetAdminStatus(ctx context.Context, userID int64, isAdmin bool) error
+	GetModerationLogs(ctx context.Context, page, pageSize int) ([]*models.ModerationLog, error)
+	GetUserStats(ctx context.Context) (*models.UserStats, error)
+	FindOrCreateOAuthUser(ctx context.Context, email string, emailVerified bool, username, provider, providerID string) (*models.User, error)
+	GetUserByID(ctx context.Context, userID int64) (*models.User, error)
+	GetTOTPSecret(ctx context.Context, userID int64) (string, bool, error)
+	SetPendingTOTPSecret(ctx context.Context, userID int64, secret string) error
+	EnableTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, userID int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, recoveryCodeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+	AcceptTOTPStep(ctx context.Context, userID, step int64) (bool, error)
+	RecordTOTPFailure(ctx context.Context, userID int64, maxAttempts int, lockout time.Duration) (bool, error)
+	ResetTOTPFailures(ctx context.Context, userID int64) error
+	TOTPLockRemaining(ctx context.Context, userID int64) (time.Duration, error)
+	CreateLoginCode(ctx context.Context, userID int64, codeHash string, twoFactorPending bool, ttl time.Duration) error
+	ConsumeLoginCode(ctx context.Context, codeHash string) (int64, bool, error)
+	Follow(ctx context.Context, followerID, followeeID int64) error
+	Unfollow(ctx context.Context, followerID, followeeID int64) error
+	CountFollowing(ctx context.Context, userID int64) (int, error)
+	GetProfile(ctx context.Context, userID, viewerID int64) (*models.UserProfile, error)
 }
 
 type JokesRepository interface {
-	Insert(body string, authorID int64) (int64, error)
-	ListPage(page, pageSize int, sortField, order string, currentUserID int64) ([]models.Joke, error)
-	GetJokeByID(jokeID, currentUserID int64) (models.Joke, error)
-	DeleteJoke(jokeID int64) error
+	Insert(ctx context.Context, body string, authorID int64) (int64, error)
+	ListPage(ctx context.Context, page, pageSize int, sortField, order string, currentUserID int64) ([]models.Joke, error)
+	ListFeed(ctx context.Context, userID int64, page, pageSize int, sortField, order string) ([]models.Joke, error)
+	ListBookmarks(ctx context.Context, userID int64, collection *string, page, pageSize int, sortField, order string) ([]models.Joke, error)
+	AddBookmark(ctx context.Context, userID, jokeID int64, collection string) error
+	RemoveBookmark(ctx context.Context, userID, jokeID int64) error
+	ListBookmarkCollections(ctx context.Context, userID int64) ([]models.BookmarkCollection, error)
+	GetJokeByID(ctx context.Context, jokeID, currentUserID int64) (models.Joke, error)
+	DeleteJoke(ctx context.Context, jokeID int64) error
 }
 
 type CommentsRepository interface {
-	AddComment(jokeID, userID int64, body string, parentID *int64) (int64, error)
-	GetComments(jokeID int64) ([]models.Comment, error)
-	GetCommentsByJokeID(jokeID, currentUserID int64) ([]models.Comment, error)
-	DeleteComment(commentID int64) error
-	GetCommentByID(commentID int64) (models.Comment, error)
+	AddComment(ctx context.Context, jokeID, userID int64, body string, parentID *int64) (int64, error)
+	GetComments(ctx context.Context, jokeID int64) ([]models.Comment, error)
+	GetTopLevelComments(ctx context.Context, jokeID, currentUserID int64, page commenttree.Page) (models.CommentPage, error)
+	GetReplies(ctx context.Context, parentID, currentUserID int64, page commenttree.Page) (models.CommentPage, error)
+	GetCommentThread(ctx context.Context, commentID, currentUserID int64, page commenttree.Page) (models.CommentThread, error)
+	DeleteComment(ctx context.Context, commentID int64) error
+	GetCommentByID(ctx context.Context, commentID int64) (models.Comment, error)
 }
 
 type EntityRepository interface {
-	AddVote(entityType string, entityID, userID int64, voteType string) error
-	RemoveVote(entityType string, entityID, userID int64) error
-	GetVote(entityType string, entityID, userID int64) (string, error)
-	AddReaction(entityType string, entityID, userID int64, reactionType string) error
-	RemoveReaction(entityType string, entityID, userID int64, reactionType string) error
-	GetReaction(entityType string, entityID, userID int64, reactionType string) (bool, error)
+	AddVote(ctx context.Context, entityType string, entityID, userID int64, voteType string) error
+	RemoveVote(ctx context.Context, entityType string, entityID, userID int64) error
+	GetVote(ctx context.Context, entityType string, entityID, userID int64) (string, error)
+	AddReaction(ctx context.Context, entityType string, entityID, userID int64, reactionType string) error
+	RemoveReaction(ctx context.Context, entityType string, entityID, userID int64, reactionType string) error
+	GetReaction(ctx context.Context, entityType string, entityID, userID int64, reactionType string) (bool, error)
+	GetJokeID(ctx context.Context, entityType string, entityID int64) (int64, error)
+	GetAuthorID(ctx context.Context, entityType string, entityID int64) (int64, error)
+	GetSocial(ctx context.Context, entityType string, entityID, userID int64) (models.SocialInteractions, error)
+}
+
+type NotificationRepository interface {
+	Notify(ctx context.Context, eventType, entityType string, entityID, actorID int64) error
+	List(ctx context.Context, userID int64, page, pageSize int, unreadOnly bool) ([]models.Notification, error)
+	UnreadCount(ctx context.Context, userID int64) (int, error)
+	MarkRead(ctx context.Context, userID int64, ids []int64) error
+	GetPreferences(ctx context.Context, userID int64) (map[string]bool, error)
+	SetPreferences(ctx context.Context, userID int64, preferences map[string]bool) error
+}
+
+type ReactionRepository interface {
+	List(ctx context.Context) ([]models.Reaction, error)
+	Get(ctx context.Context, key string) (*models.Reaction, error)
+	Create(ctx context.Context, reaction models.Reaction) (bool, error)
+	Update(ctx context.Context, reaction models.Reaction) error
+	Retire(ctx context.Context, key string) error
+}
+
+// MentionRepository lists the jokes and comments that mention a user.
+type MentionRepository interface {
+	ListForUser(ctx context.Context, userID int64, page, pageSize int) ([]models.UserMention, error)
+}
+
+// CountersRepository rebuilds the denormalized vote, reaction and comment
+// counters from their source tables, and the joke rankings derived from them.
+type CountersRepository interface {
+	Reconcile(ctx context.Context) (jokesFixed, commentsFixed int64, err error)
+	RefreshRankings(ctx context.Context, window time.Duration) (int64, error)
 }
 
 func NewUserRepository(dbType string, dbConn *sql.DB, log *slog.Logger) UserRepository {
@@ -84,3 +156,47 @@ func NewEntityRepository(dbType string, dbConn *sql.DB, log *slog.Logger) Entity
 		panic("unsupported database type")
 	}
 }
+
+func NewNotificationRepository(dbType string, dbConn *sql.DB, log *slog.Logger) NotificationRepository {
+	switch dbType {
+	case "postgres":
+		return postgres.NewNotificationRepository(dbConn, log)
+	case "sqlite":
+		return sqlite.NewNotificationRepository(dbConn, log)
+	default:
+		panic("unsupported database type")
+	}
+}
+
+func NewCountersRepository(dbType string, dbConn *sql.DB, log *slog.Logger) CountersRepository {
+	switch dbType {
+	case "postgres":
+		return postgres.NewCountersRepository(dbConn, log)
+	case "sqlite":
+		return sqlite.NewCountersRepository(dbConn, log)
+	default:
+		panic("unsupported database type")
+	}
+}
+
+func NewReactionRepository(dbType string, dbConn *sql.DB, log *slog.Logger) ReactionRepository {
+	switch dbType {
+	case "postgres":
+		return postgres.NewReactionRepository(dbConn, log)
+	case "sqlite":
+		return sqlite.NewReactionRepository(dbConn, log)
+	default:
+		panic("unsupported database type")
+	}
+}
+
+func NewMentionRepository(dbType string, dbConn *sql.DB, log *slog.Logger) MentionRepository {
+	switch dbType {
+	case "postgres":
+		return postgres.NewMentionRepository(dbConn, log)
+	case "sqlite":
+		return sqlite.NewMentionRepository(dbConn, log)
+	default:
+		panic("unsupported database type")
+	}
+}
@@ -0,0 +1,54 @@
+// Package storeerr defines the errors repositories return for conditions
+// callers are expected to handle. Both drivers translate their native errors
+// into these, so handlers never need to know which database is in use.
+package storeerr
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would violate a uniqueness
+	// constraint. Errors matching it are usually a *ConflictError.
+	ErrConflict = errors.New("conflict")
+	// ErrForeignKey is returned when a write references a row that does not
+	// exist, or a delete would orphan rows that reference it.
+	ErrForeignKey = errors.New("foreign key violation")
+
+	ErrJokeNotFound    = fmt.Errorf("joke %w", ErrNotFound)
+	ErrCommentNotFound = fmt.Errorf("comment %w", ErrNotFound)
+)
+
+// ConflictError reports which field clashed with an existing row. Field is
+// empty when the driver could not tell, e.g. for composite keys.
+type ConflictError struct {
+	Field string
+	Err   error
+}
+
+func (e *ConflictError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("conflict: %v", e.Err)
+	}
+	return fmt.Sprintf("conflict on %s: %v", e.Field, e.Err)
+}
+
+// Unwrap makes a ConflictError match both ErrConflict and the driver error.
+func (e *ConflictError) Unwrap() []error {
+	return []error{ErrConflict, e.Err}
+}
+
+// NotFound wraps a driver's "no rows" error so it matches ErrNotFound while
+// keeping the original in the chain.
+func NotFound(err error) error {
+	return fmt.Errorf("%w: %w", ErrNotFound, err)
+}
+
+// ForeignKey wraps a driver's foreign key violation so it matches
+// ErrForeignKey.
+func ForeignKey(err error) error {
+	return fmt.Errorf("%w: %w", ErrForeignKey, err)
+}
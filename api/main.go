@@ -2,8 +2,13 @@ package main
 
 import (
 	"badJokes/internal/config"
+	"badJokes/internal/events"
+	"badJokes/internal/http-server/apierror"
 	"badJokes/internal/http-server/handlers"
 	"badJokes/internal/http-server/middleware"
+	"badJokes/internal/http-server/session"
+	"badJokes/internal/lib/jwtkeys"
+	"badJokes/internal/lib/ranking"
 	"badJokes/internal/lib/sl"
 	"badJokes/internal/storage"
 	"context"
@@ -12,8 +17,12 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -22,6 +31,10 @@ func main() {
 	cfg := config.MustLoad()
 	log := setupLogger(cfg.Env)
 
+	listenAddr := flag.String("listenaddr", cfg.HTTPServer.Address, "HTTP server listen address")
+	reconcileCounters := flag.Bool("reconcile-counters", false, "Recompute vote, reaction and comment counters and exit")
+	flag.Parse()
+
 	log.Info("Starting application", slog.String("env", cfg.Env))
 
 	db, err := sql.Open(cfg.Db.Driver, cfg.Db.ConnectionString)
@@ -37,231 +50,319 @@ func main() {
 	}
 	log.Info("Database migrations completed successfully")
 
+	if *reconcileCounters {
+		jokesFixed, commentsFixed, err := storage.NewCountersRepository(cfg.Db.Driver, db, log).Reconcile(context.Background())
+		if err != nil {
+			log.Error("Failed to reconcile counters", sl.Err(err))
+			os.Exit(1)
+		}
+		log.Info("Counters reconciled",
+			slog.Int64("jokes_fixed", jokesFixed),
+			slog.Int64("comments_fixed", commentsFixed))
+		return
+	}
+
+	// Seed migrations insert jokes without ranking them, and rising scores
+	// of recent jokes move with time, so rank them before serving.
+	countersRepo := storage.NewCountersRepository(cfg.Db.Driver, db, log)
+	if ranked, err := countersRepo.RefreshRankings(context.Background(), ranking.RisingWindow); err != nil {
+		log.Warn("Failed to refresh joke rankings", sl.Err(err))
+	} else {
+		log.Info("Joke rankings refreshed", slog.Int64("jokes", ranked))
+	}
+
 	userRepo := storage.NewUserRepository(cfg.Db.Driver, db, log)
 	jokesRepo := storage.NewJokesRepository(cfg.Db.Driver, db, log)
 	commentRepo := storage.NewCommentsRepository(cfg.Db.Driver, db, log)
 	entityRepo := storage.NewEntityRepository(cfg.Db.Driver, db, log)
+	notificationRepo := storage.NewNotificationRepository(cfg.Db.Driver, db, log)
+	reactionRepo := storage.NewReactionRepository(cfg.Db.Driver, db, log)
+	mentionRepo := storage.NewMentionRepository(cfg.Db.Driver, db, log)
+
+	keys, err := jwtkeys.Load(cfg.JWT.SigningKeyFile, cfg.JWT.VerificationKeyFiles, cfg.JWTSecret)
+	if err != nil {
+		log.Error("Failed to load JWT keys", sl.Err(err))
+		os.Exit(1)
+	}
+	log.Info("JWT keys loaded", slog.String("signing_kid", keys.SigningKeyID()))
+
+	sessions := session.NewManager(cfg.Session)
+	hub := events.NewHub(cfg.Stream.HistorySize, cfg.Stream.MaxConnections)
 
-	jokesHandler := handlers.NewJokesHandler(jokesRepo, commentRepo, log)
-	commentHandler := handlers.NewCommentHandler(commentRepo, log)
-	entityHandler := handlers.NewEntityHandler(entityRepo, log)
-	authHandler := handlers.NewAuthHandler(userRepo, cfg, log)
-	oauthHandler := handlers.NewOAuthHandler(userRepo, cfg, log)
+	jokesHandler := handlers.NewJokesHandler(jokesRepo, commentRepo, hub, cfg, log)
+	commentHandler := handlers.NewCommentHandler(commentRepo, notificationRepo, hub, cfg, log)
+	entityHandler := handlers.NewEntityHandler(entityRepo, reactionRepo, notificationRepo, hub, cfg, log)
+	authHandler := handlers.NewAuthHandler(userRepo, cfg, keys, sessions, log)
+	oauthHandler := handlers.NewOAuthHandler(userRepo, cfg, keys, sessions, log)
+	twoFactorHandler := handlers.NewTwoFactorHandler(userRepo, cfg, keys, sessions, log)
 	adminHandler := handlers.NewAdminHandler(userRepo, jokesRepo, commentRepo, log)
+	jwksHandler := handlers.NewJWKSHandler(keys, log)
+	notificationHandler := handlers.NewNotificationHandler(notificationRepo, log)
+	streamHandler := handlers.NewStreamHandler(hub, cfg, log)
+	userHandler := handlers.NewUserHandler(userRepo, jokesRepo, log)
+	reactionHandler := handlers.NewReactionHandler(reactionRepo, log)
+	mentionHandler := handlers.NewMentionHandler(mentionRepo, log)
+	bookmarkHandler := handlers.NewBookmarkHandler(jokesRepo, log)
+
+	authMiddleware := middleware.NewAuthMiddleware(cfg, keys, sessions, log)
+	liveHandler := handlers.NewLiveHandler(hub, authMiddleware, cfg, log)
+
+	router := chi.NewRouter()
+	setupRoutes(router, jokesHandler, commentHandler, entityHandler, authHandler, adminHandler, oauthHandler, twoFactorHandler, jwksHandler, notificationHandler, streamHandler, liveHandler, userHandler, reactionHandler, mentionHandler, bookmarkHandler, authMiddleware, cfg.HTTPServer.Timeout, cfg.HTTPServer.OAuthTimeout)
+	handler := corsMiddleware(router, sessions, cfg.Session.AllowedOrigins)
+
+	srv := &http.Server{
+		Addr:              *listenAddr,
+		Handler:           handler,
+		ReadTimeout:       cfg.HTTPServer.Timeout,
+		ReadHeaderTimeout: cfg.HTTPServer.ReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPServer.Timeout,
+		IdleTimeout:       cfg.HTTPServer.IdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPServer.MaxHeaderBytes,
+	}
 
-	authMiddleware := middleware.NewAuthMiddleware(cfg, log)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	mux := http.NewServeMux()
-	setupRoutes(mux, jokesHandler, commentHandler, entityHandler, authHandler, adminHandler, oauthHandler, authMiddleware)
-	handler := corsMiddleware(mux)
+	go refreshRankings(ctx, countersRepo, cfg.Social.RankingRefreshInterval, log)
 
-	listenAddr := flag.String("listenaddr", cfg.HTTPServer.Address, "HTTP server listen address")
-	flag.Parse()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+	log.Info("Server started", slog.String("address", *listenAddr))
 
-	log.Info("Server started", slog.String("address", cfg.HTTPServer.Address))
-	if err := http.ListenAndServe(*listenAddr, handler); err != nil {
+	select {
+	case err := <-serverErr:
 		log.Error("Failed to start server", sl.Err(err))
+		hub.Close()
+		db.Close()
 		os.Exit(1)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process without waiting for the drain.
+	stop()
+
+	log.Info("Shutting down server", slog.Duration("drain_timeout", cfg.HTTPServer.ShutdownTimeout))
+
+	// Event streams and live sockets only end when their subscriptions do, so
+	// the hub closes first to let them finish within the drain deadline.
+	hub.Close()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTPServer.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("Server did not drain before the deadline", sl.Err(err))
+		srv.Close()
+	}
+
+	if err := db.Close(); err != nil {
+		log.Error("Failed to close database", sl.Err(err))
+	}
+
+	log.Info("Server stopped")
+}
+
+// refreshRankings re-ranks recent jokes every interval until ctx is done.
+// Rising scores count only the votes cast within the velocity window, so they
+// fall as those votes age even when nothing else changes.
+func refreshRankings(ctx context.Context, repo storage.CountersRepository, interval time.Duration, log *slog.Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := repo.RefreshRankings(ctx, ranking.RisingWindow); err != nil && ctx.Err() == nil {
+				log.Warn("Failed to refresh joke rankings", sl.Err(err))
+			}
+		}
 	}
 }
 
 func setupRoutes(
-	mux *http.ServeMux,
+	router chi.Router,
 	jokesHandler *handlers.JokesHandler,
 	commentHandler *handlers.CommentHandler,
 	entityHandler *handlers.EntityHandler,
 	authHandler *handlers.AuthHandler,
 	adminHandler *handlers.AdminHandler,
 	oauthHandler *handlers.OAuthHandler,
+	twoFactorHandler *handlers.TwoFactorHandler,
+	jwksHandler *handlers.JWKSHandler,
+	notificationHandler *handlers.NotificationHandler,
+	streamHandler *handlers.StreamHandler,
+	liveHandler *handlers.LiveHandler,
+	userHandler *handlers.UserHandler,
+	reactionHandler *handlers.ReactionHandler,
+	mentionHandler *handlers.MentionHandler,
+	bookmarkHandler *handlers.BookmarkHandler,
 	authMiddleware *middleware.AuthMiddleware,
+	requestTimeout time.Duration,
+	oauthTimeout time.Duration,
 ) {
-	mux.HandleFunc("/api/auth/register", authHandler.Register)
-	mux.HandleFunc("/api/auth/login", authHandler.Login)
+	router.Use(middleware.RequestID)
 
-	// OAuth routes
-	mux.HandleFunc("/api/auth/google/login", func(w http.ResponseWriter, r *http.Request) {
-		oauthHandler.InitiateOAuth(w, r, "google")
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(w, http.StatusNotFound, "Not found")
 	})
-	mux.HandleFunc("/api/auth/google/callback", func(w http.ResponseWriter, r *http.Request) {
-		oauthHandler.OAuthCallback(w, r, "google")
+	router.MethodNotAllowed(methodNotAllowed(router))
+
+	router.Get("/.well-known/jwks.json", jwksHandler.GetKeys)
+
+	router.Route("/api", func(r chi.Router) {
+		// Event streams and websockets stay open for as long as the client
+		// listens, so they are the only routes without a request deadline.
+		r.Get("/stream", streamHandler.Stream)
+		r.With(authMiddleware.Middleware).Get("/jokes/{jokeID}/ws", liveHandler.Serve)
+
+		// OAuth login and callback wait on the provider, so they get their
+		// own, longer deadline. The callback is GET only: the SameSite=Lax
+		// state cookie is not sent on a cross-site form post, so it could
+		// never be validated.
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Deadline(oauthTimeout))
+
+			r.Get("/auth/{provider}/login", oauthHandler.InitiateOAuth)
+			r.Get("/auth/{provider}/callback", oauthHandler.OAuthCallback)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Deadline(requestTimeout))
+
+			r.Post("/auth/register", authHandler.Register)
+			r.Post("/auth/login", authHandler.Login)
+			r.Post("/auth/logout", authHandler.Logout)
+			r.Post("/auth/exchange", oauthHandler.ExchangeCode)
+			r.Post("/auth/2fa/verify", twoFactorHandler.Verify)
+
+			r.Get("/reactions/catalog", reactionHandler.Catalog)
+
+			// Routes below accept an optional session; an invalid token is
+			// rejected rather than treated as anonymous.
+			r.Group(func(r chi.Router) {
+				r.Use(authMiddleware.Middleware)
+
+				r.Get("/jokes", jokesHandler.List)
+				r.Post("/jokes", jokesHandler.Create)
+				r.Get("/jokes/{jokeID}", jokesHandler.GetJokeWithComments)
+				r.Delete("/jokes/{jokeID}", jokesHandler.DeleteJoke)
+				r.Get("/jokes/{jokeID}/comments", commentHandler.ListThread)
+				r.Post("/jokes/{jokeID}/comments", commentHandler.AddComment)
+
+				r.Get("/comments", commentHandler.ListComments)
+				r.Get("/comments/{commentID}", commentHandler.GetComment)
+				r.Delete("/comments/{commentID}", commentHandler.DeleteComment)
+				r.Get("/comments/{commentID}/replies", commentHandler.GetReplies)
+
+				// Older toggle endpoints, kept for existing clients.
+				r.Post("/votes", entityHandler.Vote)
+				r.Post("/reactions", entityHandler.HandleReaction)
+				r.Post("/jokes/vote", entityHandler.Vote)
+				r.Post("/jokes/react", entityHandler.HandleReaction)
+
+				r.Get("/users/{userID}", userHandler.GetProfile)
+
+				r.Group(func(r chi.Router) {
+					r.Use(authMiddleware.RequireAuth)
+
+					r.Get("/auth/session", authHandler.Session)
+					r.Post("/auth/2fa/enroll", twoFactorHandler.Enroll)
+					r.Post("/auth/2fa/confirm", twoFactorHandler.Confirm)
+					r.Post("/auth/2fa/disable", twoFactorHandler.Disable)
+					r.Post("/auth/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+
+					r.Put("/votes/{entityType}/{entityID}", entityHandler.SetVote)
+					r.Delete("/votes/{entityType}/{entityID}", entityHandler.ClearVote)
+					r.Put("/reactions/{entityType}/{entityID}/{reactionType}", entityHandler.AddReaction)
+					r.Delete("/reactions/{entityType}/{entityID}/{reactionType}", entityHandler.RemoveReaction)
+
+					r.Post("/jokes/{jokeID}/bookmark", bookmarkHandler.Bookmark)
+					r.Delete("/jokes/{jokeID}/bookmark", bookmarkHandler.Unbookmark)
+					r.Get("/me/bookmarks", bookmarkHandler.List)
+					r.Get("/me/bookmarks/collections", bookmarkHandler.Collections)
+
+					r.Get("/feed", userHandler.Feed)
+					r.Post("/users/{userID}/follow", userHandler.Follow)
+					r.Delete("/users/{userID}/follow", userHandler.Unfollow)
+
+					r.Get("/notifications", notificationHandler.List)
+					r.Post("/notifications/read", notificationHandler.MarkRead)
+					r.Get("/notifications/preferences", notificationHandler.GetPreferences)
+					r.Put("/notifications/preferences", notificationHandler.UpdatePreferences)
+
+					r.Get("/mentions", mentionHandler.List)
+				})
+			})
+
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(authMiddleware.Middleware, authMiddleware.RequireAdmin)
+
+				r.Get("/users", adminHandler.GetUsers)
+				r.Post("/users/set-status", adminHandler.SetUserAdminStatus)
+				r.Delete("/jokes/{jokeID}", adminHandler.DeleteJoke)
+				r.Delete("/comments/{commentID}", adminHandler.DeleteComment)
+				r.Get("/logs", adminHandler.GetModLogs)
+				r.Get("/stats", adminHandler.GetUserStats)
+
+				r.Get("/reactions", reactionHandler.Catalog)
+				r.Post("/reactions", reactionHandler.Create)
+				r.Put("/reactions/{reactionKey}", reactionHandler.Update)
+				r.Delete("/reactions/{reactionKey}", reactionHandler.Retire)
+			})
+		})
 	})
-	mux.HandleFunc("/api/auth/github/login", func(w http.ResponseWriter, r *http.Request) {
-		oauthHandler.InitiateOAuth(w, r, "github")
-	})
-	mux.HandleFunc("/api/auth/github/callback", func(w http.ResponseWriter, r *http.Request) {
-		oauthHandler.OAuthCallback(w, r, "github")
-	})
-
-	mux.Handle("/api/jokes", authMiddleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			jokesHandler.List(w, r)
-		case http.MethodPost:
-			jokesHandler.Create(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})))
-
-	mux.Handle("/api/votes", authMiddleware.Middleware(http.HandlerFunc(entityHandler.Vote)))
-	mux.Handle("/api/reactions", authMiddleware.Middleware(http.HandlerFunc(entityHandler.HandleReaction)))
-
-	mux.Handle("/api/jokes/react", authMiddleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			entityHandler.HandleReaction(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})))
-
-	mux.Handle("/api/jokes/vote", authMiddleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			entityHandler.Vote(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})))
-
-	mux.Handle("/api/jokes/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		pathSegments := strings.Split(strings.TrimPrefix(path, "/api/jokes/"), "/")
-
-		if len(pathSegments) == 0 || pathSegments[0] == "" {
-			http.Error(w, "Not found", http.StatusNotFound)
-			return
-		}
-
-		jokeID := pathSegments[0]
-
-		if len(pathSegments) == 1 {
-			r = r.WithContext(context.WithValue(r.Context(), "jokeId", jokeID))
-
-			switch r.Method {
-			case http.MethodGet:
-				authMiddleware.Middleware(http.HandlerFunc(jokesHandler.GetJokeWithComments)).ServeHTTP(w, r)
-			case http.MethodDelete:
-				authMiddleware.Middleware(http.HandlerFunc(jokesHandler.DeleteJoke)).ServeHTTP(w, r)
-			default:
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			}
-			return
-		}
+}
 
-		if len(pathSegments) == 2 && pathSegments[1] == "comments" {
-			r = r.WithContext(context.WithValue(r.Context(), "jokeId", jokeID))
+// methodNotAllowed answers a request whose path matches a route registered
+// for other methods, listing those methods in the Allow header.
+func methodNotAllowed(routes chi.Routes) http.HandlerFunc {
+	methods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
 
-			switch r.Method {
-			case http.MethodPost:
-				authMiddleware.Middleware(http.HandlerFunc(commentHandler.AddComment)).ServeHTTP(w, r)
-			default:
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	return func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range methods {
+			if routes.Match(chi.NewRouteContext(), method, r.URL.Path) {
+				allowed = append(allowed, method)
 			}
-			return
-		}
-
-		http.Error(w, "Not found", http.StatusNotFound)
-	}))
-
-	mux.Handle("/api/comments", authMiddleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			commentHandler.ListComments(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})))
-
-	mux.Handle("/api/comments/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		pathSegments := strings.Split(strings.TrimPrefix(path, "/api/comments/"), "/")
-
-		if len(pathSegments) != 1 || pathSegments[0] == "" {
-			http.Error(w, "Not found", http.StatusNotFound)
-			return
-		}
-
-		commentID := pathSegments[0]
-		r = r.WithContext(context.WithValue(r.Context(), "commentId", commentID))
-
-		switch r.Method {
-		case http.MethodDelete:
-			authMiddleware.Middleware(http.HandlerFunc(commentHandler.DeleteComment)).ServeHTTP(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	}))
 
-	mux.Handle("/api/admin/users", authMiddleware.Middleware(
-		authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.GetUsers)),
-	))
-
-	mux.Handle("/api/admin/jokes/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		pathSegments := strings.Split(strings.TrimPrefix(path, "/api/admin/jokes/"), "/")
-
-		if len(pathSegments) != 1 || pathSegments[0] == "" {
-			http.Error(w, "Not found", http.StatusNotFound)
-			return
-		}
-
-		jokeID := pathSegments[0]
-		r = r.WithContext(context.WithValue(r.Context(), "jokeId", jokeID))
-
-		switch r.Method {
-		case http.MethodDelete:
-			authMiddleware.Middleware(
-				authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.DeleteJoke)),
-			).ServeHTTP(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	}))
-
-	mux.Handle("/api/admin/comments/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		pathSegments := strings.Split(strings.TrimPrefix(path, "/api/admin/comments/"), "/")
-
-		if len(pathSegments) != 1 || pathSegments[0] == "" {
-			http.Error(w, "Not found", http.StatusNotFound)
-			return
-		}
-
-		commentID := pathSegments[0]
-		r = r.WithContext(context.WithValue(r.Context(), "commentId", commentID))
-
-		switch r.Method {
-		case http.MethodDelete:
-			authMiddleware.Middleware(
-				authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.DeleteComment)),
-			).ServeHTTP(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	}))
-
-	mux.Handle("/api/admin/users/set-status", authMiddleware.Middleware(
-		authMiddleware.RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Method == http.MethodPost {
-				adminHandler.SetUserAdminStatus(w, r)
-			} else {
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			}
-		})),
-	))
-
-	mux.Handle("/api/admin/logs", authMiddleware.Middleware(
-		authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.GetModLogs)),
-	))
-	mux.Handle("/api/admin/stats", authMiddleware.Middleware(
-		authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.GetUserStats)),
-	))
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		apierror.Write(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
+// corsMiddleware sets the CORS headers and answers preflight requests. With
+// cookie sessions, browsers only send credentials to an origin echoed back
+// alongside Access-Control-Allow-Credentials, so only allowedOrigins are
+// echoed; bearer-only deployments keep allowing any origin.
+func corsMiddleware(next http.Handler, sessions *session.Manager, allowedOrigins []string) http.Handler {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[origin] = true
+	}
+	csrfHeader := sessions.CSRFHeaderName()
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		if sessions.CookiesEnabled() {
+			w.Header().Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); allowed[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+apierror.RequestIDHeader+", "+csrfHeader)
+		w.Header().Set("Access-Control-Expose-Headers", apierror.RequestIDHeader)
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -270,13 +371,17 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// setupLogger builds the logger for env. Records logged with a request
+// context also carry that request's fields, such as its ID.
 func setupLogger(env string) *slog.Logger {
+	var handler slog.Handler
 	switch env {
 	case "local":
-		return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
 	case "prod":
-		return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})
 	default:
-		return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
 	}
+	return slog.New(sl.NewContextHandler(handler))
 }
@@ -0,0 +1,14 @@
+-- Migration: create_oauth_login_codes
+
+-- One-time codes handed to the frontend after an OAuth callback and exchanged
+-- for a token via POST, so the token itself never appears in a URL
+CREATE TABLE IF NOT EXISTS oauth_login_codes (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    two_factor_pending BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_oauth_login_codes_expires_at ON oauth_login_codes(expires_at);
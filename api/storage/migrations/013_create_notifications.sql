@@ -0,0 +1,34 @@
+-- Migration: create_notifications
+
+-- Events on the same target are folded into one unread row per recipient:
+-- event_count grows and last_actor_id moves instead of inserting new rows.
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    type TEXT NOT NULL CHECK(type IN ('reply', 'comment', 'vote', 'reaction')),
+    entity_type TEXT NOT NULL CHECK(entity_type IN ('joke', 'comment')),
+    entity_id INTEGER NOT NULL,
+    joke_id INTEGER NOT NULL,
+    last_actor_id INTEGER NULL,
+    event_count INTEGER NOT NULL DEFAULT 1,
+    read_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (last_actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX idx_notifications_unread_target
+    ON notifications(user_id, type, entity_type, entity_id)
+    WHERE read_at IS NULL;
+
+CREATE INDEX idx_notifications_user_updated ON notifications(user_id, updated_at DESC);
+
+-- Missing rows mean the event type is enabled
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL,
+    type TEXT NOT NULL CHECK(type IN ('reply', 'comment', 'vote', 'reaction')),
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, type),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+ALTER TABLE jokes ADD COLUMN IF NOT EXISTS points DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE jokes ADD COLUMN IF NOT EXISTS hot_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE jokes ADD COLUMN IF NOT EXISTS rising_score DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+UPDATE jokes j SET points =
+    COALESCE((SELECT SUM(CASE WHEN vote_type = 'plus' THEN 1 WHEN vote_type = 'minus' THEN -1 ELSE 0 END)
+              FROM votes WHERE entity_type = 'joke' AND entity_id = j.id), 0)
+    + 0.5 * (SELECT COUNT(*) FROM interactions WHERE entity_type = 'joke' AND entity_id = j.id)
+    + (SELECT COUNT(*) FROM comments WHERE joke_id = j.id AND is_deleted = FALSE);
+
+UPDATE jokes SET
+    hot_score = SIGN(points) * LOG(GREATEST(ABS(points), 1)) + (EXTRACT(EPOCH FROM created_at) - 1134028003) / 45000,
+    rising_score = SIGN(points) * LOG(GREATEST(ABS(points), 1)) + (EXTRACT(EPOCH FROM created_at) - 1134028003) / 3600;
+
+CREATE INDEX IF NOT EXISTS idx_jokes_hot_score ON jokes(hot_score DESC);
+CREATE INDEX IF NOT EXISTS idx_jokes_rising_score ON jokes(created_at, rising_score);
+CREATE INDEX IF NOT EXISTS idx_jokes_created_at_points ON jokes(created_at, points);
@@ -0,0 +1,38 @@
+ALTER TABLE jokes ADD COLUMN IF NOT EXISTS score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE jokes ADD COLUMN IF NOT EXISTS pluses INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE jokes ADD COLUMN IF NOT EXISTS minuses INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE jokes ADD COLUMN IF NOT EXISTS comment_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE jokes ADD COLUMN IF NOT EXISTS reaction_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE jokes ADD COLUMN IF NOT EXISTS reaction_counts JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS pluses INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS minuses INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS reaction_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS reaction_counts JSONB NOT NULL DEFAULT '{}';
+
+UPDATE jokes j SET
+    pluses = (SELECT COUNT(*) FROM votes WHERE entity_type = 'joke' AND entity_id = j.id AND vote_type = 'plus'),
+    minuses = (SELECT COUNT(*) FROM votes WHERE entity_type = 'joke' AND entity_id = j.id AND vote_type = 'minus'),
+    comment_count = (SELECT COUNT(*) FROM comments WHERE joke_id = j.id AND is_deleted = FALSE),
+    reaction_count = (SELECT COUNT(*) FROM interactions WHERE entity_type = 'joke' AND entity_id = j.id),
+    reaction_counts = COALESCE((
+        SELECT jsonb_object_agg(type, n)
+        FROM (SELECT type, COUNT(*) AS n FROM interactions WHERE entity_type = 'joke' AND entity_id = j.id GROUP BY type) rc
+    ), '{}');
+
+UPDATE comments c SET
+    pluses = (SELECT COUNT(*) FROM votes WHERE entity_type = 'comment' AND entity_id = c.id AND vote_type = 'plus'),
+    minuses = (SELECT COUNT(*) FROM votes WHERE entity_type = 'comment' AND entity_id = c.id AND vote_type = 'minus'),
+    reaction_count = (SELECT COUNT(*) FROM interactions WHERE entity_type = 'comment' AND entity_id = c.id),
+    reaction_counts = COALESCE((
+        SELECT jsonb_object_agg(type, n)
+        FROM (SELECT type, COUNT(*) AS n FROM interactions WHERE entity_type = 'comment' AND entity_id = c.id GROUP BY type) rc
+    ), '{}');
+
+UPDATE jokes SET score = pluses - minuses;
+UPDATE comments SET score = pluses - minuses;
+
+CREATE INDEX IF NOT EXISTS idx_jokes_score ON jokes(score);
+CREATE INDEX IF NOT EXISTS idx_jokes_comment_count ON jokes(comment_count);
+CREATE INDEX IF NOT EXISTS idx_jokes_reaction_count ON jokes(reaction_count);
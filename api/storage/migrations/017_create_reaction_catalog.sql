@@ -0,0 +1,26 @@
+-- Migration: create_reaction_catalog
+
+-- Retired reactions stay in the catalog with enabled = FALSE so existing
+-- counts can still be rendered, but they can no longer be added.
+CREATE TABLE IF NOT EXISTS reaction_catalog (
+    key TEXT PRIMARY KEY CHECK(key ~ '^[a-z0-9_]{1,32}$'),
+    emoji TEXT NOT NULL,
+    label TEXT NOT NULL,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO reaction_catalog (key, emoji, label, sort_order) VALUES
+    ('laugh', '😂', 'Laugh', 10),
+    ('heart', '❤️', 'Love', 20),
+    ('neutral', '😐', 'Neutral', 30),
+    ('surprised', '😲', 'Surprised', 40),
+    ('fire', '🔥', 'Fire', 50),
+    ('poop', '💩', 'Poop', 60),
+    ('angry', '😡', 'Angry', 70),
+    ('monkey', '🙈', 'Monkey', 80),
+    ('thumbs_up', '👍', 'Thumbs up', 90),
+    ('thumbs_down', '👎', 'Thumbs down', 100)
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,20 @@
+-- Migration: cleanup_orphaned_social
+
+-- Votes, reactions and notifications reference jokes and comments without a
+-- foreign key, so rows for deleted jokes and soft-deleted comments used to
+-- linger. New deletions clean up after themselves; this clears the backlog.
+DELETE FROM votes v
+WHERE (v.entity_type = 'joke' AND NOT EXISTS (SELECT 1 FROM jokes WHERE id = v.entity_id))
+   OR (v.entity_type = 'comment' AND NOT EXISTS (SELECT 1 FROM comments WHERE id = v.entity_id AND is_deleted = FALSE));
+
+DELETE FROM interactions i
+WHERE (i.entity_type = 'joke' AND NOT EXISTS (SELECT 1 FROM jokes WHERE id = i.entity_id))
+   OR (i.entity_type = 'comment' AND NOT EXISTS (SELECT 1 FROM comments WHERE id = i.entity_id AND is_deleted = FALSE));
+
+DELETE FROM notifications n
+WHERE NOT EXISTS (SELECT 1 FROM jokes WHERE id = n.joke_id)
+   OR (n.entity_type = 'comment' AND NOT EXISTS (SELECT 1 FROM comments WHERE id = n.entity_id AND is_deleted = FALSE));
+
+UPDATE comments
+SET pluses = 0, minuses = 0, score = 0, reaction_count = 0, reaction_counts = '{}'
+WHERE is_deleted = TRUE;
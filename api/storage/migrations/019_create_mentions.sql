@@ -0,0 +1,22 @@
+-- Migration: create_mentions
+
+-- One row per user mentioned in a joke or comment, for "mentions of me".
+CREATE TABLE IF NOT EXISTS mentions (
+    id SERIAL PRIMARY KEY,
+    entity_type TEXT NOT NULL CHECK(entity_type IN ('joke', 'comment')),
+    entity_id INTEGER NOT NULL,
+    joke_id INTEGER NOT NULL,
+    mentioned_user_id INTEGER NOT NULL,
+    author_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (joke_id) REFERENCES jokes(id) ON DELETE CASCADE,
+    FOREIGN KEY (mentioned_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE (entity_type, entity_id, mentioned_user_id)
+);
+
+CREATE INDEX idx_mentions_user_created ON mentions(mentioned_user_id, created_at DESC);
+
+-- The resolved spans are stored with each body so reads need no extra lookup.
+ALTER TABLE jokes ADD COLUMN IF NOT EXISTS mentions JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS mentions JSONB NOT NULL DEFAULT '[]';
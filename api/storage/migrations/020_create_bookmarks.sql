@@ -0,0 +1,14 @@
+-- Migration: create_bookmarks
+
+-- Private bookmarks; an empty collection means the bookmark is unfiled.
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id INTEGER NOT NULL,
+    joke_id INTEGER NOT NULL,
+    collection VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, joke_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (joke_id) REFERENCES jokes(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_bookmarks_user_collection ON bookmarks(user_id, collection);
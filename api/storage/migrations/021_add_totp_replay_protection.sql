@@ -0,0 +1,9 @@
+-- Migration: add_totp_replay_protection
+
+-- totp_last_step is the newest time step a code was accepted for; codes at or
+-- below it are replays. Failed attempts lock the second factor until
+-- totp_locked_until once they reach the configured limit.
+ALTER TABLE users
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN totp_failed_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN totp_locked_until TIMESTAMP NULL;
@@ -26,6 +26,7 @@ const App = () => (
                     <Route path="/auth/callback" element={<OAuthCallback />} />
                     <Route path="/create" element={<CreateJoke />} />
                     <Route path="/joke/:jokeId" element={<JokeDetail />} />
+                    <Route path="/joke/:jokeId/comment/:commentId" element={<JokeDetail />} />
                     <Route path="/admin" element={<AdminPanel />} />
                     <Route path="/admin/users" element={<AdminUsers />} />
                     <Route path="/admin/logs" element={<AdminModerationLogs />} />
@@ -1,4 +1,9 @@
-import { api } from '../utils/api';
+import { api, setCSRFToken, usesCookieSession } from '../utils/api';
+
+// Cookie sessions keep only the public profile in the browser; the token
+// itself never becomes readable from JavaScript.
+const SESSION_USER_KEY = "user";
+
 export const registerUser = async (username, email, password) => {
   const response = await api.post(`/auth/register`, { username, email, password });
   return response.data;
@@ -9,7 +14,36 @@ export const loginUser = async (email, password) => {
   return response.data;
 };
 
+// saveSession stores what a login, registration or OAuth exchange returned
+// and yields the signed-in user.
+export const saveSession = (data) => {
+  if (usesCookieSession) {
+    if (!data || !data.user) return null;
+    setCSRFToken(data.csrf_token);
+    sessionStorage.setItem(SESSION_USER_KEY, JSON.stringify({
+      userId: data.user.id,
+      username: data.user.username,
+      isAdmin: data.user.is_admin,
+    }));
+    return getCurrentUser();
+  }
+
+  if (!data || !data.token) return null;
+  localStorage.setItem("token", data.token);
+  return getCurrentUser();
+};
+
 export const getCurrentUser = () => {
+  if (usesCookieSession) {
+    try {
+      const stored = sessionStorage.getItem(SESSION_USER_KEY);
+      return stored ? JSON.parse(stored) : null;
+    } catch (error) {
+      sessionStorage.removeItem(SESSION_USER_KEY);
+      return null;
+    }
+  }
+
   try {
     const token = localStorage.getItem("token");
     if (!token) return null;
@@ -28,17 +62,44 @@ export const getCurrentUser = () => {
   }
 };
 
-export const logoutUser = () => {
-  localStorage.removeItem("token");
+// restoreSession asks the API who is signed in, since a cookie session cannot
+// be inspected from JavaScript. Bearer sessions are read from storage.
+export const restoreSession = async () => {
+  if (!usesCookieSession) return getCurrentUser();
+
+  try {
+    const response = await api.get(`/auth/session`);
+    return saveSession(response.data);
+  } catch (error) {
+    sessionStorage.removeItem(SESSION_USER_KEY);
+    setCSRFToken(null);
+    return null;
+  }
+};
+
+export const logoutUser = async () => {
+  if (!usesCookieSession) {
+    localStorage.removeItem("token");
+    return;
+  }
+
+  try {
+    await api.post(`/auth/logout`);
+  } finally {
+    sessionStorage.removeItem(SESSION_USER_KEY);
+    setCSRFToken(null);
+  }
 };
 
 export const handleOAuthCallback = async () => {
   const urlParams = new URLSearchParams(window.location.search);
-  const token = urlParams.get('token');
+  const code = urlParams.get('code');
+  const returnTo = urlParams.get('return_to') || '/';
 
-  if (token) {
-    localStorage.setItem('token', token);
-    return getCurrentUser();
-  }
-  return null;
-};
\ No newline at end of file
+  window.history.replaceState(null, '', window.location.pathname);
+
+  if (!code) return { user: null, returnTo };
+
+  const response = await api.post(`/auth/exchange`, { code });
+  return { user: saveSession(response.data), returnTo };
+};
@@ -5,6 +5,21 @@ export const fetchComments = async (jokeId) => {
   return response.data;
 };
 
+export const fetchCommentPage = async (jokeId, cursor) => {
+  const response = await api.get(`/jokes/${jokeId}/comments`, { params: { cursor } });
+  return response.data;
+};
+
+export const fetchCommentThread = async (commentId) => {
+  const response = await api.get(`/comments/${commentId}`);
+  return response.data;
+};
+
+export const fetchReplies = async (commentId, cursor) => {
+  const response = await api.get(`/comments/${commentId}/replies`, { params: { cursor } });
+  return response.data;
+};
+
 export const addComment = async (jokeId, body, parentId = null) => {
   try {
     const response = await api.post(`/api/jokes/${jokeId}/comments`, {
@@ -8,19 +8,47 @@ export const fetchJokes = async ({ pageParam = 1, pageSize = 10, sortField = "cr
 };
 
 export const voteEntity = async (entityType, entityId, voteType) => {
-  return await api.post(`/jokes/vote`, {
-    entity_type: entityType,
-    entity_id: entityId,
-    vote_type: voteType,
-  });
+  const url = `/votes/${entityType}/${entityId}`;
+  const response = voteType
+    ? await api.put(url, { vote_type: voteType })
+    : await api.delete(url);
+  return response.data;
 };
 
-export const reactToEntity = async (entityType, entityId, reactionType) => {
-  return await api.post(`/jokes/react`, {
-    entity_type: entityType,
-    entity_id: entityId,
-    reaction_type: reactionType,
+export const setReaction = async (entityType, entityId, reactionType, active) => {
+  const url = `/reactions/${entityType}/${entityId}/${reactionType}`;
+  const response = active ? await api.put(url) : await api.delete(url);
+  return response.data;
+};
+
+export const setBookmark = async (jokeId, bookmarked, collection = "") => {
+  const url = `/jokes/${jokeId}/bookmark`;
+  if (bookmarked) {
+    await api.post(url, { collection });
+  } else {
+    await api.delete(url);
+  }
+};
+
+export const fetchBookmarks = async ({ pageParam = 1, pageSize = 10, sortField = "created_at", order = "desc", collection }) => {
+  const response = await api.get("/me/bookmarks", {
+    params: { page: pageParam, page_size: pageSize, sort_field: sortField, order, collection }
   });
+  return response.data;
+};
+
+let reactionCatalogRequest = null;
+
+export const fetchReactionCatalog = () => {
+  if (!reactionCatalogRequest) {
+    reactionCatalogRequest = api.get("/reactions/catalog")
+      .then(response => response.data)
+      .catch(error => {
+        reactionCatalogRequest = null;
+        throw error;
+      });
+  }
+  return reactionCatalogRequest;
 };
 
 export const createJoke = async (body) => {
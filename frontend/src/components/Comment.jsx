@@ -1,6 +1,7 @@
-import React, { useState } from "react";
+import React, { useState, useEffect, useRef } from "react";
+import { Link } from "react-router-dom";
 import { formatDistanceToNow } from "date-fns";
-import { deleteComment } from "../api/commentsApi";
+import { deleteComment, fetchReplies } from "../api/commentsApi";
 import { getCurrentUser } from "../api/authApi";
 import VotingPanel from "./VotingPanel";
 import ReactionsList from "./ReactionsList";
@@ -8,8 +9,17 @@ import CommentForm from "./CommentForm";
 import Popup from "./Popup";
 import {deleteAsAdminComment} from "../api/adminApi.js";
 
-const Comment = ({ comment, onCommentDeleted, onReplyAdded }) => {
+const Comment = ({ comment, onCommentDeleted, onReplyAdded, onRepliesLoaded, focusedId }) => {
     const [showReplyForm, setShowReplyForm] = useState(false);
+    const [loadingReplies, setLoadingReplies] = useState(false);
+    const commentRef = useRef(null);
+    const isFocused = focusedId === comment.id;
+
+    useEffect(() => {
+        if (isFocused && commentRef.current) {
+            commentRef.current.scrollIntoView({ behavior: "smooth", block: "center" });
+        }
+    }, [isFocused]);
     const [showDeletePopup, setShowDeletePopup] = useState(false);
     const currentUser = getCurrentUser();
     const isAuthor = currentUser?.userId === comment.author_id;
@@ -46,9 +56,27 @@ const Comment = ({ comment, onCommentDeleted, onReplyAdded }) => {
         }
     };
 
+    const loadedReplies = comment.children?.length || 0;
+    const hasMoreReplies = comment.reply_count > loadedReplies;
+
+    const loadMoreReplies = async () => {
+        setLoadingReplies(true);
+        try {
+            const page = await fetchReplies(comment.id, comment.replies_cursor);
+            onRepliesLoaded(comment.id, page);
+        } catch (error) {
+            console.error("Failed to load replies:", error);
+        } finally {
+            setLoadingReplies(false);
+        }
+    };
+
     return (
         <>
-            <div className={`comment ${comment.is_deleted ? 'comment-deleted' : ''}`}>
+            <div
+                ref={commentRef}
+                className={`comment ${comment.is_deleted ? 'comment-deleted' : ''} ${isFocused ? 'comment-focused' : ''}`}
+            >
                 <div className="comment-header">
                     <span className="comment-author">{comment.author_username}</span>
                     <span className="comment-time">
@@ -84,6 +112,10 @@ const Comment = ({ comment, onCommentDeleted, onReplyAdded }) => {
                                 </button>
                             )}
 
+                            <Link className="reply-button" to={`/joke/${comment.joke_id}/comment/${comment.id}`}>
+                                Link
+                            </Link>
+
                             {(isAuthor || isAdmin) && (
                                 <button className="delete-button" onClick={handleDelete}>
                                     Delete
@@ -94,7 +126,7 @@ const Comment = ({ comment, onCommentDeleted, onReplyAdded }) => {
                         <VotingPanel
                             entityType="comment"
                             entityId={comment.id}
-                            initialScore={comment.social.pluses}
+                            initialScore={comment.social.score}
                             initialVote={comment.social?.user?.vote_type}
                         />
                     </div>
@@ -119,10 +151,18 @@ const Comment = ({ comment, onCommentDeleted, onReplyAdded }) => {
                                 comment={childComment}
                                 onCommentDeleted={onCommentDeleted}
                                 onReplyAdded={onReplyAdded}
+                                onRepliesLoaded={onRepliesLoaded}
+                                focusedId={focusedId}
                             />
                         ))}
                     </div>
                 )}
+
+                {hasMoreReplies && (
+                    <button className="load-more-comments" onClick={loadMoreReplies} disabled={loadingReplies}>
+                        {loadingReplies ? "Loading..." : `Load more replies (${comment.reply_count - loadedReplies})`}
+                    </button>
+                )}
             </div>
             
             <Popup
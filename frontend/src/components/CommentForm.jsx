@@ -47,6 +47,7 @@ const CommentForm = ({ jokeId, parentId = null, onCommentAdded, isReply = false
                 social: {
                     pluses: 0,
                     minuses: 0,
+                    score: 0,
                     reactions: [],
                     user: { reactions: [], vote_type: null }
                 },
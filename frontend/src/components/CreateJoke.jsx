@@ -82,6 +82,7 @@ const CreateJoke = () => {
     social: {
       pluses: 0,
       minuses: 0,
+      score: 0,
       reactions: [],
       user: { reactions: [], vote_type: null }
     }
@@ -10,8 +10,8 @@ const Header = () => {
         return username ? username.charAt(0).toUpperCase() : '?';
     };
 
-    const handleLogout = () => {
-        logoutUser();
+    const handleLogout = async () => {
+        await logoutUser();
         navigate("/auth");
     };
 
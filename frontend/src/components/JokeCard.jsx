@@ -1,5 +1,5 @@
 import React, { useState } from "react";
-import { deleteJoke } from "../api/jokesApi";
+import { deleteJoke, setBookmark } from "../api/jokesApi";
 import { deleteAsAdminJoke } from "../api/adminApi";
 import { getCurrentUser } from "../api/authApi";
 import ReactionsList from "./ReactionsList";
@@ -13,6 +13,7 @@ const JokeCard = ({ joke, onDelete }) => {
     const isAuthor = currentUser?.userId === joke.author_id;
     const isAdmin = currentUser?.isAdmin;
     const [showDeletePopup, setShowDeletePopup] = useState(false);
+    const [bookmarked, setBookmarked] = useState(!!joke.social?.user?.bookmarked);
     
     const getInitials = (username) => {
         return username ? username.charAt(0).toUpperCase() : '?';
@@ -22,6 +23,17 @@ const JokeCard = ({ joke, onDelete }) => {
         setShowDeletePopup(true);
     };
 
+    const toggleBookmark = async () => {
+        const next = !bookmarked;
+        setBookmarked(next);
+        try {
+            await setBookmark(joke.id, next);
+        } catch (error) {
+            console.error("Error updating bookmark:", error);
+            setBookmarked(!next);
+        }
+    };
+
     const confirmDelete = async () => {
         if (isAdmin){
             await deleteAsAdminJoke(joke.id);
@@ -48,6 +60,15 @@ const JokeCard = ({ joke, onDelete }) => {
                         <span className="comment-time">
                             {joke.created_at && formatDistanceToNow(new Date(joke.created_at))} ago
                         </span>
+                        {currentUser && (
+                            <button
+                                className={`bookmark-button ${bookmarked ? "active" : ""}`}
+                                onClick={toggleBookmark}
+                                title={bookmarked ? "Remove bookmark" : "Bookmark"}
+                            >
+                                {bookmarked ? "★" : "☆"}
+                            </button>
+                        )}
                         {(isAuthor || isAdmin) && (
                             <button className="delete-button" onClick={handleDelete}>
                                 <svg width="18" height="18" viewBox="0 0 24 24">
@@ -81,7 +102,7 @@ const JokeCard = ({ joke, onDelete }) => {
                     <VotingPanel
                         entityType="joke"
                         entityId={joke.id}
-                        initialScore={joke.social.pluses - joke.social.minuses}
+                        initialScore={joke.social.score}
                         initialVote={joke.social?.user?.vote_type}
                     />
                 </div>
@@ -6,8 +6,8 @@ import { api } from '../utils/api';
 const OAuthButtons = () => {
     const handleOAuthLogin = (provider) => {
         const baseUrl = api.defaults.baseURL;
-        const redirectUri = `${window.location.origin}/auth/callback`;
-        window.location.href = `${baseUrl}/auth/${provider}/login?redirect_uri=${encodeURIComponent(redirectUri)}`;
+        const returnTo = window.location.pathname === '/auth' ? '/' : window.location.pathname;
+        window.location.href = `${baseUrl}/auth/${provider}/login?return_to=${encodeURIComponent(returnTo)}`;
     };
 
     return (
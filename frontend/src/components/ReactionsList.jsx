@@ -1,15 +1,15 @@
 import React, { useState, useRef, useEffect } from "react";
 import { useNavigate } from "react-router-dom";
-import { reactToEntity } from "../api/jokesApi";
+import { setReaction, fetchReactionCatalog } from "../api/jokesApi";
 import Popup from "./Popup";
 
 
-const reactionMap = {
+const defaultReactionMap = {
   laugh: "😂", heart: "❤️", neutral: "😐", surprised: "😲", fire: "🔥",
   poop: "💩", angry: "😡", monkey: "🙈", thumbs_up: "👍", thumbs_down: "👎",
 };
 
-const availableReactions = Object.keys(reactionMap);
+const defaultAvailableReactions = Object.keys(defaultReactionMap);
 
 const ReactionsList = ({ entityId, initialReactions, initialUserReactions, isLoggedIn, entityType }) => {
   const [reactions, setReactions] = useState({ ...initialReactions });
@@ -21,6 +21,17 @@ const ReactionsList = ({ entityId, initialReactions, initialUserReactions, isLog
   const popupRef = useRef(null);
   const addButtonRef = useRef(null);
   const reactionsRef = useRef({});
+  const [reactionMap, setReactionMap] = useState(defaultReactionMap);
+  const [availableReactions, setAvailableReactions] = useState(defaultAvailableReactions);
+
+  useEffect(() => {
+    fetchReactionCatalog()
+      .then(catalog => {
+        setReactionMap(Object.fromEntries(catalog.map(reaction => [reaction.key, reaction.emoji])));
+        setAvailableReactions(catalog.filter(reaction => reaction.enabled).map(reaction => reaction.key));
+      })
+      .catch(() => {});
+  }, []);
 
   useEffect(() => {
     setReactions({ ...initialReactions });
@@ -75,7 +86,14 @@ const ReactionsList = ({ entityId, initialReactions, initialUserReactions, isLog
       return updatedReactions;
     });
 
-    await reactToEntity(entityType, entityId, reaction);
+    try {
+      const social = await setReaction(entityType, entityId, reaction, isAddingReaction);
+      setReactions({ ...social.reactions });
+      setUserReactions(new Set(social.user?.reactions || []));
+    } catch {
+      setReactions({ ...reactions });
+      setUserReactions(new Set(userReactions));
+    }
     setShowReactionPopup(false);
   };
 
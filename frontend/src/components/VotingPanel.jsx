@@ -53,7 +53,14 @@ const VotingPanel = ({ entityType, entityId, initialScore, initialVote }) => {
     setHasVoted(newVote);
     setScore(newScore);
 
-    await voteEntity(entityType, entityId, newVote);
+    try {
+      const social = await voteEntity(entityType, entityId, newVote);
+      setScore(social.score);
+      setHasVoted(social.user?.vote_type || null);
+    } catch {
+      setScore(currentScore);
+      setHasVoted(currentVote);
+    }
   };
 
   const handleAuthConfirm = () => {
@@ -1,5 +1,5 @@
 import React, { createContext, useContext, useState, useEffect } from 'react';
-import { getCurrentUser, loginUser, logoutUser } from '../api/authApi';
+import { loginUser, logoutUser, restoreSession, saveSession } from '../api/authApi';
 
 const AuthContext = createContext(null);
 
@@ -8,32 +8,26 @@ export function AuthProvider({ children }) {
     const [isLoading, setIsLoading] = useState(true);
 
     useEffect(() => {
-        const currentUser = getCurrentUser();
-        if (currentUser) {
-            setUser(currentUser);
-        }
-        setIsLoading(false);
+        restoreSession()
+            .then((currentUser) => setUser(currentUser))
+            .finally(() => setIsLoading(false));
     }, []);
 
     const login = async (email, password) => {
-        try {
-            const response = await loginUser(email, password);
-            localStorage.setItem('token', response.token);
-            const user = getCurrentUser();
-            setUser(user);
-            return user;
-        } catch (error) {
-            throw error;
-        }
+        const response = await loginUser(email, password);
+        const user = saveSession(response);
+        setUser(user);
+        return user;
     };
 
-    const logout = () => {
-        logoutUser();
+    const logout = async () => {
+        await logoutUser();
         setUser(null);
     };
 
     const value = {
         user,
+        setUser,
         login,
         logout,
         isLoading
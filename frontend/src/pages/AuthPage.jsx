@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from "react";
 import { useNavigate } from "react-router-dom";
-import { loginUser, registerUser } from "../api/authApi";
+import { loginUser, registerUser, saveSession } from "../api/authApi";
 import OAuthButtons from "../components/OAuthButtons.jsx";
 
 const AuthPage = () => {
@@ -104,8 +104,7 @@ const AuthPage = () => {
     setIsLoading(true);
 
     try {
-      const { token } = await loginUser(formData.login.email, formData.login.password);
-      localStorage.setItem("token", token);
+      saveSession(await loginUser(formData.login.email, formData.login.password));
       navigate("/");
     } catch (err) {
       setError("Invalid email or password");
@@ -125,17 +124,16 @@ const AuthPage = () => {
     setIsLoading(true);
 
     try {
-      const { token } = await registerUser(
+      saveSession(await registerUser(
           formData.register.username,
           formData.register.email,
           formData.register.password
-      );
-      localStorage.setItem("token", token);
+      ));
       navigate("/");
     } catch (err) {
       // Try to parse error message from response if available
       if (err.response && err.response.data && err.response.data.error) {
-        setError(err.response.data.error);
+        setError(err.response.data.error.message);
       } else {
         setError("Registration failed. Please try again.");
       }
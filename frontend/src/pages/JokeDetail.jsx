@@ -1,15 +1,62 @@
 import React, { useState, useEffect } from "react";
 import { useParams, Link } from "react-router-dom";
 import { fetchJokeWithComments } from "../api/jokesApi";
+import { fetchCommentPage, fetchCommentThread } from "../api/commentsApi";
 import JokeCard from "../components/JokeCard";
 import CommentList from "../components/CommentList";
 import CommentForm from "../components/CommentForm";
 import { getCurrentUser } from "../api/authApi";
 
+const insertReply = (comments, reply) => comments.map(comment => {
+    if (comment.id === reply.parent_id) {
+        const child = { ...reply, depth: comment.depth + 1, reply_count: 0, children: [] };
+        return {
+            ...comment,
+            reply_count: (comment.reply_count || 0) + 1,
+            children: [...(comment.children || []), child]
+        };
+    }
+    return { ...comment, children: insertReply(comment.children || [], reply) };
+});
+
+const markDeleted = (comments, commentId) => comments.map(comment => {
+    if (comment.id === commentId) {
+        return { ...comment, is_deleted: true };
+    }
+    return { ...comment, children: markDeleted(comment.children || [], commentId) };
+});
+
+// appendReplies merges a page of replies into the parent's children, skipping
+// ones already shown, and remembers where the next page starts.
+const appendReplies = (comments, parentId, page) => comments.map(comment => {
+    if (comment.id === parentId) {
+        const children = comment.children || [];
+        const known = new Set(children.map(child => child.id));
+        const merged = [...children, ...page.comments.filter(reply => !known.has(reply.id))];
+        return {
+            ...comment,
+            children: merged,
+            replies_cursor: page.next_cursor,
+            reply_count: page.next_cursor ? comment.reply_count : merged.length
+        };
+    }
+    return { ...comment, children: appendReplies(comment.children || [], parentId, page) };
+});
+
+// nestThread wraps the permalinked comment in its ancestors so the chain
+// renders as a single branch of the tree.
+const nestThread = (thread) => {
+    const focused = { ...thread.comment, replies_cursor: thread.next_cursor };
+    return [thread.ancestors.reduceRight((child, ancestor) => ({ ...ancestor, children: [child] }), focused)];
+};
+
 const JokeDetail = () => {
-    const { jokeId } = useParams();
+    const { jokeId, commentId } = useParams();
+    const focusedId = commentId ? Number(commentId) : null;
     const [joke, setJoke] = useState(null);
     const [comments, setComments] = useState([]); 
+    const [nextCursor, setNextCursor] = useState(null);
+    const [loadingMore, setLoadingMore] = useState(false);
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState(null);
     const currentUser = getCurrentUser();
@@ -20,7 +67,14 @@ const JokeDetail = () => {
                 setLoading(true);
                 const data = await fetchJokeWithComments(jokeId);
                 setJoke(data.joke);
-                setComments(Array.isArray(data.comments) ? data.comments : []);
+                if (focusedId) {
+                    const thread = await fetchCommentThread(focusedId);
+                    setComments(nestThread(thread));
+                    setNextCursor(null);
+                } else {
+                    setComments(Array.isArray(data.comments) ? data.comments : []);
+                    setNextCursor(data.next_cursor || null);
+                }
                 setError(null);
             } catch (err) {
                 setError("Failed to load joke and comments");
@@ -31,12 +85,15 @@ const JokeDetail = () => {
         };
 
         loadJokeWithComments();
-    }, [jokeId]);
+    }, [jokeId, focusedId]);
 
     const handleCommentAdded = (newComment) => {
         setComments(prevComments => {
             const commentsArray = Array.isArray(prevComments) ? prevComments : [];
-            return [...commentsArray, newComment];
+            if (!newComment.parent_id) {
+                return [...commentsArray, { ...newComment, depth: 0, reply_count: 0, children: [] }];
+            }
+            return insertReply(commentsArray, newComment);
         });
 
         if (!newComment.parent_id && joke) {
@@ -47,16 +104,30 @@ const JokeDetail = () => {
         }
     };
 
+    const handleLoadMore = async () => {
+        setLoadingMore(true);
+        try {
+            const page = await fetchCommentPage(jokeId, nextCursor);
+            setComments(prevComments => {
+                const known = new Set(prevComments.map(comment => comment.id));
+                return [...prevComments, ...page.comments.filter(comment => !known.has(comment.id))];
+            });
+            setNextCursor(page.next_cursor || null);
+        } catch (err) {
+            console.error("Failed to load more comments:", err);
+        } finally {
+            setLoadingMore(false);
+        }
+    };
+
+    const handleRepliesLoaded = (parentId, page) => {
+        setComments(prevComments => appendReplies(prevComments, parentId, page));
+    };
+
     const handleCommentDeleted = (commentId) => {
         setComments((prevComments) => {
             if (!Array.isArray(prevComments)) return [];
-
-            return prevComments.map(comment => {
-                if (comment.id === commentId) {
-                    return { ...comment, is_deleted: true };
-                }
-                return comment;
-            });
+            return markDeleted(prevComments, commentId);
         });
     };
 
@@ -79,6 +150,12 @@ const JokeDetail = () => {
                     <div className="comments-section">
                         <h3 className="comments-header">Comments ({joke.comment_count})</h3>
 
+                        {focusedId && (
+                            <div className="thread-notice">
+                                Viewing a single comment thread. <Link to={`/joke/${jokeId}`}>View all comments</Link>
+                            </div>
+                        )}
+
                         {currentUser && (
                             <CommentForm
                                 jokeId={jokeId}
@@ -91,10 +168,18 @@ const JokeDetail = () => {
                                 comments={comments}
                                 onCommentDeleted={handleCommentDeleted}
                                 onReplyAdded={handleCommentAdded}
+                                onRepliesLoaded={handleRepliesLoaded}
+                                focusedId={focusedId}
                             />
                         ) : (
                             <div className="no-comments">No comments yet. Be the first to comment!</div>
                         )}
+
+                        {nextCursor && (
+                            <button className="load-more-comments" onClick={handleLoadMore} disabled={loadingMore}>
+                                {loadingMore ? "Loading..." : "Load more comments"}
+                            </button>
+                        )}
                     </div>
                 </>
             )}
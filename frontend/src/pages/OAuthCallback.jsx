@@ -5,15 +5,15 @@ import { useAuth } from '../contexts/AuthContext';
 
 const OAuthCallback = () => {
     const navigate = useNavigate();
-    const { login } = useAuth();
+    const { setUser } = useAuth();
 
     useEffect(() => {
         const processCallback = async () => {
             try {
-                const user = await handleOAuthCallback();
+                const { user, returnTo } = await handleOAuthCallback();
                 if (user) {
-                    login(user);
-                    navigate('/');
+                    setUser(user);
+                    navigate(returnTo);
                 } else {
                     navigate('/auth', { state: { error: 'Authentication failed' } });
                 }
@@ -24,7 +24,7 @@ const OAuthCallback = () => {
         };
 
         processCallback();
-    }, [navigate, login]);
+    }, [navigate, setUser]);
 
     return (
         <div className="loading-container">
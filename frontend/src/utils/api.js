@@ -2,14 +2,45 @@ import axios from 'axios';
 
 const BASE_API_URL = import.meta.env.VITE_API_URL || `${window.location.protocol}//${window.location.host}/api`;
 
+// In cookie mode the access token lives in an HttpOnly cookie that the browser
+// sends itself; state-changing requests must echo the CSRF token in a header.
+export const usesCookieSession = import.meta.env.VITE_SESSION_MODE === 'cookie';
+
+const CSRF_HEADER = import.meta.env.VITE_CSRF_HEADER || 'X-CSRF-Token';
+const CSRF_COOKIE = import.meta.env.VITE_CSRF_COOKIE || 'bj_csrf';
+const SAFE_METHODS = ['get', 'head', 'options'];
+
+let csrfToken = null;
+
+export const setCSRFToken = (token) => {
+    csrfToken = token || null;
+};
+
+// The CSRF cookie is only readable here when the API shares the frontend's
+// site; otherwise the token handed back by the API is used.
+const readCSRFCookie = () => {
+    const match = document.cookie.match(new RegExp(`(?:^|; )${CSRF_COOKIE}=([^;]*)`));
+    return match ? decodeURIComponent(match[1]) : null;
+};
+
 export const api = axios.create({
     baseURL: BASE_API_URL,
+    withCredentials: usesCookieSession,
 });
 
 api.interceptors.request.use((config) => {
+    if (usesCookieSession) {
+        const method = (config.method || 'get').toLowerCase();
+        const token = csrfToken || readCSRFCookie();
+        if (token && !SAFE_METHODS.includes(method)) {
+            config.headers[CSRF_HEADER] = token;
+        }
+        return config;
+    }
+
     const token = localStorage.getItem("token");
     if (token) {
         config.headers.Authorization = `Bearer ${token}`;
     }
     return config;
-});
\ No newline at end of file
+});